@@ -0,0 +1,301 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"maps"
+	"net/url"
+	"os"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// Config is the server configuration, read from a JSON file. Durations are
+// strings such as "30s" or "1m30s".
+type Config struct {
+	Listen    []ListenConfig  `json:"listen"`
+	Timeouts  TimeoutsConfig  `json:"timeouts"`
+	Limits    LimitsConfig    `json:"limits"`
+	Static    []StaticRoute   `json:"static"`
+	Proxies   []ProxyRoute    `json:"proxies"`
+	Redirects []RedirectRoute `json:"redirects"`
+	Log       LogConfig       `json:"log"`
+	Metrics   string          `json:"metrics"`
+	Assets    string          `json:"assets"`
+	// ErrorPages maps status codes to the html/template files of their
+	// error pages. Other statuses get the default page.
+	ErrorPages map[string]string `json:"error_pages"`
+}
+
+// ListenConfig is an address to accept connections on: "host:port" for TCP
+// or "unix:/path/to/socket". TLS is enabled when both files are given.
+type ListenConfig struct {
+	Address string `json:"address"`
+	TLSCert string `json:"tls_cert"`
+	TLSKey  string `json:"tls_key"`
+}
+
+type TimeoutsConfig struct {
+	Read  Duration `json:"read"`
+	Write Duration `json:"write"`
+	Idle  Duration `json:"idle"`
+	// Shutdown bounds how long requests in progress may take to finish
+	// when the server stops or hands over to an upgraded process. Zero closes
+	// them right away.
+	Shutdown Duration `json:"shutdown"`
+}
+
+type LimitsConfig struct {
+	MaxConnections      int   `json:"max_connections"`
+	MaxConnectionsPerIP int   `json:"max_connections_per_ip"`
+	MaxInFlight         int   `json:"max_in_flight"`
+	MaxRequestsPerConn  int   `json:"max_requests_per_conn"`
+	MaxBodySize         int64 `json:"max_body_size"`
+}
+
+// StaticRoute serves the files below Root for request paths under Prefix.
+type StaticRoute struct {
+	Prefix string `json:"prefix"`
+	Root   string `json:"root"`
+}
+
+// ProxyRoute forwards requests under Prefix to the upstreams.
+type ProxyRoute struct {
+	Prefix      string   `json:"prefix"`
+	Upstreams   []string `json:"upstreams"`
+	StripPrefix bool     `json:"strip_prefix"`
+	Balancer    string   `json:"balancer"`
+	Timeout     Duration `json:"timeout"`
+}
+
+// RedirectRoute redirects requests for the exact path From to To.
+type RedirectRoute struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	Status int    `json:"status"`
+}
+
+type LogConfig struct {
+	Format string `json:"format"`
+	Level  string `json:"level"`
+}
+
+// Duration is a time.Duration written as a string in the config file.
+type Duration struct {
+	time.Duration
+}
+
+func (d *Duration) UnmarshalJSON(data []byte) error {
+	var s string
+	if err := json.Unmarshal(data, &s); err != nil {
+		return fmt.Errorf("duration must be a string such as \"30s\"")
+	}
+
+	duration, err := time.ParseDuration(s)
+	if err != nil {
+		return err
+	}
+	d.Duration = duration
+
+	return nil
+}
+
+func (d Duration) MarshalJSON() ([]byte, error) {
+	return json.Marshal(d.String())
+}
+
+// DefaultConfig returns the defaults config files are read on top of.
+func DefaultConfig() Config {
+	return Config{
+		Listen:   []ListenConfig{{Address: ":42069"}},
+		Timeouts: TimeoutsConfig{Shutdown: Duration{30 * time.Second}},
+		Log:      LogConfig{Format: "combined", Level: "info"},
+		Metrics:  "/metrics",
+		Assets:   "./assets",
+	}
+}
+
+// demoProxies are the example proxy routes of a server started without a
+// config file.
+func demoProxies() []ProxyRoute {
+	return []ProxyRoute{{
+		Prefix:      "/httpbin/",
+		Upstreams:   []string{"https://httpbin.org"},
+		StripPrefix: true,
+		Timeout:     Duration{30 * time.Second},
+	}}
+}
+
+// LoadConfig reads the config file at path on top of the defaults, so fields
+// missing from the file keep their default value. Unknown fields are rejected
+// so typos don't go unnoticed. Without a config file the demo proxy routes
+// are added to the defaults.
+func LoadConfig(path string) (Config, error) {
+	cfg := DefaultConfig()
+	if path == "" {
+		cfg.Proxies = demoProxies()
+		return cfg, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return cfg, err
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(data))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(&cfg); err != nil {
+		var syntaxErr *json.SyntaxError
+		if errors.As(err, &syntaxErr) {
+			line := bytes.Count(data[:syntaxErr.Offset], []byte("\n")) + 1
+			return cfg, fmt.Errorf("%s:%d: %w", path, line, err)
+		}
+		return cfg, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return cfg, nil
+}
+
+// Validate reports every problem with the configuration at once.
+func (cfg Config) Validate() error {
+	var errs []error
+	fail := func(field, format string, args ...any) {
+		errs = append(errs, fmt.Errorf("%s: %s", field, fmt.Sprintf(format, args...)))
+	}
+
+	if len(cfg.Listen) == 0 {
+		fail("listen", "at least one address is required")
+	}
+	for i, l := range cfg.Listen {
+		field := fmt.Sprintf("listen[%d]", i)
+		if l.Address == "" {
+			fail(field+".address", "must not be empty")
+		} else if path, ok := strings.CutPrefix(l.Address, "unix:"); ok && path == "" {
+			fail(field+".address", "unix socket path must not be empty")
+		}
+		if (l.TLSCert == "") != (l.TLSKey == "") {
+			fail(field, "tls_cert and tls_key must be set together")
+		}
+		for _, file := range []string{l.TLSCert, l.TLSKey} {
+			if file == "" {
+				continue
+			}
+			if _, err := os.Stat(file); err != nil {
+				fail(field, "%s", err)
+			}
+		}
+	}
+
+	for _, d := range []struct {
+		name  string
+		value Duration
+	}{
+		{"read", cfg.Timeouts.Read},
+		{"write", cfg.Timeouts.Write},
+		{"idle", cfg.Timeouts.Idle},
+		{"shutdown", cfg.Timeouts.Shutdown},
+	} {
+		if d.value.Duration < 0 {
+			fail("timeouts."+d.name, "must not be negative")
+		}
+	}
+	for _, n := range []struct {
+		name  string
+		value int
+	}{
+		{"max_connections", cfg.Limits.MaxConnections},
+		{"max_connections_per_ip", cfg.Limits.MaxConnectionsPerIP},
+		{"max_in_flight", cfg.Limits.MaxInFlight},
+		{"max_requests_per_conn", cfg.Limits.MaxRequestsPerConn},
+	} {
+		if n.value < 0 {
+			fail("limits."+n.name, "must not be negative")
+		}
+	}
+	if cfg.Limits.MaxBodySize < 0 {
+		fail("limits.max_body_size", "must not be negative")
+	}
+
+	for i, route := range cfg.Static {
+		field := fmt.Sprintf("static[%d]", i)
+		if !strings.HasPrefix(route.Prefix, "/") {
+			fail(field+".prefix", "must start with /")
+		}
+		if info, err := os.Stat(route.Root); err != nil {
+			fail(field+".root", "%s", err)
+		} else if !info.IsDir() {
+			fail(field+".root", "%s is not a directory", route.Root)
+		}
+	}
+
+	for i, route := range cfg.Proxies {
+		field := fmt.Sprintf("proxies[%d]", i)
+		if !strings.HasPrefix(route.Prefix, "/") {
+			fail(field+".prefix", "must start with /")
+		}
+		if len(route.Upstreams) == 0 {
+			fail(field+".upstreams", "at least one upstream is required")
+		}
+		for j, upstream := range route.Upstreams {
+			u, err := url.Parse(upstream)
+			if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+				fail(fmt.Sprintf("%s.upstreams[%d]", field, j), "%q is not an http or https URL", upstream)
+			}
+		}
+		switch route.Balancer {
+		case "", "round_robin", "least_connections":
+		default:
+			fail(field+".balancer", "unknown balancer %q, want round_robin or least_connections", route.Balancer)
+		}
+		if route.Timeout.Duration < 0 {
+			fail(field+".timeout", "must not be negative")
+		}
+	}
+
+	for i, route := range cfg.Redirects {
+		field := fmt.Sprintf("redirects[%d]", i)
+		if !strings.HasPrefix(route.From, "/") {
+			fail(field+".from", "must start with /")
+		}
+		if route.To == "" {
+			fail(field+".to", "must not be empty")
+		}
+		switch response.StatusCode(route.Status) {
+		case 0, response.StatusMovedPermanently, response.StatusFound, response.StatusSeeOther,
+			response.StatusTemporaryRedirect, response.StatusPermanentRedirect:
+		default:
+			fail(field+".status", "%d is not a redirect status", route.Status)
+		}
+	}
+
+	for _, code := range slices.Sorted(maps.Keys(cfg.ErrorPages)) {
+		field := "error_pages." + code
+		if status, err := strconv.Atoi(code); err != nil || status < 400 || status > 599 {
+			fail(field, "%q is not a 4xx or 5xx status", code)
+		}
+		if _, err := template.ParseFiles(cfg.ErrorPages[code]); err != nil {
+			fail(field, "%s", err)
+		}
+	}
+
+	switch cfg.Log.Format {
+	case "json", "common", "combined":
+	default:
+		fail("log.format", "unknown format %q, want json, common or combined", cfg.Log.Format)
+	}
+	if _, err := parseLevel(cfg.Log.Level); err != nil {
+		fail("log.level", "%s", err)
+	}
+	if cfg.Metrics != "" && !strings.HasPrefix(cfg.Metrics, "/") {
+		fail("metrics", "must start with /")
+	}
+
+	return errors.Join(errs...)
+}
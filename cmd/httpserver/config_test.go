@@ -0,0 +1,271 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLoadConfig(t *testing.T) {
+	write := func(content string) string {
+		path := filepath.Join(t.TempDir(), "config.json")
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+		return path
+	}
+
+	tests := []struct {
+		name    string
+		path    string
+		wantErr string
+		check   func(t *testing.T, cfg Config)
+	}{
+		{
+			name: "No file gives the defaults and the demo proxy",
+			path: "",
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, ":42069", cfg.Listen[0].Address)
+				require.Len(t, cfg.Proxies, 1)
+				assert.Equal(t, "/httpbin/", cfg.Proxies[0].Prefix)
+			},
+		},
+		{
+			name: "Fields missing from the file keep their default",
+			path: write(`{"listen": [{"address": ":8080"}], "timeouts": {"read": "10s"}}`),
+			check: func(t *testing.T, cfg Config) {
+				assert.Equal(t, ":8080", cfg.Listen[0].Address)
+				assert.Equal(t, 10*time.Second, cfg.Timeouts.Read.Duration)
+				assert.Equal(t, 30*time.Second, cfg.Timeouts.Shutdown.Duration)
+				assert.Equal(t, "combined", cfg.Log.Format)
+				assert.Empty(t, cfg.Proxies)
+			},
+		},
+		{
+			name:    "Missing file",
+			path:    filepath.Join(t.TempDir(), "missing.json"),
+			wantErr: "no such file or directory",
+		},
+		{
+			name:    "Syntax errors report the line",
+			path:    write("{\n  \"listen\": [\n    {\"address\": \":8080\",}\n  ]\n}"),
+			wantErr: "config.json:3: invalid character '}'",
+		},
+		{
+			name:    "Unknown fields are rejected",
+			path:    write(`{"listne": []}`),
+			wantErr: `unknown field "listne"`,
+		},
+		{
+			name:    "Durations must be strings",
+			path:    write(`{"timeouts": {"read": 10}}`),
+			wantErr: `duration must be a string such as "30s"`,
+		},
+		{
+			name:    "Durations must parse",
+			path:    write(`{"timeouts": {"idle": "ten seconds"}}`),
+			wantErr: `invalid duration "ten seconds"`,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg, err := LoadConfig(tt.path)
+			if tt.wantErr != "" {
+				require.Error(t, err)
+				assert.Contains(t, err.Error(), tt.wantErr)
+				return
+			}
+			require.NoError(t, err)
+			tt.check(t, cfg)
+		})
+	}
+}
+
+func TestValidate(t *testing.T) {
+	dir := t.TempDir()
+	cert := filepath.Join(dir, "cert.pem")
+	key := filepath.Join(dir, "key.pem")
+	page := filepath.Join(dir, "404.html")
+	broken := filepath.Join(dir, "broken.html")
+	for path, content := range map[string]string{cert: "cert", key: "key", page: "<p>{{.Title}}</p>", broken: "{{.Title"} {
+		require.NoError(t, os.WriteFile(path, []byte(content), 0o644))
+	}
+
+	tests := []struct {
+		name    string
+		modify  func(cfg *Config)
+		wantErr []string
+	}{
+		{
+			name:   "Defaults are valid",
+			modify: func(cfg *Config) {},
+		},
+		{
+			name: "A complete configuration is valid",
+			modify: func(cfg *Config) {
+				cfg.Listen = []ListenConfig{{Address: ":8443", TLSCert: cert, TLSKey: key}, {Address: "unix:/tmp/test.sock"}}
+				cfg.Static = []StaticRoute{{Prefix: "/static/", Root: dir}}
+				cfg.Proxies = []ProxyRoute{{Prefix: "/api/", Upstreams: []string{"http://127.0.0.1:8080"}, Balancer: "least_connections"}}
+				cfg.Redirects = []RedirectRoute{{From: "/old", To: "/new", Status: 308}}
+				cfg.ErrorPages = map[string]string{"404": page}
+			},
+		},
+		{
+			name:    "Listeners",
+			modify:  func(cfg *Config) { cfg.Listen = nil },
+			wantErr: []string{"listen: at least one address is required"},
+		},
+		{
+			name: "Listener addresses",
+			modify: func(cfg *Config) {
+				cfg.Listen = []ListenConfig{{Address: ""}, {Address: "unix:"}}
+			},
+			wantErr: []string{
+				"listen[0].address: must not be empty",
+				"listen[1].address: unix socket path must not be empty",
+			},
+		},
+		{
+			name: "TLS pairs",
+			modify: func(cfg *Config) {
+				cfg.Listen = []ListenConfig{
+					{Address: ":8443", TLSCert: cert},
+					{Address: ":8444", TLSKey: key},
+					{Address: ":8445", TLSCert: filepath.Join(dir, "missing.pem"), TLSKey: key},
+				}
+			},
+			wantErr: []string{
+				"listen[0]: tls_cert and tls_key must be set together",
+				"listen[1]: tls_cert and tls_key must be set together",
+				"listen[2]: stat " + filepath.Join(dir, "missing.pem"),
+			},
+		},
+		{
+			name: "Timeouts",
+			modify: func(cfg *Config) {
+				cfg.Timeouts = TimeoutsConfig{
+					Read:     Duration{-time.Second},
+					Write:    Duration{-time.Second},
+					Idle:     Duration{-time.Second},
+					Shutdown: Duration{-time.Second},
+				}
+			},
+			wantErr: []string{
+				"timeouts.read: must not be negative",
+				"timeouts.write: must not be negative",
+				"timeouts.idle: must not be negative",
+				"timeouts.shutdown: must not be negative",
+			},
+		},
+		{
+			name: "Limits",
+			modify: func(cfg *Config) {
+				cfg.Limits = LimitsConfig{
+					MaxConnections:      -1,
+					MaxConnectionsPerIP: -1,
+					MaxInFlight:         -1,
+					MaxRequestsPerConn:  -1,
+					MaxBodySize:         -1,
+				}
+			},
+			wantErr: []string{
+				"limits.max_connections: must not be negative",
+				"limits.max_connections_per_ip: must not be negative",
+				"limits.max_in_flight: must not be negative",
+				"limits.max_requests_per_conn: must not be negative",
+				"limits.max_body_size: must not be negative",
+			},
+		},
+		{
+			name: "Static routes",
+			modify: func(cfg *Config) {
+				cfg.Static = []StaticRoute{
+					{Prefix: "static/", Root: dir},
+					{Prefix: "/missing/", Root: filepath.Join(dir, "missing")},
+					{Prefix: "/file/", Root: page},
+				}
+			},
+			wantErr: []string{
+				"static[0].prefix: must start with /",
+				"static[1].root: stat " + filepath.Join(dir, "missing"),
+				"static[2].root: " + page + " is not a directory",
+			},
+		},
+		{
+			name: "Proxy routes",
+			modify: func(cfg *Config) {
+				cfg.Proxies = []ProxyRoute{
+					{Prefix: "api/", Upstreams: []string{"ftp://example.com", "http://"}, Balancer: "random", Timeout: Duration{-time.Second}},
+					{Prefix: "/empty/"},
+				}
+			},
+			wantErr: []string{
+				"proxies[0].prefix: must start with /",
+				`proxies[0].upstreams[0]: "ftp://example.com" is not an http or https URL`,
+				`proxies[0].upstreams[1]: "http://" is not an http or https URL`,
+				`proxies[0].balancer: unknown balancer "random"`,
+				"proxies[0].timeout: must not be negative",
+				"proxies[1].upstreams: at least one upstream is required",
+			},
+		},
+		{
+			name: "Redirect routes",
+			modify: func(cfg *Config) {
+				cfg.Redirects = []RedirectRoute{{From: "old", To: "", Status: 200}}
+			},
+			wantErr: []string{
+				"redirects[0].from: must start with /",
+				"redirects[0].to: must not be empty",
+				"redirects[0].status: 200 is not a redirect status",
+			},
+		},
+		{
+			name: "Error pages",
+			modify: func(cfg *Config) {
+				cfg.ErrorPages = map[string]string{"200": page, "404": broken}
+			},
+			wantErr: []string{
+				`error_pages.200: "200" is not a 4xx or 5xx status`,
+				"error_pages.404: template: broken.html",
+			},
+		},
+		{
+			name: "Logging and metrics",
+			modify: func(cfg *Config) {
+				cfg.Log = LogConfig{Format: "xml", Level: "loud"}
+				cfg.Metrics = "metrics"
+			},
+			wantErr: []string{
+				`log.format: unknown format "xml"`,
+				"log.level: ",
+				"metrics: must start with /",
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := DefaultConfig()
+			tt.modify(&cfg)
+			err := cfg.Validate()
+			if len(tt.wantErr) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			for _, want := range tt.wantErr {
+				assert.Contains(t, err.Error(), want)
+			}
+		})
+	}
+}
+
+func TestExampleConfig(t *testing.T) {
+	// Test: The example config loads and validates from the repository root,
+	// which its relative paths point into
+	t.Chdir("../..")
+	cfg, err := LoadConfig("cmd/httpserver/config.example.json")
+	require.NoError(t, err)
+	assert.NoError(t, cfg.Validate())
+}
@@ -1,151 +1,261 @@
 package main
 
 import (
-	"bytes"
-	"compress/gzip"
-	"crypto/sha256"
+	"context"
+	"flag"
 	"fmt"
+	"io"
 	"log"
-	"net/http"
+	"log/slog"
+	"net"
 	"os"
 	"os/signal"
 	"slices"
-	"strconv"
 	"strings"
+	"sync"
 	"syscall"
 
-	"github.com/rmdevio/httpserver/internal/headers"
-	"github.com/rmdevio/httpserver/internal/request"
-	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/metrics"
 	"github.com/rmdevio/httpserver/internal/server"
 )
 
-const port = 42069
+// overrides holds the flags that take precedence over the config file.
+type overrides struct {
+	listen    string
+	tlsCert   string
+	tlsKey    string
+	logFormat string
+	logLevel  string
+	assets    string
+}
 
 func main() {
-	server, err := server.Serve(port, func(w response.Writer, req *request.Request) {
-		h := response.GetDefaultHeaders(0)
-		body := response.RespondOK()
-		statusCode := response.StatusOk
-
-		if req.RequestLine.RequestTarget == "/yourproblem" {
-			body = response.RespondBadRequest()
-			statusCode = response.StatusBadRequest
-		} else if req.RequestLine.RequestTarget == "/myproblem" {
-			body = response.RespondInternalServerError()
-			statusCode = response.StatusInternalServerError
-		} else if req.RequestLine.RequestTarget == "/httpbin/stream/100" {
-			target := req.RequestLine.RequestTarget
-			res, err := http.Get("https://httpbin.org/" + target[len("/httpbin/"):])
-			if err != nil {
-				body = response.RespondInternalServerError()
-				statusCode = response.StatusInternalServerError
-			} else {
-				defer res.Body.Close()
-				w.WriteStatusLine(response.StatusOk)
-
-				h.Remove("Content-Length")
-				h.Set("Transfer-Encoding", "chunked")
-				h.Replace("Content-Type", "text/plain")
-				h.Set("Trailer", "X-Content-SHA256")
-				h.Set("Trailer", "X-Content-Length")
-				w.WriteHeaders(h)
-
-				fullBody := []byte{}
-				for {
-					data := make([]byte, 32)
-					n, err := res.Body.Read(data)
-					if err != nil {
-						break
-					}
-
-					fullBody = append(fullBody, data[:n]...)
-					w.WriteBody([]byte(fmt.Sprintf("%x\r\n", n)))
-					w.WriteBody(data[:n])
-					w.WriteBody([]byte("\r\n"))
-				}
-				w.WriteBody([]byte("0\r\n\r\n"))
-				tailers := headers.NewHeaders()
-				out := sha256.Sum256(fullBody)
-				tailers.Set("X-Content-SHA256", toStr(out[:]))
-				tailers.Set("X-Content-Length", strconv.Itoa(len(fullBody)))
-
-				w.WriteHeaders(tailers)
-				return
+	configPath := flag.String("config", "", "path to a JSON config file, re-read on SIGHUP")
+	var flags overrides
+	flag.StringVar(&flags.listen, "listen", "", "comma-separated addresses to listen on, replacing the configured ones")
+	flag.StringVar(&flags.tlsCert, "tls-cert", "", "TLS certificate file for every listen address")
+	flag.StringVar(&flags.tlsKey, "tls-key", "", "TLS key file for every listen address")
+	flag.StringVar(&flags.logFormat, "log-format", "", "access log format: json, common or combined")
+	flag.StringVar(&flags.logLevel, "log-level", "", "log level: debug, info, warn or error")
+	flag.StringVar(&flags.assets, "assets", "", "directory holding the demo assets")
+	check := flag.Bool("check", false, "validate the configuration and exit")
+	flag.Parse()
+
+	cfg, err := loadConfig(*configPath, flags)
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n  %s", strings.ReplaceAll(err.Error(), "\n", "\n  "))
+	}
+	if *check {
+		fmt.Println("Configuration OK")
+		return
+	}
+
+	level := new(slog.LevelVar)
+	logger := newLogger(os.Stdout, cfg.Log.Format, level)
+
+	a, err := newApp(cfg, logger, level)
+	if err != nil {
+		log.Fatalf("Error creating server: %v", err)
+	}
+
+	inherited, err := inheritedListeners()
+	if err != nil {
+		log.Fatalf("Error starting server: %v", err)
+	}
+
+	opts := append(serverOptions(cfg, logger), server.WithErrorPages(a.pages), server.WithMetricsRoute(a.route))
+	var (
+		servers   []*server.Server
+		addrs     []string
+		listeners []net.Listener
+	)
+	for _, l := range cfg.Listen {
+		listenerOpts := opts
+		if tlsConfig := a.tlsConfig(l.Address); tlsConfig != nil {
+			listenerOpts = append(slices.Clip(opts), server.WithTLSConfig(tlsConfig))
+		}
+
+		listener, ok := inherited[l.Address]
+		delete(inherited, l.Address)
+		if !ok {
+			if listener, err = newListener(l.Address); err != nil {
+				log.Fatalf("Error starting server: %v", err)
 			}
-		} else if req.RequestLine.RequestTarget == "/video" {
-			file, err := os.Open("./assets/video.mp4")
+		}
+		srv := server.ServeListener(listener, a.handler.Handle, listenerOpts...)
+		servers = append(servers, srv)
+		addrs = append(addrs, l.Address)
+		listeners = append(listeners, listener)
+		log.Println("Server started on", listenerName(l))
+	}
+	for _, listener := range inherited {
+		// No longer configured
+		listener.Close()
+	}
+	if err := notifyReady(); err != nil {
+		logger.Error("failed to notify the previous process", "error", err)
+	}
+
+	sigChan := make(chan os.Signal, 1)
+	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM, syscall.SIGHUP, syscall.SIGUSR2)
+	for sig := range sigChan {
+		if sig == syscall.SIGUSR2 {
+			process, err := upgrade(addrs, listeners)
 			if err != nil {
-				h.Replace("Content-Type", "text/html")
-				body = response.RespondInternalServerError()
-				statusCode = response.StatusInternalServerError
-			} else {
-				defer file.Close()
-
-				info, err := file.Stat()
-				if err != nil {
-					h.Replace("Content-Type", "text/html")
-					body = response.RespondInternalServerError()
-					statusCode = response.StatusInternalServerError
-				} else {
-					h.Replace("Content-Type", "video/mp4")
-					h.Replace("Content-Length", strconv.FormatInt(info.Size(), 10))
-
-					w.WriteStatusLine(response.StatusOk)
-					w.WriteHeaders(h)
-
-					w.WriteChunkedBody(file)
-					return
-				}
+				logger.Error("upgrade failed, keeping the current process", "error", err)
+				continue
 			}
-		} else if req.RequestLine.RequestTarget == "/compressed" {
-			encodingHeader := req.Headers.Get("Accept-Encoding")
-			if len(encodingHeader) != 0 {
-				headerParts := strings.Split(encodingHeader, ", ")
-				gzipHeaderFound := slices.Contains(headerParts, "gzip")
-
-				if gzipHeaderFound {
-					h.Replace("Content-Type", "text/plain")
-					h.Set("Content-Encoding", "gzip")
+			logger.Info("listeners handed to the new process, draining", "pid", process.Pid)
+			for _, listener := range listeners {
+				if unix, ok := listener.(*net.UnixListener); ok {
+					// The socket file now belongs to the new process
+					unix.SetUnlinkOnClose(false)
 				}
+			}
+			break
+		}
+		if sig != syscall.SIGHUP {
+			break
+		}
 
-				buf := bytes.NewBuffer([]byte{})
-				zw := gzip.NewWriter(buf)
-				zw.Write(response.RespondOK())
-				zw.Flush()
-				zw.Close()
+		cfg, err := loadConfig(*configPath, flags)
+		if err == nil {
+			err = a.reload(cfg)
+		}
+		if err != nil {
+			logger.Error("reload failed, keeping the current configuration", "error", err)
+			continue
+		}
+		logger.Info("configuration reloaded")
+	}
 
-				body = buf.Bytes()
+	ctx, cancel := context.WithTimeout(context.Background(), a.cfg.Timeouts.Shutdown.Duration)
+	defer cancel()
+	var wg sync.WaitGroup
+	for _, srv := range servers {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := srv.Shutdown(ctx); err != nil {
+				logger.Warn("connections still open at shutdown were closed", "addr", srv.Addr().String())
 			}
-		}
+		}()
+	}
+	wg.Wait()
+	log.Println("Server gracefully stopped")
+}
 
-		h.Replace("Content-Length", strconv.Itoa(len(body)))
-		w.WriteStatusLine(statusCode)
+// loadConfig reads the config file, applies the flag overrides and
+// validates the result.
+func loadConfig(path string, flags overrides) (Config, error) {
+	cfg, err := LoadConfig(path)
+	if err != nil {
+		return cfg, err
+	}
 
-		connHeader := req.Headers.Get("Connection")
-		if len(connHeader) != 0 && connHeader == "close" {
-			h.Replace("Connection", "close")
+	if flags.listen != "" {
+		cfg.Listen = nil
+		for _, addr := range strings.Split(flags.listen, ",") {
+			cfg.Listen = append(cfg.Listen, ListenConfig{Address: strings.TrimSpace(addr)})
 		}
-		w.WriteHeaders(h)
-		w.WriteBody(body)
-	})
-	if err != nil {
-		log.Fatalf("Error starting server: %v", err)
 	}
-	defer server.Close()
-	log.Println("Server started on port", port)
+	if flags.tlsCert != "" || flags.tlsKey != "" {
+		for i := range cfg.Listen {
+			cfg.Listen[i].TLSCert, cfg.Listen[i].TLSKey = flags.tlsCert, flags.tlsKey
+		}
+	}
+	if flags.logFormat != "" {
+		cfg.Log.Format = flags.logFormat
+	}
+	if flags.logLevel != "" {
+		cfg.Log.Level = flags.logLevel
+	}
+	if flags.assets != "" {
+		cfg.Assets = flags.assets
+	}
 
-	sigChan := make(chan os.Signal, 1)
-	signal.Notify(sigChan, syscall.SIGINT, syscall.SIGTERM)
-	<-sigChan
-	log.Println("Server gracefully stopped")
+	return cfg, cfg.Validate()
 }
 
-func toStr(byteSlice []byte) string {
-	out := ""
-	for _, b := range byteSlice {
-		out += fmt.Sprintf("%02x", b)
+// newListener listens on a TCP address or a "unix:" socket path.
+func newListener(address string) (net.Listener, error) {
+	if path, ok := strings.CutPrefix(address, "unix:"); ok {
+		return net.Listen("unix", path)
 	}
 
-	return string(out)
+	return net.Listen("tcp", address)
+}
+
+func listenerName(l ListenConfig) string {
+	if l.TLSCert != "" {
+		return l.Address + " (TLS)"
+	}
+
+	return l.Address
+}
+
+func serverOptions(cfg Config, logger *slog.Logger) []server.Option {
+	opts := []server.Option{
+		server.WithLogger(logger),
+		server.WithTimeouts(server.Timeouts{
+			ReadTimeout:  cfg.Timeouts.Read.Duration,
+			WriteTimeout: cfg.Timeouts.Write.Duration,
+		}),
+		server.WithKeepAlive(server.KeepAlive{
+			MaxRequests: cfg.Limits.MaxRequestsPerConn,
+			IdleTimeout: cfg.Timeouts.Idle.Duration,
+		}),
+		server.WithLimits(server.Limits{
+			MaxConnections:      cfg.Limits.MaxConnections,
+			MaxConnectionsPerIP: cfg.Limits.MaxConnectionsPerIP,
+			MaxInFlight:         cfg.Limits.MaxInFlight,
+			MaxBodySize:         cfg.Limits.MaxBodySize,
+		}),
+	}
+	if cfg.Metrics != "" {
+		opts = append(opts, server.WithMetrics(metrics.NewRegistry(), cfg.Metrics))
+	}
+
+	return opts
+}
+
+// newLogger returns a JSON logger for the json access log format and a text
+// logger otherwise, filtering records below level.
+func newLogger(out io.Writer, format string, level slog.Leveler) *slog.Logger {
+	handlerOpts := &slog.HandlerOptions{Level: level}
+	if format == "json" {
+		return slog.New(slog.NewJSONHandler(out, handlerOpts))
+	}
+
+	return slog.New(slog.NewTextHandler(out, handlerOpts))
+}
+
+func parseLevel(s string) (slog.Level, error) {
+	var level slog.Level
+	if s == "" {
+		return level, nil
+	}
+	err := level.UnmarshalText([]byte(s))
+
+	return level, err
+}
+
+func accessLogFormat(format string) server.LogFormat {
+	switch format {
+	case "common":
+		return server.LogFormatCommon
+	case "combined":
+		return server.LogFormatCombined
+	}
+
+	return server.LogFormatJSON
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Serves the demo endpoints plus the static, proxy and redirect routes of the")
+		fmt.Fprintln(flag.CommandLine.Output(), "config file. Flags override the values from the file.")
+		flag.PrintDefaults()
+	}
 }
@@ -0,0 +1,205 @@
+package main
+
+import (
+	"crypto/tls"
+	"fmt"
+	"log/slog"
+	"slices"
+	"strconv"
+	"sync/atomic"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+)
+
+// app holds what a configuration reload replaces in the running server: the
+// handler with its routes and middleware, the log level, the error pages and
+// the TLS certificates of every listener.
+type app struct {
+	cfg     Config
+	logger  *slog.Logger
+	level   *slog.LevelVar
+	handler *server.SwappableHandler
+	router  atomic.Pointer[router]
+	certs   map[string]*certificate
+	pages   *response.ErrorPages
+}
+
+// certificate serves the current certificate of a TLS listener.
+type certificate struct {
+	atomic.Pointer[tls.Certificate]
+}
+
+func (c *certificate) get(*tls.ClientHelloInfo) (*tls.Certificate, error) {
+	return c.Load(), nil
+}
+
+func newApp(cfg Config, logger *slog.Logger, level *slog.LevelVar) (*app, error) {
+	a := &app{
+		cfg:    cfg,
+		logger: logger,
+		level:  level,
+		certs:  make(map[string]*certificate),
+	}
+
+	lvl, err := parseLevel(cfg.Log.Level)
+	if err != nil {
+		return nil, err
+	}
+	r, handler, err := a.build(cfg)
+	if err != nil {
+		return nil, err
+	}
+	certs, err := loadCertificates(cfg)
+	if err != nil {
+		return nil, err
+	}
+	if a.pages, err = loadErrorPages(cfg); err != nil {
+		return nil, err
+	}
+
+	a.level.Set(lvl)
+	a.router.Store(r)
+	a.handler = server.NewSwappableHandler(handler)
+	for addr, cert := range certs {
+		a.certs[addr] = &certificate{}
+		a.certs[addr].Store(cert)
+	}
+
+	return a, nil
+}
+
+// build returns the router for cfg and the handler wrapping it with the
+// configured middleware.
+func (a *app) build(cfg Config) (*router, server.Handler, error) {
+	r, err := newRouter(cfg, a.logger)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return r, server.Chain(r.Handle, server.Trace(), server.AccessLog(a.logger, accessLogFormat(cfg.Log.Format))), nil
+}
+
+// route returns the route label of req in the request metrics.
+func (a *app) route(req *request.Request) string {
+	return a.router.Load().route(req)
+}
+
+// tlsConfig returns the TLS configuration for a listener, or nil if it
+// doesn't serve TLS.
+func (a *app) tlsConfig(address string) *tls.Config {
+	cert, ok := a.certs[address]
+	if !ok {
+		return nil
+	}
+
+	return &tls.Config{GetCertificate: cert.get}
+}
+
+// reload applies cfg if it is valid. Everything is prepared before anything
+// is swapped, so a failing reload leaves the running configuration intact.
+func (a *app) reload(cfg Config) error {
+	if err := cfg.Validate(); err != nil {
+		return err
+	}
+	level, err := parseLevel(cfg.Log.Level)
+	if err != nil {
+		return err
+	}
+	r, handler, err := a.build(cfg)
+	if err != nil {
+		return err
+	}
+	certs, err := loadCertificates(cfg)
+	if err != nil {
+		r.close()
+		return err
+	}
+	pages, err := loadErrorPages(cfg)
+	if err != nil {
+		r.close()
+		return err
+	}
+
+	a.level.Set(level)
+	a.handler.Swap(handler)
+	a.pages.Replace(pages)
+	for addr, cert := range certs {
+		if current, ok := a.certs[addr]; ok {
+			current.Store(cert)
+		}
+	}
+	a.router.Swap(r).close()
+
+	for _, setting := range restartRequired(a.cfg, cfg) {
+		a.logger.Warn("setting changed but needs a restart to take effect", "setting", setting)
+	}
+	a.cfg = cfg
+
+	return nil
+}
+
+// loadCertificates loads the certificate of every TLS listener by address.
+func loadCertificates(cfg Config) (map[string]*tls.Certificate, error) {
+	certs := make(map[string]*tls.Certificate)
+	for _, l := range cfg.Listen {
+		if l.TLSCert == "" {
+			continue
+		}
+		cert, err := tls.LoadX509KeyPair(l.TLSCert, l.TLSKey)
+		if err != nil {
+			return nil, fmt.Errorf("listener %s: %w", l.Address, err)
+		}
+		certs[l.Address] = &cert
+	}
+
+	return certs, nil
+}
+
+// restartRequired lists the settings that differ between old and cfg but
+// are fixed once the listeners are started.
+func restartRequired(old, cfg Config) []string {
+	var settings []string
+	listeners := func(cfg Config) []string {
+		var addrs []string
+		for _, l := range cfg.Listen {
+			addrs = append(addrs, fmt.Sprintf("%s tls=%t", l.Address, l.TLSCert != ""))
+		}
+		return addrs
+	}
+	if !slices.Equal(listeners(old), listeners(cfg)) {
+		settings = append(settings, "listen")
+	}
+	if old.Timeouts.Read != cfg.Timeouts.Read || old.Timeouts.Write != cfg.Timeouts.Write || old.Timeouts.Idle != cfg.Timeouts.Idle {
+		settings = append(settings, "timeouts")
+	}
+	if old.Limits != cfg.Limits {
+		settings = append(settings, "limits")
+	}
+	if old.Metrics != cfg.Metrics {
+		settings = append(settings, "metrics")
+	}
+	if (old.Log.Format == "json") != (cfg.Log.Format == "json") {
+		settings = append(settings, "log.format")
+	}
+
+	return settings
+}
+
+// loadErrorPages returns the default error pages with the configured ones
+// registered on top.
+func loadErrorPages(cfg Config) (*response.ErrorPages, error) {
+	pages := response.NewErrorPages()
+	for code, path := range cfg.ErrorPages {
+		status, err := strconv.Atoi(code)
+		if err != nil {
+			return nil, fmt.Errorf("error page %s: %w", code, err)
+		}
+		if err := pages.RegisterFile(response.StatusCode(status), path); err != nil {
+			return nil, fmt.Errorf("error page %s: %w", code, err)
+		}
+	}
+
+	return pages, nil
+}
@@ -0,0 +1,144 @@
+package main
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+	"github.com/rmdevio/httpserver/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// writeCert writes a self-signed certificate for name and its key to dir,
+// returning their paths.
+func writeCert(t *testing.T, dir, name string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: name},
+		DNSNames:     []string{name},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	require.NoError(t, err)
+
+	certPath := filepath.Join(dir, name+".crt")
+	keyPath := filepath.Join(dir, name+".key")
+	require.NoError(t, os.WriteFile(certPath, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0o600))
+	require.NoError(t, os.WriteFile(keyPath, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER}), 0o600))
+
+	return certPath, keyPath
+}
+
+func TestReload(t *testing.T) {
+	dir := t.TempDir()
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	upstream := func(name string) string {
+		srv, err := servertest.NewServer(func(w response.Writer, req *request.Request) {
+			if req.RequestLine.RequestTarget == "/api/slow" {
+				close(entered)
+				<-release
+			}
+			h := response.GetDefaultHeaders(len(name))
+			w.WriteStatusLine(response.StatusOk)
+			w.WriteHeaders(h)
+			w.WriteBody([]byte(name))
+		})
+		require.NoError(t, err)
+		t.Cleanup(srv.Close)
+		return srv.URL
+	}
+	config := func(name string) Config {
+		cfg := DefaultConfig()
+		cert, key := writeCert(t, dir, name)
+		cfg.Listen = []ListenConfig{{Address: "127.0.0.1:0", TLSCert: cert, TLSKey: key}}
+		cfg.Proxies = []ProxyRoute{{Prefix: "/api/", Upstreams: []string{upstream(name)}}}
+		page := filepath.Join(dir, name+".html")
+		require.NoError(t, os.WriteFile(page, []byte("page "+name), 0o600))
+		cfg.ErrorPages = map[string]string{"400": page}
+		return cfg
+	}
+
+	logger := slog.New(slog.DiscardHandler)
+	a, err := newApp(config("old"), logger, new(slog.LevelVar))
+	require.NoError(t, err)
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := server.ServeListener(listener, a.handler.Handle,
+		server.WithLogger(logger),
+		server.WithErrorPages(a.pages),
+		server.WithTLSConfig(a.tlsConfig("127.0.0.1:0")),
+	)
+	t.Cleanup(srv.Close)
+
+	// get returns the name in the certificate the server presented and the
+	// response
+	get := func(target string) (string, string) {
+		conn, err := tls.Dial("tcp", srv.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = io.WriteString(conn, "GET "+target+" HTTP/1.1\r\nHost: localhost\r\nAccept: text/html\r\nConnection: close\r\n\r\n")
+		require.NoError(t, err)
+		out, err := io.ReadAll(conn)
+		require.NoError(t, err)
+		return conn.ConnectionState().PeerCertificates[0].Subject.CommonName, string(out)
+	}
+
+	name, out := get("/api/items")
+	assert.Equal(t, "old", name)
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nold"))
+
+	inFlight := make(chan string)
+	go func() {
+		_, out := get("/api/slow")
+		inFlight <- out
+	}()
+	<-entered
+
+	// Test: A reload swaps the routes, certificates and error pages of new
+	// requests
+	require.NoError(t, a.reload(config("new")))
+	name, out = get("/api/items")
+	assert.Equal(t, "new", name)
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nnew"))
+	_, out = get("/yourproblem")
+	assert.Contains(t, out, "HTTP/1.1 400 Bad Request\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\npage new"))
+
+	// Test: The request in flight during the reload finishes on the old
+	// router
+	close(release)
+	out = <-inFlight
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nold"))
+
+	// Test: A reload that fails leaves the running configuration intact
+	broken := config("broken")
+	broken.ErrorPages = map[string]string{"400": filepath.Join(dir, "missing.html")}
+	assert.Error(t, a.reload(broken))
+	name, out = get("/api/items")
+	assert.Equal(t, "new", name)
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\nnew"))
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/proxy"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+)
+
+type route struct {
+	prefix  string
+	handler server.Handler
+}
+
+// router dispatches requests according to the configuration. Redirects
+// match exact paths; static and proxy routes match by longest prefix;
+// everything else goes to the built-in demo endpoints.
+type router struct {
+	redirects map[string]RedirectRoute
+	routes    []route
+	proxies   []*proxy.Proxy
+	demo      server.Handler
+}
+
+func newRouter(cfg Config, logger *slog.Logger) (*router, error) {
+	r := &router{
+		redirects: make(map[string]RedirectRoute),
+		demo:      demoHandler(cfg.Assets, logger),
+	}
+	for _, redirect := range cfg.Redirects {
+		r.redirects[redirect.From] = redirect
+	}
+
+	for _, s := range cfg.Static {
+		files, err := server.FileServer(s.Root)
+		if err != nil {
+			return nil, err
+		}
+		r.routes = append(r.routes, route{s.Prefix, server.StripPrefix(s.Prefix)(files)})
+	}
+	for _, p := range cfg.Proxies {
+		opts := []proxy.Option{proxy.WithLogger(logger), proxy.WithTimeout(p.Timeout.Duration)}
+		if p.StripPrefix {
+			opts = append(opts, proxy.WithStripPrefix(p.Prefix))
+		}
+		if p.Balancer == "least_connections" {
+			opts = append(opts, proxy.WithBalancer(&proxy.LeastConnections{}))
+		}
+		upstream, err := proxy.New(p.Upstreams, opts...)
+		if err != nil {
+			return nil, err
+		}
+		r.proxies = append(r.proxies, upstream)
+		r.routes = append(r.routes, route{p.Prefix, upstream.Handle})
+	}
+	slices.SortStableFunc(r.routes, func(a, b route) int {
+		return len(b.prefix) - len(a.prefix)
+	})
+
+	return r, nil
+}
+
+func (r *router) Handle(w response.Writer, req *request.Request) {
+	path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	if redirect, ok := r.redirects[path]; ok {
+		writeRedirect(w, redirect)
+		return
+	}
+	for _, route := range r.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			route.handler(w, req)
+			return
+		}
+	}
+
+	r.demo(w, req)
+}
+
+// route returns the path of the redirect or the prefix of the static or
+// proxy route req matches, so request metrics are grouped by route. Demo
+// endpoints get "".
+func (r *router) route(req *request.Request) string {
+	path, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	if _, ok := r.redirects[path]; ok {
+		return path
+	}
+	for _, route := range r.routes {
+		if strings.HasPrefix(path, route.prefix) {
+			return route.prefix
+		}
+	}
+
+	return ""
+}
+
+// close releases the upstream connections of a router that has been
+// replaced, including the ones of requests still in flight once they
+// finish.
+func (r *router) close() {
+	for _, p := range r.proxies {
+		p.Close()
+	}
+}
+
+func writeRedirect(w response.Writer, r RedirectRoute) {
+	status := response.StatusCode(r.Status)
+	if status == 0 {
+		status = response.StatusMovedPermanently
+	}
+
+	h := response.GetDefaultHeaders(0)
+	h.Replace("Location", r.To)
+	w.WriteStatusLine(status)
+	w.WriteHeaders(h)
+}
+
+// demoHandler serves the example endpoints, reading the video from the
+// assets directory. Failures are logged to logger.
+func demoHandler(assets string, logger *slog.Logger) server.Handler {
+	return server.HandleErrors(logger, func(w response.Writer, req *request.Request) error {
+		h := response.GetDefaultHeaders(0)
+		body := response.RespondOK()
+
+		switch req.RequestLine.RequestTarget {
+		case "/yourproblem":
+			return response.NewProblem(response.StatusBadRequest, "The request can't be answered as it is.")
+		case "/myproblem":
+			return response.NewProblem(response.StatusInternalServerError, "The server failed to answer the request.")
+		case "/video":
+			file, err := os.Open(filepath.Join(assets, "video.mp4"))
+			if err != nil {
+				return err
+			}
+			defer file.Close()
+
+			info, err := file.Stat()
+			if err != nil {
+				return err
+			}
+			h.Replace("Content-Type", "video/mp4")
+			h.Replace("Content-Length", strconv.FormatInt(info.Size(), 10))
+
+			w.WriteStatusLine(response.StatusOk)
+			w.WriteHeaders(h)
+
+			w.WriteChunkedBody(file)
+			return nil
+		case "/compressed":
+			encodingHeader := req.Headers.Get("Accept-Encoding")
+			if len(encodingHeader) != 0 {
+				headerParts := strings.Split(encodingHeader, ", ")
+				gzipHeaderFound := slices.Contains(headerParts, "gzip")
+
+				if gzipHeaderFound {
+					h.Replace("Content-Type", "text/plain")
+					h.Set("Content-Encoding", "gzip")
+				}
+
+				buf := bytes.NewBuffer([]byte{})
+				zw := gzip.NewWriter(buf)
+				zw.Write(response.RespondOK())
+				zw.Flush()
+				zw.Close()
+
+				body = buf.Bytes()
+			}
+		}
+
+		h.Replace("Content-Length", strconv.Itoa(len(body)))
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+
+		return nil
+	})
+}
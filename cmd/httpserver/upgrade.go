@@ -0,0 +1,132 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"os"
+	"os/exec"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// During an upgrade the listening sockets are passed to the new process as
+// file descriptors starting at 3, in the order of the addresses listed in
+// envListenFDs. The new process reports that it is serving by writing to the
+// pipe in envReadyFD.
+const (
+	envListenFDs = "HTTPSERVER_LISTEN_FDS"
+	envReadyFD   = "HTTPSERVER_READY_FD"
+	readyMessage = "ready\n"
+	readyTimeout = 30 * time.Second
+)
+
+// inheritedListeners returns the listeners handed over by the process being
+// upgraded, by address.
+func inheritedListeners() (map[string]net.Listener, error) {
+	addrs := os.Getenv(envListenFDs)
+	os.Unsetenv(envListenFDs)
+	listeners := make(map[string]net.Listener)
+	if addrs == "" {
+		return listeners, nil
+	}
+
+	for i, addr := range strings.Split(addrs, ",") {
+		file := os.NewFile(uintptr(3+i), addr)
+		listener, err := net.FileListener(file)
+		file.Close()
+		if err != nil {
+			return nil, fmt.Errorf("inherited listener %s: %w", addr, err)
+		}
+		if unix, ok := listener.(*net.UnixListener); ok {
+			// Remove the socket file when this process stops serving it
+			unix.SetUnlinkOnClose(true)
+		}
+		listeners[addr] = listener
+	}
+
+	return listeners, nil
+}
+
+// notifyReady tells the process being upgraded that this one is serving.
+func notifyReady() error {
+	fd := os.Getenv(envReadyFD)
+	os.Unsetenv(envReadyFD)
+	if fd == "" {
+		return nil
+	}
+
+	n, err := strconv.Atoi(fd)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %w", envReadyFD, err)
+	}
+	pipe := os.NewFile(uintptr(n), "ready")
+	defer pipe.Close()
+	_, err = io.WriteString(pipe, readyMessage)
+
+	return err
+}
+
+// upgrade starts the current executable again with the listeners and waits
+// until it is serving. The listeners stay open here, so both processes
+// accept connections until this one is shut down.
+func upgrade(addrs []string, listeners []net.Listener) (*os.Process, error) {
+	var files []*os.File
+	defer func() {
+		for _, file := range files {
+			file.Close()
+		}
+	}()
+	for _, listener := range listeners {
+		filer, ok := listener.(interface{ File() (*os.File, error) })
+		if !ok {
+			return nil, fmt.Errorf("listener %s can't be handed over", listener.Addr())
+		}
+		file, err := filer.File()
+		if err != nil {
+			return nil, err
+		}
+		files = append(files, file)
+	}
+
+	ready, readyWriter, err := os.Pipe()
+	if err != nil {
+		return nil, err
+	}
+	defer ready.Close()
+
+	executable, err := os.Executable()
+	if err != nil {
+		readyWriter.Close()
+		return nil, err
+	}
+	cmd := exec.Command(executable, os.Args[1:]...)
+	cmd.Stdout, cmd.Stderr = os.Stdout, os.Stderr
+	cmd.ExtraFiles = append(files, readyWriter)
+	cmd.Env = append(os.Environ(),
+		envListenFDs+"="+strings.Join(addrs, ","),
+		fmt.Sprintf("%s=%d", envReadyFD, 3+len(files)),
+	)
+	err = cmd.Start()
+	readyWriter.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	// The read ends with EOF once the child closes the pipe, either after
+	// reporting it is ready or by exiting.
+	ready.SetReadDeadline(time.Now().Add(readyTimeout))
+	message, err := io.ReadAll(ready)
+	if err != nil || string(message) != readyMessage {
+		cmd.Process.Kill()
+		cmd.Wait()
+		if err == nil {
+			err = errors.New("new process exited before it was ready")
+		}
+		return nil, err
+	}
+
+	return cmd.Process, nil
+}
@@ -0,0 +1,85 @@
+package main
+
+import (
+	"net"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/client"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// TestMain runs the test binary as the new process when upgrade starts it
+// again.
+func TestMain(m *testing.M) {
+	if os.Getenv(envListenFDs) != "" {
+		serveUpgraded()
+		return
+	}
+
+	os.Exit(m.Run())
+}
+
+// serveUpgraded answers "new" on the inherited listeners until the test
+// kills it.
+func serveUpgraded() {
+	listeners, err := inheritedListeners()
+	if err != nil {
+		os.Exit(1)
+	}
+	for _, listener := range listeners {
+		server.ServeListener(listener, answer("new"))
+	}
+	if err := notifyReady(); err != nil {
+		os.Exit(1)
+	}
+
+	time.Sleep(readyTimeout)
+}
+
+func answer(body string) server.Handler {
+	return func(w response.Writer, req *request.Request) {
+		h := response.GetDefaultHeaders(len(body))
+		h.Replace("Connection", "close")
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte(body))
+	}
+}
+
+func TestUpgrade(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	addr := listener.Addr().String()
+	srv := server.ServeListener(listener, answer("old"))
+	c := client.New()
+
+	res, err := c.Get("http://" + addr + "/")
+	require.NoError(t, err)
+	assert.Equal(t, "old", res.Body)
+
+	// Test: The new process reports it is ready on the handed over listener
+	process, err := upgrade([]string{addr}, []net.Listener{listener})
+	require.NoError(t, err)
+	t.Cleanup(func() {
+		process.Kill()
+		process.Wait()
+	})
+
+	// Test: Once the old server stops, the new process takes every connection
+	srv.Close()
+	for range 5 {
+		res, err := c.Get("http://" + addr + "/")
+		require.NoError(t, err)
+		assert.Equal(t, "new", res.Body)
+	}
+
+	// Test: Closed listeners can't be handed over
+	_, err = upgrade([]string{addr}, []net.Listener{listener})
+	assert.Error(t, err)
+}
@@ -1,15 +1,80 @@
 package main
 
 import (
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"net"
+	"os"
+	"sync"
+	"time"
 
 	"github.com/rmdevio/httpserver/internal/headers"
 	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// Capture is one parsed request, as printed in JSON format and saved to the
+// capture file. Raw holds the exact bytes received and can be replayed.
+type Capture struct {
+	Time       time.Time         `json:"time"`
+	RemoteAddr string            `json:"remote_addr"`
+	Method     string            `json:"method"`
+	Target     string            `json:"target"`
+	Version    string            `json:"version"`
+	Headers    map[string]string `json:"headers"`
+	Body       string            `json:"body"`
+	Duration   string            `json:"duration"`
+	Raw        []byte            `json:"raw"`
+}
+
+type config struct {
+	addr   string
+	status response.StatusCode
+	format string
+}
+
+var (
+	outputMu sync.Mutex
+	capture  *json.Encoder
 )
 
 func main() {
-	listener, err := net.Listen("tcp", ":42069")
+	addr := flag.String("addr", ":42069", "address to listen on")
+	status := flag.Int("status", 200, "status code to respond with")
+	format := flag.String("format", "text", "output format: text, json or hex")
+	save := flag.String("save", "", "append captured requests as JSON lines to this file")
+	flag.Parse()
+
+	switch *format {
+	case "text", "json", "hex":
+	default:
+		log.Fatalf("unknown format %q", *format)
+	}
+	if *status < 100 || *status > 599 {
+		log.Fatalf("invalid status code %d", *status)
+	}
+
+	if *save != "" {
+		file, err := os.OpenFile(*save, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			log.Fatalf("error opening capture file: %s", err)
+		}
+		defer file.Close()
+		capture = json.NewEncoder(file)
+	}
+
+	cfg := config{
+		addr:   *addr,
+		status: response.StatusCode(*status),
+		format: *format,
+	}
+
+	listener, err := net.Listen("tcp", cfg.addr)
 	if err != nil {
 		panic(err)
 	}
@@ -22,17 +87,107 @@ func main() {
 			continue
 		}
 
-		fmt.Printf("Accepted new connection: %s\n", conn.RemoteAddr().String())
-		req, err := request.RequestFromReader(conn)
+		fmt.Fprintf(os.Stderr, "Accepted new connection: %s\n", conn.RemoteAddr().String())
+		go handle(conn, cfg)
+	}
+}
+
+func handle(conn net.Conn, cfg config) {
+	defer conn.Close()
+
+	recorder := &recordingReader{reader: conn}
+	reader := request.NewReader(recorder)
+	for {
+		recorder.start()
+		req, err := reader.ReadRequest()
 		if err != nil {
-			continue
+			if !errors.Is(err, io.EOF) {
+				fmt.Fprintf(os.Stderr, "error while parsing request: %s\n", err)
+			}
+			break
 		}
+		// Multipart bodies are streamed by the reader, but the whole request
+		// is captured here
+		if req.BodyStreamed() {
+			body, err := io.ReadAll(req.BodyReader())
+			if err != nil {
+				fmt.Fprintf(os.Stderr, "error while reading body: %s\n", err)
+				break
+			}
+			req.Body = string(body)
+		}
+		duration := time.Since(recorder.firstByte)
+		raw := recorder.take(reader.Buffered())
+
+		c := Capture{
+			Time:       recorder.firstByte,
+			RemoteAddr: conn.RemoteAddr().String(),
+			Method:     req.RequestLine.Method,
+			Target:     req.RequestLine.RequestTarget,
+			Version:    req.RequestLine.HttpVersion,
+			Headers:    map[string]string{},
+			Body:       req.Body,
+			Duration:   duration.String(),
+			Raw:        raw,
+		}
+		req.Headers.ForEach(func(name, value string) {
+			c.Headers[name] = value
+		})
+		PrintCapture(c, req, cfg.format)
+
+		closeConn := req.Headers.HasToken("Connection", "close")
+		if err := respond(conn, cfg.status, closeConn); err != nil || closeConn {
+			break
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Channel closed for connection: %s\n", conn.RemoteAddr().String())
+}
+
+func respond(conn net.Conn, status response.StatusCode, closeConn bool) error {
+	body := []byte(response.StatusText(status))
+	if status < 200 || status == response.StatusNoContent || status == response.StatusNotModified {
+		body = nil
+	}
+	h := response.GetDefaultHeaders(len(body))
+	h.Replace("Content-Type", "text/plain")
+	if closeConn {
+		h.Replace("Connection", "close")
+	}
 
+	w := response.NewWriter(conn)
+	if err := w.WriteStatusLine(status); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	_, err := w.WriteBody(body)
+
+	return err
+}
+
+func PrintCapture(c Capture, req *request.Request, format string) {
+	outputMu.Lock()
+	defer outputMu.Unlock()
+
+	switch format {
+	case "json":
+		json.NewEncoder(os.Stdout).Encode(c)
+	case "hex":
+		fmt.Printf("%s %s (%d bytes in %s)\n", c.Time.Format(time.RFC3339Nano), c.RemoteAddr, len(c.Raw), c.Duration)
+		fmt.Print(hex.Dump(c.Raw))
+	default:
+		fmt.Printf("%s %s in %s\n", c.Time.Format(time.RFC3339Nano), c.RemoteAddr, c.Duration)
 		PrintRequestLine(req.RequestLine)
 		PrintHeaders(req.Headers)
 		PrintBody(req.Body)
+	}
 
-		fmt.Printf("Channel closed for connection: %s\n", conn.RemoteAddr().String())
+	if capture != nil {
+		if err := capture.Encode(c); err != nil {
+			fmt.Fprintf(os.Stderr, "error while saving capture: %s\n", err)
+		}
 	}
 }
 
@@ -45,7 +200,7 @@ func PrintRequestLine(reqLine request.RequestLine) {
 
 func PrintHeaders(headers *headers.Headers) {
 	fmt.Println("Headers:")
-	headers.ForEach(func(name, value string) {
+	headers.ForEachLine(func(name, value string) {
 		fmt.Printf("- %s: %s\n", name, value)
 	})
 }
@@ -53,4 +208,54 @@ func PrintHeaders(headers *headers.Headers) {
 func PrintBody(body string) {
 	fmt.Println("Body:")
 	fmt.Println(body)
-}
\ No newline at end of file
+}
+
+// recordingReader keeps a copy of the bytes read from the connection so the
+// raw form of each request can be shown, and notes when the first byte of a
+// request arrived.
+type recordingReader struct {
+	reader    io.Reader
+	buf       []byte
+	firstByte time.Time
+	waiting   bool
+}
+
+func (r *recordingReader) Read(p []byte) (int, error) {
+	n, err := r.reader.Read(p)
+	if n > 0 {
+		if r.waiting {
+			r.firstByte = time.Now()
+			r.waiting = false
+		}
+		r.buf = append(r.buf, p[:n]...)
+	}
+
+	return n, err
+}
+
+// start marks the beginning of a new request. Bytes of a pipelined request
+// may already be buffered, in which case it starts now.
+func (r *recordingReader) start() {
+	r.waiting = len(r.buf) == 0
+	if !r.waiting {
+		r.firstByte = time.Now()
+	}
+}
+
+// take returns the raw bytes of the request just parsed, leaving the
+// buffered bytes that belong to the next one.
+func (r *recordingReader) take(buffered int) []byte {
+	n := len(r.buf) - buffered
+	raw := r.buf[:n:n]
+	r.buf = append([]byte(nil), r.buf[n:]...)
+
+	return raw
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Listens for HTTP/1.1 requests, prints each one and answers with -status.")
+		flag.PrintDefaults()
+	}
+}
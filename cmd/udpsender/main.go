@@ -2,36 +2,302 @@ package main
 
 import (
 	"bufio"
+	"bytes"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"net"
 	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/response"
 )
 
+type config struct {
+	network    string
+	addr       string
+	serverName string
+	insecure   bool
+	chunk      int
+	splits     []int
+	delay      time.Duration
+	timeout    time.Duration
+	repeat     int
+	pipeline   bool
+	raw        bool
+}
+
 func main() {
-	addr, err := net.ResolveUDPAddr("udp", "localhost:42069")
-	if err != nil {
-		panic(err)
+	var cfg config
+	flag.StringVar(&cfg.network, "network", "tcp", "transport: tcp, tls or unix")
+	flag.StringVar(&cfg.addr, "addr", "localhost:42069", "host:port, or socket path for unix")
+	flag.StringVar(&cfg.serverName, "servername", "", "TLS server name (defaults to the host in -addr)")
+	flag.BoolVar(&cfg.insecure, "insecure", false, "skip TLS certificate verification")
+	flag.IntVar(&cfg.chunk, "chunk", 0, "write requests in pieces of this many bytes")
+	splits := flag.String("split", "", "comma-separated byte offsets to split each request at, e.g. 5,20")
+	flag.DurationVar(&cfg.delay, "delay", 0, "pause between pieces of a request")
+	flag.DurationVar(&cfg.timeout, "timeout", 10*time.Second, "timeout for reading each response")
+	flag.IntVar(&cfg.repeat, "repeat", 1, "send the requests this many times")
+	flag.BoolVar(&cfg.pipeline, "pipeline", false, "send every request before reading any response")
+	flag.BoolVar(&cfg.raw, "raw", false, "print responses as received instead of parsed")
+	crlf := flag.Bool("crlf", false, "convert bare LF line endings in the input to CRLF")
+	captures := flag.String("captures", "", "replay the raw requests of a tcplistener -save file")
+	flag.Parse()
+
+	for _, s := range strings.Split(*splits, ",") {
+		if s == "" {
+			continue
+		}
+		offset, err := strconv.Atoi(strings.TrimSpace(s))
+		if err != nil || offset <= 0 {
+			log.Fatalf("invalid split offset %q", s)
+		}
+		cfg.splits = append(cfg.splits, offset)
 	}
 
-	udpConn, err := net.DialUDP("udp", nil, addr)
+	requests, err := loadRequests(flag.Args(), *captures)
 	if err != nil {
-		panic(err)
+		log.Fatalf("error while reading requests: %s", err)
+	}
+	if *crlf {
+		for i, req := range requests {
+			requests[i] = toCRLF(req)
+		}
+	}
+
+	var all [][]byte
+	for range cfg.repeat {
+		all = append(all, requests...)
 	}
-	defer udpConn.Close()
 
-	reader := bufio.NewReader(os.Stdin)
-	for {
-		fmt.Printf("> ")
-		str, err := reader.ReadString('\n')
+	if err := send(cfg, all); err != nil {
+		log.Fatalf("error: %s", err)
+	}
+}
+
+// loadRequests reads one raw request per file, stdin if there are no files,
+// plus every request saved in a tcplistener capture file.
+func loadRequests(files []string, captures string) ([][]byte, error) {
+	var requests [][]byte
+	for _, name := range files {
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, data)
+	}
+
+	if captures != "" {
+		file, err := os.Open(captures)
 		if err != nil {
-			fmt.Printf("error while reading input: %s\n", err)
-			return
+			return nil, err
 		}
+		defer file.Close()
+
+		decoder := json.NewDecoder(file)
+		for {
+			var capture struct {
+				Raw []byte `json:"raw"`
+			}
+			if err := decoder.Decode(&capture); err == io.EOF {
+				break
+			} else if err != nil {
+				return nil, err
+			}
+			requests = append(requests, capture.Raw)
+		}
+	}
+
+	if len(files) == 0 && captures == "" {
+		data, err := io.ReadAll(os.Stdin)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, data)
+	}
+
+	return requests, nil
+}
+
+func toCRLF(data []byte) []byte {
+	data = bytes.ReplaceAll(data, []byte("\r\n"), []byte("\n"))
+	return bytes.ReplaceAll(data, []byte("\n"), []byte("\r\n"))
+}
+
+func dial(cfg config) (net.Conn, error) {
+	switch cfg.network {
+	case "tcp":
+		return net.Dial("tcp", cfg.addr)
+	case "unix":
+		return net.Dial("unix", cfg.addr)
+	case "tls":
+		serverName := cfg.serverName
+		if serverName == "" {
+			serverName, _, _ = net.SplitHostPort(cfg.addr)
+		}
+		return tls.Dial("tcp", cfg.addr, &tls.Config{
+			ServerName:         serverName,
+			InsecureSkipVerify: cfg.insecure,
+		})
+	}
+
+	return nil, fmt.Errorf("unknown network %q", cfg.network)
+}
+
+func send(cfg config, requests [][]byte) error {
+	conn, err := dial(cfg)
+	if err != nil {
+		return err
+	}
+	defer func() { conn.Close() }()
+	reader := response.NewReader(conn)
+
+	if cfg.pipeline {
+		for _, req := range requests {
+			if err := write(conn, req, cfg); err != nil {
+				return err
+			}
+		}
+		for _, req := range requests {
+			if _, err := receive(conn, reader, req, cfg); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
 
-		_, err = udpConn.Write([]byte(str))
+	for i, req := range requests {
+		if err := write(conn, req, cfg); err != nil {
+			return err
+		}
+		closed, err := receive(conn, reader, req, cfg)
 		if err != nil {
-			fmt.Printf("error while writing to connection: %s\n", err)
-			return
+			return err
+		}
+
+		if closed && i < len(requests)-1 {
+			conn.Close()
+			if conn, err = dial(cfg); err != nil {
+				return err
+			}
+			reader = response.NewReader(conn)
 		}
 	}
+
+	return nil
+}
+
+// write sends a request in the pieces given by -split or -chunk, pausing for
+// -delay between them.
+func write(conn net.Conn, data []byte, cfg config) error {
+	for i, piece := range pieces(data, cfg) {
+		if i > 0 && cfg.delay > 0 {
+			time.Sleep(cfg.delay)
+		}
+		if _, err := conn.Write(piece); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func pieces(data []byte, cfg config) [][]byte {
+	var out [][]byte
+	start := 0
+	for _, offset := range cfg.splits {
+		if offset <= start || offset >= len(data) {
+			continue
+		}
+		out = append(out, data[start:offset])
+		start = offset
+	}
+
+	rest := data[start:]
+	if cfg.chunk <= 0 {
+		return append(out, rest)
+	}
+	for len(rest) > cfg.chunk {
+		out = append(out, rest[:cfg.chunk])
+		rest = rest[cfg.chunk:]
+	}
+
+	return append(out, rest)
+}
+
+// receive reads and prints the response to req and reports whether the
+// server closed the connection.
+func receive(conn net.Conn, reader *response.Reader, req []byte, cfg config) (bool, error) {
+	conn.SetReadDeadline(time.Now().Add(cfg.timeout))
+
+	if cfg.raw {
+		// Without parsing there is no way to know where a response ends, so
+		// print whatever arrives until the timeout or close.
+		_, err := io.Copy(os.Stdout, conn)
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			err = nil
+		}
+		return true, err
+	}
+
+	start := time.Now()
+	res, err := reader.ReadResponse(methodOf(req))
+	if err != nil {
+		return false, err
+	}
+
+	PrintResponse(res, time.Since(start))
+
+	return res.CloseDelimited() || res.Headers.HasToken("Connection", "close"), nil
+}
+
+// methodOf returns the method of a raw request, so responses to HEAD are
+// parsed without a body.
+func methodOf(req []byte) string {
+	line, _, _ := bufio.NewReader(bytes.NewReader(req)).ReadLine()
+	method, _, _ := strings.Cut(string(line), " ")
+	if method == "" {
+		return "GET"
+	}
+
+	return method
+}
+
+func PrintResponse(res *response.Response, duration time.Duration) {
+	for _, interim := range res.Interim {
+		fmt.Printf("HTTP/%s %d %s\n", interim.StatusLine.HttpVersion, interim.StatusLine.StatusCode, interim.StatusLine.ReasonPhrase)
+	}
+
+	fmt.Printf("HTTP/%s %d %s (%s)\n", res.StatusLine.HttpVersion, res.StatusLine.StatusCode, res.StatusLine.ReasonPhrase, duration)
+	fmt.Println("Headers:")
+	res.Headers.ForEachLine(func(name, value string) {
+		fmt.Printf("- %s: %s\n", name, value)
+	})
+	fmt.Println("Body:")
+	fmt.Println(res.Body)
+
+	trailers := false
+	res.Trailers.ForEach(func(name, value string) {
+		if !trailers {
+			fmt.Println("Trailers:")
+			trailers = true
+		}
+		fmt.Printf("- %s: %s\n", name, value)
+	})
+}
+
+func init() {
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [request-file ...]\n\n", os.Args[0])
+		fmt.Fprintln(flag.CommandLine.Output(), "Sends raw HTTP/1.1 requests from files, stdin or a tcplistener capture file")
+		fmt.Fprintln(flag.CommandLine.Output(), "and prints the parsed responses.")
+		flag.PrintDefaults()
+	}
 }
@@ -0,0 +1,70 @@
+package auth
+
+import (
+	"context"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// Principal is the authenticated client of a request.
+type Principal struct {
+	// Name identifies the client, such as the Basic username or the subject
+	// of a token.
+	Name string
+	// Scheme is the authentication scheme used, "Basic" or "Bearer".
+	Scheme string
+	// Claims holds whatever else a TokenValidator knows about the client.
+	Claims map[string]any
+}
+
+type principalKey struct{}
+
+// FromRequest returns the principal stored by the authentication
+// middleware, or nil if the request didn't go through it.
+func FromRequest(req *request.Request) *Principal {
+	p, _ := req.Context().Value(principalKey{}).(*Principal)
+	return p
+}
+
+func withPrincipal(req *request.Request, p *Principal) *request.Request {
+	return req.WithContext(context.WithValue(req.Context(), principalKey{}, p))
+}
+
+// credentials splits the Authorization header of req into its scheme and
+// credentials. ok is false if the header is missing or uses another scheme.
+func credentials(req *request.Request, scheme string) (credentials string, ok bool) {
+	header := strings.TrimSpace(req.Headers.Get("Authorization"))
+	name, credentials, _ := strings.Cut(header, " ")
+	if !strings.EqualFold(name, scheme) {
+		return "", false
+	}
+
+	return strings.TrimSpace(credentials), true
+}
+
+// challenge answers req with status and a WWW-Authenticate header asking for
+// scheme with the given parameters, as name and value pairs.
+func challenge(w response.Writer, req *request.Request, status response.StatusCode, detail, scheme string, params ...string) {
+	var b strings.Builder
+	b.WriteString(scheme)
+	for i := 0; i+1 < len(params); i += 2 {
+		if i == 0 {
+			b.WriteString(" ")
+		} else {
+			b.WriteString(", ")
+		}
+		b.WriteString(params[i])
+		b.WriteString("=")
+		b.WriteString(quote(params[i+1]))
+	}
+
+	w.Header().Replace("WWW-Authenticate", b.String())
+	w.WriteProblem(response.NewProblem(status, detail), req.Headers.Get("Accept"))
+}
+
+// quote returns s as an HTTP quoted-string.
+func quote(s string) string {
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(s) + `"`
+}
@@ -0,0 +1,135 @@
+package auth
+
+import (
+	"encoding/base64"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+	"github.com/rmdevio/httpserver/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs a request with the given Authorization header through mw and
+// returns the response and the principal the handler saw.
+func serve(t *testing.T, mw server.Middleware, authorization string) (*response.Response, *Principal) {
+	req := servertest.NewRequest("GET", "/admin", "")
+	if authorization != "" {
+		req.Headers.Set("Authorization", authorization)
+	}
+	var principal *Principal
+	res, err := servertest.Serve(mw(func(w response.Writer, req *request.Request) {
+		principal = FromRequest(req)
+		servertest.OK(w, req)
+	}), req)
+	require.NoError(t, err)
+	return res, principal
+}
+
+func basic(username, password string) string {
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(username+":"+password))
+}
+
+func TestBasic(t *testing.T) {
+	mw := Basic(`Admin "area"`, Credentials{"gopher": "s3cret:with colon"})
+
+	// Test: Valid credentials reach the handler with a principal
+	res, principal := serve(t, mw, basic("gopher", "s3cret:with colon"))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, &Principal{Name: "gopher", Scheme: "Basic"}, principal)
+
+	// Test: The scheme name is case-insensitive
+	res, _ = serve(t, mw, "bAsIc "+strings.TrimPrefix(basic("gopher", "s3cret:with colon"), "Basic "))
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+
+	// Test: Missing, wrong and malformed credentials get a challenge
+	for _, authorization := range []string{
+		"",
+		basic("gopher", "wrong"),
+		basic("nobody", ""),
+		"Basic not-base64!",
+		"Basic " + base64.StdEncoding.EncodeToString([]byte("no-colon")),
+		"Bearer token",
+	} {
+		res, principal = serve(t, mw, authorization)
+		assert.Equal(t, response.StatusUnauthorized, res.StatusLine.StatusCode, authorization)
+		assert.Equal(t, `Basic realm="Admin \"area\"", charset="UTF-8"`, res.Headers.Get("WWW-Authenticate"))
+		assert.Equal(t, "application/problem+json", res.Headers.Get("Content-Type"))
+		assert.Nil(t, principal)
+	}
+}
+
+func TestHtpasswd(t *testing.T) {
+	hash, err := HashPassword("hunter2", MinBcryptCost)
+	require.NoError(t, err)
+	path := filepath.Join(t.TempDir(), ".htpasswd")
+	contents := "# users\n\nalice:" + hash + "\nbob:$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga\n"
+	require.NoError(t, os.WriteFile(path, []byte(contents), 0o600))
+
+	// Test: bcrypt entries are verified
+	h, err := LoadHtpasswd(path)
+	require.NoError(t, err)
+	assert.True(t, h.Verify("alice", "hunter2"))
+	assert.True(t, h.Verify("bob", "allmine"))
+	assert.False(t, h.Verify("alice", "allmine"))
+	assert.False(t, h.Verify("carol", "hunter2"))
+
+	// Test: Other hash formats and malformed lines are rejected with their line
+	_, err = ParseHtpasswd(strings.NewReader("alice:" + hash + "\nbob:$apr1$abc$def\n"))
+	assert.ErrorContains(t, err, "line 2: unsupported hash")
+	_, err = ParseHtpasswd(strings.NewReader("alice\n"))
+	assert.ErrorContains(t, err, "line 1")
+	_, err = ParseHtpasswd(strings.NewReader("alice:$2b$10$short\n"))
+	assert.ErrorIs(t, err, ErrInvalidHash)
+
+	// Test: Missing files are reported
+	_, err = LoadHtpasswd(filepath.Join(t.TempDir(), "missing"))
+	assert.ErrorIs(t, err, os.ErrNotExist)
+}
+
+func TestBearer(t *testing.T) {
+	mw := Bearer("api", Tokens{"tok_abc.123": "ci"})
+
+	// Test: Valid tokens reach the handler with a principal
+	res, principal := serve(t, mw, "Bearer tok_abc.123")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, &Principal{Name: "ci", Scheme: "Bearer"}, principal)
+
+	// Test: Missing tokens get a challenge without an error
+	res, _ = serve(t, mw, "")
+	assert.Equal(t, response.StatusUnauthorized, res.StatusLine.StatusCode)
+	assert.Equal(t, `Bearer realm="api"`, res.Headers.Get("WWW-Authenticate"))
+
+	// Test: Unknown tokens are invalid
+	res, principal = serve(t, mw, "Bearer tok_xyz")
+	assert.Equal(t, response.StatusUnauthorized, res.StatusLine.StatusCode)
+	assert.Equal(t, `Bearer realm="api", error="invalid_token"`, res.Headers.Get("WWW-Authenticate"))
+	assert.Nil(t, principal)
+
+	// Test: Malformed tokens are bad requests
+	for _, authorization := range []string{"Bearer", "Bearer a b", "Bearer a=b"} {
+		res, _ = serve(t, mw, authorization)
+		assert.Equal(t, response.StatusBadRequest, res.StatusLine.StatusCode, authorization)
+		assert.Equal(t, `Bearer realm="api", error="invalid_request"`, res.Headers.Get("WWW-Authenticate"))
+	}
+
+	// Test: Custom validators can attach claims
+	shared := &Principal{Name: "svc", Claims: map[string]any{"scope": "read"}}
+	mw = Bearer("api", TokenValidatorFunc(func(token string) (*Principal, error) {
+		if token != "opaque==" {
+			return nil, errors.New("unknown token")
+		}
+		return shared, nil
+	}))
+	res, principal = serve(t, mw, "Bearer opaque==")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "read", principal.Claims["scope"])
+	assert.Equal(t, "Bearer", principal.Scheme)
+	assert.Empty(t, shared.Scheme)
+}
@@ -0,0 +1,66 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+)
+
+// CredentialProvider checks the username and password of Basic
+// authentication. Implementations must be safe for concurrent use and should
+// take the same time whether or not the user exists.
+type CredentialProvider interface {
+	Verify(username, password string) bool
+}
+
+// Credentials is a CredentialProvider holding plain text passwords by
+// username, for tests and small deployments. Use an Htpasswd file to keep
+// passwords hashed.
+type Credentials map[string]string
+
+func (c Credentials) Verify(username, password string) bool {
+	expected, ok := c[username]
+	// Digests have the same length whatever the passwords, so comparing them
+	// doesn't reveal the length of the expected one
+	want := sha256.Sum256([]byte(expected))
+	got := sha256.Sum256([]byte(password))
+
+	return subtle.ConstantTimeCompare(want[:], got[:]) == 1 && ok
+}
+
+// Basic returns middleware requiring Basic authentication (RFC 7617) against
+// provider. Requests without valid credentials are answered with 401 and a
+// challenge for realm; others continue with a Principal named after the
+// user.
+func Basic(realm string, provider CredentialProvider) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w response.Writer, req *request.Request) {
+			username, password, ok := basicCredentials(req)
+			if !ok || !provider.Verify(username, password) {
+				challenge(w, req, response.StatusUnauthorized, "valid credentials are required",
+					"Basic", "realm", realm, "charset", "UTF-8")
+				return
+			}
+
+			next(w, withPrincipal(req, &Principal{Name: username, Scheme: "Basic"}))
+		}
+	}
+}
+
+func basicCredentials(req *request.Request) (username, password string, ok bool) {
+	encoded, ok := credentials(req, "Basic")
+	if !ok {
+		return "", "", false
+	}
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", "", false
+	}
+
+	return strings.Cut(string(decoded), ":")
+}
@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+var (
+	ErrMismatchedPassword = errors.New("auth: password doesn't match the hash")
+	ErrInvalidHash        = errors.New("auth: invalid bcrypt hash")
+	ErrPasswordTooLong    = errors.New("auth: bcrypt passwords are limited to 72 bytes")
+)
+
+const (
+	MinBcryptCost     = bcrypt.MinCost
+	MaxBcryptCost     = bcrypt.MaxCost
+	DefaultBcryptCost = bcrypt.DefaultCost
+)
+
+// HashPassword returns the bcrypt hash of password, as written in htpasswd
+// files by "htpasswd -B", with the given cost.
+func HashPassword(password string, cost int) (string, error) {
+	if cost < MinBcryptCost || cost > MaxBcryptCost {
+		return "", fmt.Errorf("auth: bcrypt cost %d out of range [%d, %d]", cost, MinBcryptCost, MaxBcryptCost)
+	}
+
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), cost)
+	if errors.Is(err, bcrypt.ErrPasswordTooLong) {
+		return "", ErrPasswordTooLong
+	}
+
+	return string(hash), err
+}
+
+// ComparePassword checks password against a bcrypt hash with a $2a$, $2b$
+// or $2y$ prefix, returning ErrMismatchedPassword if it doesn't match.
+func ComparePassword(hash, password string) error {
+	if err := validateHash(hash); err != nil {
+		return err
+	}
+
+	err := bcrypt.CompareHashAndPassword([]byte(hash), []byte(password))
+	switch {
+	case errors.Is(err, bcrypt.ErrMismatchedHashAndPassword):
+		return ErrMismatchedPassword
+	case err != nil:
+		return ErrInvalidHash
+	}
+
+	return nil
+}
+
+// validateHash checks the format of a hash without running bcrypt, so
+// htpasswd files are validated quickly when loaded.
+func validateHash(hash string) error {
+	if !strings.HasPrefix(hash, "$2a$") && !strings.HasPrefix(hash, "$2b$") && !strings.HasPrefix(hash, "$2y$") {
+		return ErrInvalidHash
+	}
+	if _, err := bcrypt.Cost([]byte(hash)); err != nil {
+		return ErrInvalidHash
+	}
+	// Cost doesn't check the length of the salt and checksum
+	if len(hash) != 60 {
+		return ErrInvalidHash
+	}
+
+	return nil
+}
@@ -0,0 +1,47 @@
+package auth
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestBcrypt(t *testing.T) {
+	// Test: Known hashes from other implementations are accepted
+	for _, tc := range []struct{ password, hash string }{
+		{"allmine", "$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"},
+		{"U*U", "$2a$05$CCCCCCCCCCCCCCCCCCCCC.E5YPO9kmyuRGyh0XouQYb4YMJKvyOeW"},
+		{"", "$2a$06$DCq7YPn5Rq63x1Lad4cll.TV4S6ytwfsfvkgY8jIucDrjc8deX1s."},
+	} {
+		assert.NoError(t, ComparePassword(tc.hash, tc.password), tc.password)
+		assert.ErrorIs(t, ComparePassword(tc.hash, tc.password+"x"), ErrMismatchedPassword, tc.password)
+	}
+
+	// Test: Hashes round-trip with a random salt
+	hash, err := HashPassword("correct horse", MinBcryptCost)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(hash, "$2a$04$"))
+	assert.Len(t, hash, 60)
+	assert.NoError(t, ComparePassword(hash, "correct horse"))
+	assert.ErrorIs(t, ComparePassword(hash, "battery staple"), ErrMismatchedPassword)
+	other, err := HashPassword("correct horse", MinBcryptCost)
+	require.NoError(t, err)
+	assert.NotEqual(t, hash, other)
+
+	// Test: Invalid costs, long passwords and malformed hashes are rejected
+	_, err = HashPassword("password", 3)
+	assert.Error(t, err)
+	_, err = HashPassword(strings.Repeat("a", 73), MinBcryptCost)
+	assert.ErrorIs(t, err, ErrPasswordTooLong)
+	for _, hash := range []string{
+		"",
+		"$2x$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga",
+		"$2a$99$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga",
+		"$2a$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcg",
+		"$apr1$salt$hash",
+	} {
+		assert.ErrorIs(t, ComparePassword(hash, "allmine"), ErrInvalidHash, hash)
+	}
+}
@@ -0,0 +1,108 @@
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"errors"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+)
+
+var ErrInvalidToken = errors.New("auth: invalid token")
+
+// TokenValidator checks bearer tokens, returning the principal a token
+// stands for or an error if it isn't valid. Implementations must be safe for
+// concurrent use.
+type TokenValidator interface {
+	Validate(token string) (*Principal, error)
+}
+
+// TokenValidatorFunc adapts a function to a TokenValidator.
+type TokenValidatorFunc func(token string) (*Principal, error)
+
+func (f TokenValidatorFunc) Validate(token string) (*Principal, error) {
+	return f(token)
+}
+
+// Tokens is a TokenValidator for static API tokens, mapping each token to
+// the name of its principal.
+type Tokens map[string]string
+
+func (t Tokens) Validate(token string) (*Principal, error) {
+	got := sha256.Sum256([]byte(token))
+	name, found := "", false
+	// Every token is compared so the time taken doesn't depend on which one
+	// matched
+	for candidate, owner := range t {
+		want := sha256.Sum256([]byte(candidate))
+		if subtle.ConstantTimeCompare(want[:], got[:]) == 1 {
+			name, found = owner, true
+		}
+	}
+	if !found {
+		return nil, ErrInvalidToken
+	}
+
+	return &Principal{Name: name}, nil
+}
+
+// Bearer returns middleware requiring a bearer token (RFC 6750) accepted by
+// validator. Requests without a token are answered with 401 and a challenge
+// for realm, malformed ones with 400 and rejected tokens with 401 and an
+// invalid_token error.
+func Bearer(realm string, validator TokenValidator) server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w response.Writer, req *request.Request) {
+			token, ok := credentials(req, "Bearer")
+			if !ok {
+				challenge(w, req, response.StatusUnauthorized, "a bearer token is required",
+					"Bearer", "realm", realm)
+				return
+			}
+			if !isToken68(token) {
+				challenge(w, req, response.StatusBadRequest, "malformed bearer token",
+					"Bearer", "realm", realm, "error", "invalid_request")
+				return
+			}
+
+			p, err := validator.Validate(token)
+			if err != nil || p == nil {
+				challenge(w, req, response.StatusUnauthorized, "invalid bearer token",
+					"Bearer", "realm", realm, "error", "invalid_token")
+				return
+			}
+			// Validators may return shared principals, which are not modified
+			principal := *p
+			if principal.Scheme == "" {
+				principal.Scheme = "Bearer"
+			}
+
+			next(w, withPrincipal(req, &principal))
+		}
+	}
+}
+
+// isToken68 reports whether s matches the b64token syntax of RFC 6750:
+// letters, digits and "-._~+/" followed by optional "=" padding.
+func isToken68(s string) bool {
+	i := 0
+	for ; i < len(s); i++ {
+		ch := s[i]
+		if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' ||
+			ch == '-' || ch == '.' || ch == '_' || ch == '~' || ch == '+' || ch == '/') {
+			break
+		}
+	}
+	if i == 0 {
+		return false
+	}
+	for ; i < len(s); i++ {
+		if s[i] != '=' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,76 @@
+package auth
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// dummyHash is compared against for unknown users, so they take as long to
+// reject as wrong passwords.
+const dummyHash = "$2b$10$XajjQvNhvvRt5GSeFk1xFeyqRrsxkhBkUiQeg0dt.wU1qD4aFDcga"
+
+// Htpasswd is a CredentialProvider reading users from an htpasswd file with
+// bcrypt hashes, as created by "htpasswd -B". Other hash formats are
+// rejected, being too weak.
+type Htpasswd struct {
+	hashes map[string]string
+}
+
+// LoadHtpasswd reads the htpasswd file at path.
+func LoadHtpasswd(path string) (*Htpasswd, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	h, err := ParseHtpasswd(f)
+	if err != nil {
+		return nil, fmt.Errorf("%s: %w", path, err)
+	}
+
+	return h, nil
+}
+
+// ParseHtpasswd reads "user:hash" lines from r. Blank lines and lines
+// starting with "#" are ignored.
+func ParseHtpasswd(r io.Reader) (*Htpasswd, error) {
+	h := &Htpasswd{hashes: make(map[string]string)}
+	scanner := bufio.NewScanner(r)
+	for n := 1; scanner.Scan(); n++ {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		user, hash, ok := strings.Cut(line, ":")
+		if !ok || user == "" {
+			return nil, fmt.Errorf("line %d: expected user:hash", n)
+		}
+		if !strings.HasPrefix(hash, "$2") {
+			return nil, fmt.Errorf("line %d: unsupported hash for %q, only bcrypt is accepted", n, user)
+		}
+		if err := validateHash(hash); err != nil {
+			return nil, fmt.Errorf("line %d: %w", n, err)
+		}
+		h.hashes[user] = hash
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	return h, nil
+}
+
+func (h *Htpasswd) Verify(username, password string) bool {
+	hash, ok := h.hashes[username]
+	if !ok {
+		ComparePassword(dummyHash, password)
+		return false
+	}
+
+	return ComparePassword(hash, password) == nil
+}
@@ -0,0 +1,351 @@
+package client
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/tracing"
+)
+
+var (
+	ErrUnsupportedScheme = errors.New("unsupported url scheme")
+	ErrTooManyRedirects  = errors.New("too many redirects")
+)
+
+const (
+	defaultMaxRedirects        = 10
+	defaultMaxIdleConnsPerHost = 2
+	defaultIdleConnTimeout     = 90 * time.Second
+	defaultDialTimeout         = 30 * time.Second
+)
+
+// Client sends HTTP/1.1 requests, reusing connections per host.
+type Client struct {
+	timeout             time.Duration
+	dialTimeout         time.Duration
+	maxRedirects        int
+	maxIdleConnsPerHost int
+	idleConnTimeout     time.Duration
+	tlsConfig           *tls.Config
+
+	pool *pool
+}
+
+// Option configures a Client created with New.
+type Option func(c *Client)
+
+// WithTimeout bounds the time Do spends on a request, from connecting to
+// reading the last response body, across every redirect it follows. Zero
+// means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.timeout = timeout
+	}
+}
+
+// WithDialTimeout bounds the time spent establishing a connection.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.dialTimeout = timeout
+	}
+}
+
+// WithMaxRedirects sets how many redirects are followed. Zero disables
+// redirect handling and returns 3xx responses as they are.
+func WithMaxRedirects(n int) Option {
+	return func(c *Client) {
+		c.maxRedirects = n
+	}
+}
+
+// WithMaxIdleConnsPerHost sets how many idle keep-alive connections are kept
+// per host.
+func WithMaxIdleConnsPerHost(n int) Option {
+	return func(c *Client) {
+		c.maxIdleConnsPerHost = n
+	}
+}
+
+// WithIdleConnTimeout sets how long an idle connection is kept before it is
+// closed.
+func WithIdleConnTimeout(timeout time.Duration) Option {
+	return func(c *Client) {
+		c.idleConnTimeout = timeout
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for https URLs.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(c *Client) {
+		c.tlsConfig = config
+	}
+}
+
+func New(opts ...Option) *Client {
+	c := &Client{
+		dialTimeout:         defaultDialTimeout,
+		maxRedirects:        defaultMaxRedirects,
+		maxIdleConnsPerHost: defaultMaxIdleConnsPerHost,
+		idleConnTimeout:     defaultIdleConnTimeout,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+	c.pool = newPool(c.maxIdleConnsPerHost, c.idleConnTimeout)
+
+	return c
+}
+
+// NewRequest returns a request for an absolute http or https URL.
+func NewRequest(method, rawURL, body string) (*request.Request, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return nil, fmt.Errorf("%w: %q", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	return request.New(method, u.String(), body), nil
+}
+
+func (c *Client) Get(rawURL string) (*response.Response, error) {
+	req, err := NewRequest("GET", rawURL, "")
+	if err != nil {
+		return nil, err
+	}
+
+	return c.Do(req)
+}
+
+func (c *Client) Post(rawURL, contentType, body string) (*response.Response, error) {
+	req, err := NewRequest("POST", rawURL, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Headers.Replace("Content-Type", contentType)
+
+	return c.Do(req)
+}
+
+// Do sends req, whose request target must be an absolute URL, and returns the
+// final response after following redirects. If the context of req comes
+// from a request handled behind the server's Trace middleware, its request
+// ID and trace context are sent along.
+func (c *Client) Do(req *request.Request) (*response.Response, error) {
+	u, err := url.Parse(req.RequestLine.RequestTarget)
+	if err != nil {
+		return nil, err
+	}
+	tracing.Inject(req.Context(), req.Headers)
+
+	var deadline time.Time
+	if c.timeout > 0 {
+		deadline = time.Now().Add(c.timeout)
+	}
+	for redirects := 0; ; redirects++ {
+		res, err := c.roundTrip(req, u, deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		location := res.Headers.Get("Location")
+		if c.maxRedirects == 0 || !isRedirect(res.StatusLine.StatusCode) || location == "" {
+			return res, nil
+		}
+		if redirects >= c.maxRedirects {
+			return nil, ErrTooManyRedirects
+		}
+
+		next, err := u.Parse(location)
+		if err != nil {
+			return nil, err
+		}
+		req = redirectRequest(req, res.StatusLine.StatusCode, next, u)
+		u = next
+	}
+}
+
+func isRedirect(code response.StatusCode) bool {
+	switch code {
+	case response.StatusMovedPermanently, response.StatusFound, response.StatusSeeOther,
+		response.StatusTemporaryRedirect, response.StatusPermanentRedirect:
+		return true
+	}
+
+	return false
+}
+
+// redirectRequest builds the request that follows a redirect. 307 and 308
+// keep the method and body; the others switch to GET without a body, as
+// browsers do.
+func redirectRequest(prev *request.Request, code response.StatusCode, next, prevURL *url.URL) *request.Request {
+	method, body := prev.RequestLine.Method, prev.Body
+	if code != response.StatusTemporaryRedirect && code != response.StatusPermanentRedirect && method != "HEAD" {
+		method, body = "GET", ""
+	}
+
+	req := request.New(method, next.String(), body)
+	prev.Headers.ForEach(func(name, value string) {
+		switch name {
+		case "host", "content-length":
+			return
+		case "content-type":
+			if body == "" {
+				return
+			}
+		case "authorization", "cookie":
+			// Credentials are not forwarded to another host, nor sent in
+			// the clear after a downgrade from https
+			if next.Host != prevURL.Host || (prevURL.Scheme == "https" && next.Scheme != "https") {
+				return
+			}
+		}
+		req.Headers.Replace(name, value)
+	})
+
+	return req.WithContext(prev.Context())
+}
+
+// roundTrip sends one request and reads its response before deadline,
+// retrying once on a fresh connection if a reused one turned out to be
+// closed by the server.
+func (c *Client) roundTrip(req *request.Request, u *url.URL, deadline time.Time) (*response.Response, error) {
+	key, err := hostKey(u)
+	if err != nil {
+		return nil, err
+	}
+
+	for attempt := 0; ; attempt++ {
+		pc, reused, err := c.getConn(key, u, deadline)
+		if err != nil {
+			return nil, err
+		}
+
+		res, err := c.exchange(pc, req, u, deadline)
+		if err != nil {
+			pc.Close()
+			if reused && attempt == 0 && isIdempotent(req.RequestLine.Method) && isStaleConnError(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		if res.CloseDelimited() || res.Headers.HasToken("Connection", "close") {
+			pc.Close()
+		} else {
+			c.pool.put(key, pc)
+		}
+
+		return res, nil
+	}
+}
+
+func (c *Client) exchange(pc *conn, req *request.Request, u *url.URL, deadline time.Time) (*response.Response, error) {
+	pc.SetDeadline(deadline)
+
+	wire := request.New(req.RequestLine.Method, requestURI(u), req.Body)
+	req.Headers.ForEach(func(name, value string) {
+		wire.Headers.Replace(name, value)
+	})
+	if req.Body != "" {
+		wire.Headers.Replace("Content-Length", strconv.Itoa(len(req.Body)))
+	}
+	wire.Headers.Replace("Host", u.Host)
+
+	if _, err := wire.WriteTo(pc); err != nil {
+		return nil, err
+	}
+
+	return pc.reader.ReadResponse(req.RequestLine.Method)
+}
+
+func (c *Client) getConn(key string, u *url.URL, deadline time.Time) (*conn, bool, error) {
+	if pc := c.pool.get(key); pc != nil {
+		return pc, true, nil
+	}
+
+	dialer := &net.Dialer{Timeout: c.dialTimeout, Deadline: deadline}
+	var (
+		netConn net.Conn
+		err     error
+	)
+	if u.Scheme == "https" {
+		config := c.tlsConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName = u.Hostname()
+		}
+		netConn, err = tls.DialWithDialer(dialer, "tcp", key[len("https://"):], config)
+	} else {
+		netConn, err = dialer.Dial("tcp", key[len("http://"):])
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return newConn(netConn), false, nil
+}
+
+// hostKey identifies the pool a connection to u belongs to.
+func hostKey(u *url.URL) (string, error) {
+	port := u.Port()
+	switch u.Scheme {
+	case "http":
+		if port == "" {
+			port = "80"
+		}
+	case "https":
+		if port == "" {
+			port = "443"
+		}
+	default:
+		return "", fmt.Errorf("%w: %q", ErrUnsupportedScheme, u.Scheme)
+	}
+
+	return u.Scheme + "://" + net.JoinHostPort(u.Hostname(), port), nil
+}
+
+func requestURI(u *url.URL) string {
+	uri := u.EscapedPath()
+	if uri == "" {
+		uri = "/"
+	}
+	if u.RawQuery != "" {
+		uri += "?" + u.RawQuery
+	}
+
+	return uri
+}
+
+func isIdempotent(method string) bool {
+	switch strings.ToUpper(method) {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+
+	return false
+}
+
+func isStaleConnError(err error) bool {
+	return errors.Is(err, io.EOF) || errors.Is(err, io.ErrUnexpectedEOF) ||
+		errors.Is(err, syscall.ECONNRESET) || errors.Is(err, syscall.EPIPE)
+}
+
+// CloseIdleConnections closes every idle keep-alive connection.
+func (c *Client) CloseIdleConnections() {
+	c.pool.closeIdle()
+}
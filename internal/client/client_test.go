@@ -0,0 +1,161 @@
+package client
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"net/url"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+	"github.com/rmdevio/httpserver/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func testHandler(w response.Writer, req *request.Request) {
+	switch req.RequestLine.RequestTarget {
+	case "/chunked":
+		h := response.GetDefaultHeaders(0)
+		h.Remove("Content-Length")
+		h.Replace("Transfer-Encoding", "chunked")
+		h.Replace("Trailer", "X-Checksum")
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		w.WriteBody([]byte("5\r\nhello\r\n6\r\n world\r\n0\r\n"))
+		trailers := response.GetDefaultHeaders(0)
+		trailers.Remove("Content-Length")
+		trailers.Remove("Content-Type")
+		trailers.Replace("X-Checksum", "abc")
+		w.WriteHeaders(trailers)
+	case "/redirect", "/redirect-trace":
+		location := "/echo"
+		if req.RequestLine.RequestTarget == "/redirect-trace" {
+			location = "/trace"
+		}
+		h := response.GetDefaultHeaders(0)
+		h.Replace("Location", location)
+		w.WriteStatusLine(response.StatusSeeOther)
+		w.WriteHeaders(h)
+	case "/slow-redirect":
+		time.Sleep(150 * time.Millisecond)
+		h := response.GetDefaultHeaders(0)
+		h.Replace("Location", "/slow-redirect")
+		w.WriteStatusLine(response.StatusFound)
+		w.WriteHeaders(h)
+	case "/trace":
+		body := []byte(req.Headers.Get("X-Request-ID") + " " + req.Headers.Get("traceparent"))
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	default:
+		body := []byte(fmt.Sprintf("%s %s %s", req.RequestLine.Method, req.RequestLine.RequestTarget, req.Body))
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+}
+
+func TestClient(t *testing.T) {
+	srv, err := server.Serve(0, testHandler, server.WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+	defer srv.Close()
+	base := "http://" + srv.Addr().String()
+
+	c := New()
+	defer c.CloseIdleConnections()
+
+	// Test: Content-Length body
+	res, err := c.Post(base+"/echo?x=1", "text/plain", "ping")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "POST /echo?x=1 ping", res.Body)
+
+	// Test: Connection is kept alive and reused
+	res, err = c.Get(base + "/again")
+	require.NoError(t, err)
+	assert.Equal(t, "GET /again ", res.Body)
+	assert.Len(t, c.pool.idle, 1)
+	for _, conns := range c.pool.idle {
+		assert.Len(t, conns, 1)
+	}
+
+	// Test: Chunked body with trailers
+	res, err = c.Get(base + "/chunked")
+	require.NoError(t, err)
+	assert.Equal(t, "hello world", res.Body)
+	assert.Equal(t, "abc", res.Trailers.Get("X-Checksum"))
+
+	// Test: Redirects are followed
+	res, err = c.Post(base+"/redirect", "text/plain", "dropped")
+	require.NoError(t, err)
+	assert.Equal(t, "GET /echo ", res.Body)
+
+	// Test: Redirects are returned when disabled
+	res, err = New(WithMaxRedirects(0)).Get(base + "/redirect")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusSeeOther, res.StatusLine.StatusCode)
+
+	// Test: The request ID and trace context of the request context are sent,
+	// including after redirects
+	info := tracing.Info{
+		RequestID: "req-1",
+		Span:      tracing.SpanContext{TraceID: tracing.NewTraceID(), SpanID: tracing.NewSpanID()},
+	}
+	ctx := tracing.NewContext(context.Background(), info)
+	for _, target := range []string{"/trace", "/redirect-trace"} {
+		req, err := NewRequest("GET", base+target, "")
+		require.NoError(t, err)
+		res, err = c.Do(req.WithContext(ctx))
+		require.NoError(t, err)
+		assert.Equal(t, "req-1 "+info.Span.Traceparent(), res.Body)
+	}
+
+	// Test: The timeout bounds the whole redirect chain, not each request
+	start := time.Now()
+	_, err = New(WithTimeout(400 * time.Millisecond)).Get(base + "/slow-redirect")
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+	assert.Less(t, time.Since(start), time.Second)
+
+	// Test: Unsupported scheme
+	_, err = c.Get("ftp://example.com/")
+	assert.ErrorIs(t, err, ErrUnsupportedScheme)
+}
+
+func TestRedirectCredentials(t *testing.T) {
+	prev, err := NewRequest("GET", "https://example.com/login", "")
+	require.NoError(t, err)
+	prev.Headers.Replace("Authorization", "Bearer secret")
+	prev.Headers.Replace("Cookie", "session=abc")
+	prev.Headers.Replace("Accept", "text/html")
+	redirect := func(from, to string) *request.Request {
+		fromURL, err := url.Parse(from)
+		require.NoError(t, err)
+		toURL, err := url.Parse(to)
+		require.NoError(t, err)
+		return redirectRequest(prev, response.StatusFound, toURL, fromURL)
+	}
+
+	// Test: Credentials follow redirects on the same host and scheme
+	req := redirect("https://example.com/login", "https://example.com/home")
+	assert.Equal(t, "Bearer secret", req.Headers.Get("Authorization"))
+	assert.Equal(t, "session=abc", req.Headers.Get("Cookie"))
+
+	// Test: Credentials are dropped for another host
+	req = redirect("https://example.com/login", "https://other.example/home")
+	assert.Empty(t, req.Headers.Get("Authorization"))
+	assert.Empty(t, req.Headers.Get("Cookie"))
+
+	// Test: Credentials are dropped on a downgrade from https to http, even
+	// on the same host
+	req = redirect("https://example.com/login", "http://example.com/home")
+	assert.Empty(t, req.Headers.Get("Authorization"))
+	assert.Empty(t, req.Headers.Get("Cookie"))
+	assert.Equal(t, "text/html", req.Headers.Get("Accept"))
+}
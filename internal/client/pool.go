@@ -0,0 +1,91 @@
+package client
+
+import (
+	"net"
+	"sync"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// conn is a client connection together with the response reader that keeps
+// any bytes buffered between responses.
+type conn struct {
+	net.Conn
+	reader   *response.Reader
+	idleFrom time.Time
+}
+
+func newConn(netConn net.Conn) *conn {
+	return &conn{
+		Conn:   netConn,
+		reader: response.NewReader(netConn),
+	}
+}
+
+// pool keeps idle keep-alive connections per scheme and host.
+type pool struct {
+	maxIdlePerHost int
+	idleTimeout    time.Duration
+
+	mu   sync.Mutex
+	idle map[string][]*conn
+}
+
+func newPool(maxIdlePerHost int, idleTimeout time.Duration) *pool {
+	return &pool{
+		maxIdlePerHost: maxIdlePerHost,
+		idleTimeout:    idleTimeout,
+		idle:           make(map[string][]*conn),
+	}
+}
+
+// get returns the most recently used idle connection for key, closing any
+// that have been idle for too long.
+func (p *pool) get(key string) *conn {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	conns := p.idle[key]
+	for len(conns) > 0 {
+		pc := conns[len(conns)-1]
+		conns = conns[:len(conns)-1]
+		p.idle[key] = conns
+
+		if p.idleTimeout > 0 && time.Since(pc.idleFrom) > p.idleTimeout {
+			pc.Close()
+			continue
+		}
+
+		return pc
+	}
+	delete(p.idle, key)
+
+	return nil
+}
+
+func (p *pool) put(key string, pc *conn) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	if len(p.idle[key]) >= p.maxIdlePerHost {
+		pc.Close()
+		return
+	}
+
+	pc.idleFrom = time.Now()
+	p.idle[key] = append(p.idle[key], pc)
+}
+
+// closeIdle closes every idle connection.
+func (p *pool) closeIdle() {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	for key, conns := range p.idle {
+		for _, pc := range conns {
+			pc.Close()
+		}
+		delete(p.idle, key)
+	}
+}
@@ -0,0 +1,204 @@
+package cookie
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var (
+	ErrInvalidName   = errors.New("cookie: invalid name")
+	ErrInvalidValue  = errors.New("cookie: invalid value")
+	ErrInvalidDomain = errors.New("cookie: invalid domain")
+	ErrInvalidPath   = errors.New("cookie: invalid path")
+	ErrNotSecure     = errors.New("cookie: SameSite=None and Partitioned require Secure")
+)
+
+const expiresLayout = "Mon, 02 Jan 2006 15:04:05 GMT"
+
+type SameSite int
+
+const (
+	// SameSiteDefault omits the attribute, leaving the choice to the
+	// browser.
+	SameSiteDefault SameSite = iota
+	SameSiteLax
+	SameSiteStrict
+	SameSiteNone
+)
+
+// Cookie is a cookie received in a Cookie header, where only Name and Value
+// are set, or sent with Set-Cookie.
+type Cookie struct {
+	Name  string
+	Value string
+
+	// Expires is omitted when zero.
+	Expires time.Time
+	// MaxAge is the lifetime in seconds. Zero omits the attribute and a
+	// negative value deletes the cookie right away.
+	MaxAge      int
+	Domain      string
+	Path        string
+	Secure      bool
+	HttpOnly    bool
+	SameSite    SameSite
+	Partitioned bool
+}
+
+// Parse returns the cookies of a Cookie header. Malformed pairs are skipped,
+// as browsers may send cookies set by other servers of the same site.
+func Parse(header string) []*Cookie {
+	var cookies []*Cookie
+	for _, pair := range strings.Split(header, ";") {
+		name, value, ok := strings.Cut(strings.TrimSpace(pair), "=")
+		if !ok || !validName(name) || !validValue(value) {
+			continue
+		}
+		cookies = append(cookies, &Cookie{Name: name, Value: unquote(value)})
+	}
+
+	return cookies
+}
+
+// Validate reports whether the cookie can be sent in a Set-Cookie header
+// according to RFC 6265 and the SameSite and Partitioned drafts.
+func (c *Cookie) Validate() error {
+	if !validName(c.Name) {
+		return fmt.Errorf("%w %q", ErrInvalidName, c.Name)
+	}
+	if !validValue(c.Value) {
+		return fmt.Errorf("%w for %q", ErrInvalidValue, c.Name)
+	}
+	if c.Domain != "" && !validDomain(c.Domain) {
+		return fmt.Errorf("%w %q", ErrInvalidDomain, c.Domain)
+	}
+	if !validPath(c.Path) {
+		return fmt.Errorf("%w %q", ErrInvalidPath, c.Path)
+	}
+	if (c.SameSite == SameSiteNone || c.Partitioned) && !c.Secure {
+		return ErrNotSecure
+	}
+
+	return nil
+}
+
+// String returns the cookie as a Set-Cookie header value. It doesn't
+// validate the cookie; use Validate first.
+func (c *Cookie) String() string {
+	var b strings.Builder
+	b.WriteString(c.Name)
+	b.WriteByte('=')
+	b.WriteString(c.Value)
+
+	if !c.Expires.IsZero() {
+		b.WriteString("; Expires=")
+		b.WriteString(c.Expires.UTC().Format(expiresLayout))
+	}
+	if c.MaxAge > 0 {
+		b.WriteString("; Max-Age=")
+		b.WriteString(strconv.Itoa(c.MaxAge))
+	} else if c.MaxAge < 0 {
+		b.WriteString("; Max-Age=0")
+	}
+	if c.Domain != "" {
+		b.WriteString("; Domain=")
+		b.WriteString(strings.TrimPrefix(c.Domain, "."))
+	}
+	if c.Path != "" {
+		b.WriteString("; Path=")
+		b.WriteString(c.Path)
+	}
+	if c.Secure {
+		b.WriteString("; Secure")
+	}
+	if c.HttpOnly {
+		b.WriteString("; HttpOnly")
+	}
+	switch c.SameSite {
+	case SameSiteLax:
+		b.WriteString("; SameSite=Lax")
+	case SameSiteStrict:
+		b.WriteString("; SameSite=Strict")
+	case SameSiteNone:
+		b.WriteString("; SameSite=None")
+	}
+	if c.Partitioned {
+		b.WriteString("; Partitioned")
+	}
+
+	return b.String()
+}
+
+// validName reports whether name is an RFC 7230 token.
+func validName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		ch := name[i]
+		switch {
+		case ch >= 'a' && ch <= 'z', ch >= 'A' && ch <= 'Z', ch >= '0' && ch <= '9':
+		case strings.IndexByte("!#$%&'*+-.^_`|~", ch) >= 0:
+		default:
+			return false
+		}
+	}
+
+	return true
+}
+
+// validValue reports whether value is made of cookie-octets, optionally
+// surrounded by double quotes.
+func validValue(value string) bool {
+	value = unquote(value)
+	for i := 0; i < len(value); i++ {
+		ch := value[i]
+		if ch < 0x21 || ch > 0x7e || ch == '"' || ch == ',' || ch == ';' || ch == '\\' {
+			return false
+		}
+	}
+
+	return true
+}
+
+func unquote(value string) string {
+	if len(value) >= 2 && value[0] == '"' && value[len(value)-1] == '"' {
+		return value[1 : len(value)-1]
+	}
+
+	return value
+}
+
+func validDomain(domain string) bool {
+	domain = strings.TrimPrefix(domain, ".")
+	if domain == "" || len(domain) > 253 {
+		return false
+	}
+	for _, label := range strings.Split(domain, ".") {
+		if label == "" || len(label) > 63 || label[0] == '-' || label[len(label)-1] == '-' {
+			return false
+		}
+		for i := 0; i < len(label); i++ {
+			ch := label[i]
+			if !(ch >= 'a' && ch <= 'z' || ch >= 'A' && ch <= 'Z' || ch >= '0' && ch <= '9' || ch == '-') {
+				return false
+			}
+		}
+	}
+
+	return true
+}
+
+// validPath reports whether path has no control characters or semicolons.
+func validPath(path string) bool {
+	for i := 0; i < len(path); i++ {
+		if ch := path[i]; ch < 0x20 || ch == 0x7f || ch == ';' {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,64 @@
+package cookie
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParse(t *testing.T) {
+	// Test: Pairs are split and trimmed, quotes removed
+	cookies := Parse(`session=abc123; theme="dark";lang=en`)
+	assert.Equal(t, []*Cookie{
+		{Name: "session", Value: "abc123"},
+		{Name: "theme", Value: "dark"},
+		{Name: "lang", Value: "en"},
+	}, cookies)
+
+	// Test: Malformed pairs are skipped
+	cookies = Parse(`novalue; bad name=1; ok=1; semi=a"b; empty=`)
+	assert.Equal(t, []*Cookie{
+		{Name: "ok", Value: "1"},
+		{Name: "empty", Value: ""},
+	}, cookies)
+
+	// Test: Empty header
+	assert.Empty(t, Parse(""))
+}
+
+func TestSetCookie(t *testing.T) {
+	// Test: All attributes
+	c := &Cookie{
+		Name:        "session",
+		Value:       "abc123",
+		Expires:     time.Date(2026, 10, 21, 7, 28, 0, 0, time.FixedZone("CEST", 2*60*60)),
+		MaxAge:      3600,
+		Domain:      ".example.com",
+		Path:        "/app",
+		Secure:      true,
+		HttpOnly:    true,
+		SameSite:    SameSiteNone,
+		Partitioned: true,
+	}
+	assert.NoError(t, c.Validate())
+	assert.Equal(t, "session=abc123; Expires=Wed, 21 Oct 2026 05:28:00 GMT; Max-Age=3600; "+
+		"Domain=example.com; Path=/app; Secure; HttpOnly; SameSite=None; Partitioned", c.String())
+
+	// Test: Negative MaxAge deletes the cookie
+	c = &Cookie{Name: "session", MaxAge: -1, SameSite: SameSiteLax}
+	assert.Equal(t, "session=; Max-Age=0; SameSite=Lax", c.String())
+
+	// Test: Invalid names, values, domains and paths are rejected
+	assert.ErrorIs(t, (&Cookie{Name: "bad name"}).Validate(), ErrInvalidName)
+	assert.ErrorIs(t, (&Cookie{Name: ""}).Validate(), ErrInvalidName)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Value: "x;y"}).Validate(), ErrInvalidValue)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Value: "café"}).Validate(), ErrInvalidValue)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Domain: "exa mple.com"}).Validate(), ErrInvalidDomain)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Path: "/a;Secure"}).Validate(), ErrInvalidPath)
+	assert.NoError(t, (&Cookie{Name: "a", Value: `"quoted"`}).Validate())
+
+	// Test: SameSite=None and Partitioned need Secure
+	assert.ErrorIs(t, (&Cookie{Name: "a", SameSite: SameSiteNone}).Validate(), ErrNotSecure)
+	assert.ErrorIs(t, (&Cookie{Name: "a", Partitioned: true}).Validate(), ErrNotSecure)
+}
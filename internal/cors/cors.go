@@ -0,0 +1,250 @@
+package cors
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+)
+
+var ErrWildcardCredentials = errors.New("cors: credentials can't be allowed for any origin")
+
+var (
+	defaultMethods = []string{"GET", "HEAD", "POST"}
+	defaultHeaders = []string{"Accept", "Accept-Language", "Content-Language", "Content-Type"}
+)
+
+// CORS answers preflight requests and adds the Access-Control headers that
+// let browsers share responses with pages from other origins (the Fetch
+// standard's CORS protocol).
+type CORS struct {
+	origins     []string
+	originFunc  func(origin string) bool
+	methods     []string
+	headers     []string
+	exposed     []string
+	credentials bool
+	maxAge      time.Duration
+
+	anyOrigin bool
+	anyHeader bool
+}
+
+type Option func(c *CORS)
+
+// WithOrigins allows requests from the given origins, such as
+// "https://example.com". An origin may contain one "*" standing for any
+// non-empty part, as in "https://*.example.com", and "*" alone allows every
+// origin. No origin is allowed by default.
+func WithOrigins(origins ...string) Option {
+	return func(c *CORS) {
+		c.origins = append(c.origins, origins...)
+	}
+}
+
+// WithOriginFunc allows the origins for which fn returns true, in addition
+// to those given to WithOrigins.
+func WithOriginFunc(fn func(origin string) bool) Option {
+	return func(c *CORS) {
+		c.originFunc = fn
+	}
+}
+
+// WithMethods sets the methods allowed in preflight requests. Defaults to
+// GET, HEAD and POST.
+func WithMethods(methods ...string) Option {
+	return func(c *CORS) {
+		c.methods = methods
+	}
+}
+
+// WithHeaders sets the request headers allowed in preflight requests, "*"
+// allowing any. Defaults to Accept, Accept-Language, Content-Language and
+// Content-Type.
+func WithHeaders(names ...string) Option {
+	return func(c *CORS) {
+		c.headers = names
+	}
+}
+
+// WithExposedHeaders lets pages read the given response headers, besides
+// the CORS-safelisted ones.
+func WithExposedHeaders(names ...string) Option {
+	return func(c *CORS) {
+		c.exposed = names
+	}
+}
+
+// WithCredentials lets pages send cookies and Authorization headers and
+// read the responses. It can't be combined with the "*" origin.
+func WithCredentials() Option {
+	return func(c *CORS) {
+		c.credentials = true
+	}
+}
+
+// WithMaxAge lets browsers cache preflight results for d. Browsers cap it,
+// at 2 hours for Chromium. Defaults to not sending Access-Control-Max-Age,
+// which browsers treat as 5 seconds.
+func WithMaxAge(d time.Duration) Option {
+	return func(c *CORS) {
+		c.maxAge = d
+	}
+}
+
+func New(opts ...Option) (*CORS, error) {
+	c := &CORS{
+		methods: defaultMethods,
+		headers: defaultHeaders,
+	}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	for i, origin := range c.origins {
+		if origin == "*" {
+			c.anyOrigin = true
+			continue
+		}
+		if strings.Count(origin, "*") > 1 {
+			return nil, fmt.Errorf("cors: origin %q has more than one wildcard", origin)
+		}
+		c.origins[i] = strings.ToLower(origin)
+	}
+	if c.anyOrigin && c.credentials {
+		return nil, ErrWildcardCredentials
+	}
+	c.anyHeader = slices.Contains(c.headers, "*")
+
+	return c, nil
+}
+
+// Middleware answers preflight requests from allowed origins with 204 and
+// the allowed methods and headers, without calling next. Other requests go
+// to next, with the CORS headers added to the response when their origin is
+// allowed.
+func (c *CORS) Middleware() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w response.Writer, req *request.Request) {
+			origin := req.Headers.Get("Origin")
+			if req.RequestLine.Method == "OPTIONS" && origin != "" && req.Headers.Get("Access-Control-Request-Method") != "" {
+				c.preflight(w, req, origin)
+				return
+			}
+
+			// The response depends on the origin unless every origin gets
+			// the same one, so caches must not serve it to other origins
+			if !c.anyOrigin || c.originFunc != nil {
+				w.Header().Set("Vary", "Origin")
+			}
+			if origin != "" && c.allowOrigin(origin) {
+				c.setOrigin(w.Header(), origin)
+				if len(c.exposed) > 0 {
+					w.Header().Replace("Access-Control-Expose-Headers", strings.Join(c.exposed, ", "))
+				}
+			}
+
+			next(w, req)
+		}
+	}
+}
+
+func (c *CORS) preflight(w response.Writer, req *request.Request, origin string) {
+	h := headers.NewHeaders()
+	h.Set("Vary", "Origin, Access-Control-Request-Method, Access-Control-Request-Headers")
+
+	method := req.Headers.Get("Access-Control-Request-Method")
+	requested := splitList(req.Headers.Get("Access-Control-Request-Headers"))
+	// Disallowed preflights get no CORS headers, so the browser blocks the
+	// actual request
+	if c.allowOrigin(origin) && c.allowMethod(method) && c.allowHeaders(requested) {
+		c.setOrigin(h, origin)
+		h.Set("Access-Control-Allow-Methods", strings.Join(c.methods, ", "))
+		if len(requested) > 0 {
+			if c.anyHeader {
+				h.Set("Access-Control-Allow-Headers", strings.Join(requested, ", "))
+			} else {
+				h.Set("Access-Control-Allow-Headers", strings.Join(c.headers, ", "))
+			}
+		}
+		if c.maxAge > 0 {
+			h.Set("Access-Control-Max-Age", strconv.Itoa(int(c.maxAge.Seconds())))
+		}
+	}
+
+	w.WriteStatusLine(response.StatusNoContent)
+	w.WriteHeaders(h)
+}
+
+func (c *CORS) setOrigin(h *headers.Headers, origin string) {
+	if c.anyOrigin && !c.credentials {
+		h.Replace("Access-Control-Allow-Origin", "*")
+		return
+	}
+
+	h.Replace("Access-Control-Allow-Origin", origin)
+	if c.credentials {
+		h.Replace("Access-Control-Allow-Credentials", "true")
+	}
+}
+
+func (c *CORS) allowOrigin(origin string) bool {
+	if c.anyOrigin {
+		return true
+	}
+
+	lower := strings.ToLower(origin)
+	for _, allowed := range c.origins {
+		prefix, suffix, wildcard := strings.Cut(allowed, "*")
+		if !wildcard {
+			if lower == allowed {
+				return true
+			}
+			continue
+		}
+		if len(lower) > len(prefix)+len(suffix) && strings.HasPrefix(lower, prefix) && strings.HasSuffix(lower, suffix) {
+			return true
+		}
+	}
+
+	return c.originFunc != nil && c.originFunc(origin)
+}
+
+func (c *CORS) allowMethod(method string) bool {
+	return slices.Contains(c.methods, method)
+}
+
+func (c *CORS) allowHeaders(requested []string) bool {
+	if c.anyHeader {
+		return true
+	}
+
+	for _, name := range requested {
+		if !slices.ContainsFunc(c.headers, func(allowed string) bool {
+			return strings.EqualFold(allowed, name)
+		}) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// splitList splits a comma-separated header value, dropping empty items.
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
@@ -0,0 +1,136 @@
+package cors
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs a request through the middleware of c with the given headers,
+// as name and value pairs, and reports whether the handler was called.
+func serve(t *testing.T, c *CORS, method string, hdrs ...string) (*response.Response, bool) {
+	req := servertest.NewRequest(method, "/api", "")
+	for i := 0; i+1 < len(hdrs); i += 2 {
+		req.Headers.Set(hdrs[i], hdrs[i+1])
+	}
+	called := false
+	res, err := servertest.Serve(c.Middleware()(func(w response.Writer, req *request.Request) {
+		called = true
+		w.Header().Set("Vary", "Accept-Encoding")
+		w.Header().Set("X-Total-Count", "3")
+		servertest.OK(w, req)
+	}), req)
+	require.NoError(t, err)
+	return res, called
+}
+
+func TestOrigins(t *testing.T) {
+	c, err := New(
+		WithOrigins("https://app.example.com", "https://*.Preview.example.com"),
+		WithOriginFunc(func(origin string) bool { return strings.HasSuffix(origin, ".internal") }),
+		WithExposedHeaders("X-Total-Count"),
+	)
+	require.NoError(t, err)
+
+	// Test: Exact, wildcard and function origins are allowed
+	for _, origin := range []string{
+		"https://app.example.com",
+		"https://APP.example.com",
+		"https://pr-42.preview.example.com",
+		"http://dashboard.internal",
+	} {
+		res, called := serve(t, c, "GET", "Origin", origin)
+		assert.True(t, called)
+		assert.Equal(t, origin, res.Headers.Get("Access-Control-Allow-Origin"))
+		assert.Equal(t, "X-Total-Count", res.Headers.Get("Access-Control-Expose-Headers"))
+		assert.Empty(t, res.Headers.Get("Access-Control-Allow-Credentials"))
+	}
+
+	// Test: Other origins still reach the handler, without CORS headers
+	for _, origin := range []string{"https://evil.example.com", "https://.preview.example.com", "null"} {
+		res, called := serve(t, c, "GET", "Origin", origin)
+		assert.True(t, called)
+		assert.Empty(t, res.Headers.Get("Access-Control-Allow-Origin"), origin)
+	}
+
+	// Test: Vary: Origin is added to the handler's Vary
+	res, _ := serve(t, c, "GET")
+	assert.Contains(t, res.Headers.Get("Vary"), "Accept-Encoding")
+	assert.Contains(t, res.Headers.Get("Vary"), "Origin")
+
+	// Test: Any origin gets "*" and no Vary
+	c, err = New(WithOrigins("*"))
+	require.NoError(t, err)
+	res, _ = serve(t, c, "GET", "Origin", "https://anywhere.example")
+	assert.Equal(t, "*", res.Headers.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "Accept-Encoding", res.Headers.Get("Vary"))
+
+	// Test: Credentials echo the origin and can't be allowed for any origin
+	c, err = New(WithOrigins("https://app.example.com"), WithCredentials())
+	require.NoError(t, err)
+	res, _ = serve(t, c, "GET", "Origin", "https://app.example.com")
+	assert.Equal(t, "https://app.example.com", res.Headers.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "true", res.Headers.Get("Access-Control-Allow-Credentials"))
+	_, err = New(WithOrigins("*"), WithCredentials())
+	assert.ErrorIs(t, err, ErrWildcardCredentials)
+	_, err = New(WithOrigins("https://*.*.example.com"))
+	assert.Error(t, err)
+}
+
+func TestPreflight(t *testing.T) {
+	c, err := New(
+		WithOrigins("https://app.example.com"),
+		WithMethods("GET", "PUT", "DELETE"),
+		WithHeaders("Content-Type", "X-Requested-With"),
+		WithMaxAge(10*time.Minute),
+	)
+	require.NoError(t, err)
+
+	// Test: Allowed preflights get 204 with the allowed methods and headers
+	res, called := serve(t, c, "OPTIONS",
+		"Origin", "https://app.example.com",
+		"Access-Control-Request-Method", "PUT",
+		"Access-Control-Request-Headers", "content-type, x-requested-with")
+	assert.False(t, called)
+	assert.Equal(t, response.StatusNoContent, res.StatusLine.StatusCode)
+	assert.Equal(t, "https://app.example.com", res.Headers.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "GET, PUT, DELETE", res.Headers.Get("Access-Control-Allow-Methods"))
+	assert.Equal(t, "Content-Type, X-Requested-With", res.Headers.Get("Access-Control-Allow-Headers"))
+	assert.Equal(t, "600", res.Headers.Get("Access-Control-Max-Age"))
+	assert.Equal(t, "Origin, Access-Control-Request-Method, Access-Control-Request-Headers", res.Headers.Get("Vary"))
+	assert.Empty(t, res.Headers.Get("Content-Length"))
+
+	// Test: Disallowed origins, methods and headers get no CORS headers
+	for _, hdrs := range [][]string{
+		{"Origin", "https://evil.example.com", "Access-Control-Request-Method", "PUT"},
+		{"Origin", "https://app.example.com", "Access-Control-Request-Method", "PATCH"},
+		{"Origin", "https://app.example.com", "Access-Control-Request-Method", "PUT", "Access-Control-Request-Headers", "X-Secret"},
+	} {
+		res, called = serve(t, c, "OPTIONS", hdrs...)
+		assert.False(t, called)
+		assert.Equal(t, response.StatusNoContent, res.StatusLine.StatusCode)
+		assert.Empty(t, res.Headers.Get("Access-Control-Allow-Origin"), hdrs)
+		assert.Empty(t, res.Headers.Get("Access-Control-Allow-Methods"), hdrs)
+	}
+
+	// Test: OPTIONS requests that aren't preflights reach the handler
+	_, called = serve(t, c, "OPTIONS", "Origin", "https://app.example.com")
+	assert.True(t, called)
+
+	// Test: Any header is allowed with "*", echoing the requested ones
+	c, err = New(WithOrigins("*"), WithHeaders("*"))
+	require.NoError(t, err)
+	res, _ = serve(t, c, "OPTIONS",
+		"Origin", "https://anywhere.example",
+		"Access-Control-Request-Method", "POST",
+		"Access-Control-Request-Headers", "x-custom,authorization")
+	assert.Equal(t, "*", res.Headers.Get("Access-Control-Allow-Origin"))
+	assert.Equal(t, "x-custom, authorization", res.Headers.Get("Access-Control-Allow-Headers"))
+	assert.Empty(t, res.Headers.Get("Access-Control-Max-Age"))
+}
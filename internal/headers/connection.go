@@ -0,0 +1,73 @@
+package headers
+
+import "strings"
+
+// Tokens returns the comma-separated tokens of a header, trimmed and
+// lowercased.
+func (h *Headers) Tokens(name string) []string {
+	value := h.Get(name)
+	if value == "" {
+		return nil
+	}
+
+	var tokens []string
+	for _, token := range strings.Split(value, ",") {
+		token = strings.ToLower(strings.TrimSpace(token))
+		if token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+
+	return tokens
+}
+
+// HasToken reports whether the comma-separated header contains token,
+// compared case-insensitively.
+func (h *Headers) HasToken(name, token string) bool {
+	for _, t := range h.Tokens(name) {
+		if t == strings.ToLower(token) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RemoveConnectionHeaders removes the hop-by-hop headers listed in the
+// Connection header. The Connection header itself is kept, as is Upgrade,
+// which the recipient needs to switch protocols. Headers that frame or route
+// the message are never removed, since the message was already read with
+// them: a client naming Content-Length could otherwise smuggle its body as a
+// second request past a proxy.
+func (h *Headers) RemoveConnectionHeaders() {
+	for _, token := range h.Tokens("Connection") {
+		switch token {
+		case "connection", "close", "upgrade", "content-length", "transfer-encoding", "host":
+			continue
+		}
+		h.Remove(token)
+	}
+}
+
+// hopByHopHeaders are only meaningful for a single connection and must not
+// be forwarded by proxies.
+var hopByHopHeaders = []string{
+	"Connection",
+	"Keep-Alive",
+	"Proxy-Connection",
+	"Proxy-Authenticate",
+	"Proxy-Authorization",
+	"Te",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+}
+
+// RemoveHopByHopHeaders removes the headers listed in the Connection header
+// and the standard hop-by-hop headers, including Connection itself.
+func (h *Headers) RemoveHopByHopHeaders() {
+	h.RemoveConnectionHeaders()
+	for _, name := range hopByHopHeaders {
+		h.Remove(name)
+	}
+}
@@ -7,6 +7,10 @@ import (
 )
 
 var (
+	ErrMalformedHeader     = errors.New("malformed header")
+	ErrMalformedFieldName  = errors.New("malformed field name")
+	ErrMalformedHeaderName = errors.New("malformed header name")
+
 	crlfSeparator = []byte("\r\n")
 )
 
@@ -43,13 +47,13 @@ func isValidToken(field string) bool {
 func parseHeader(fieldLine []byte) (string, string, error) {
 	parts := bytes.SplitN(fieldLine, []byte(":"), 2)
 	if len(parts) != 2 {
-		return "", "", errors.New("malformed header")
+		return "", "", ErrMalformedHeader
 	}
 
 	name := parts[0]
 	value := bytes.TrimSpace(parts[1])
 	if bytes.HasSuffix(name, []byte(" ")) {
-		return "", "", errors.New("malformed field name")
+		return "", "", ErrMalformedFieldName
 	}
 
 	return string(name), string(value), nil
@@ -60,15 +64,34 @@ func (h *Headers) Get(name string) string {
 	return h.headers[strings.ToLower(name)]
 }
 
+// Set adds value to the header, joining it to an existing value with a
+// comma. Set-Cookie values can't be combined that way (RFC 6265 section 3),
+// so they are kept on separate lines instead: use Values to get them and
+// ForEachLine to write them.
 func (h *Headers) Set(name, value string) {
 	lcName := strings.ToLower(name)
 	if existingVal, ok := h.headers[lcName]; ok {
-		h.headers[lcName] = strings.Join([]string{existingVal, value}, ",")
+		separator := ","
+		if lcName == "set-cookie" {
+			separator = "\n"
+		}
+		h.headers[lcName] = existingVal + separator + value
 	} else {
 		h.headers[lcName] = value
 	}
 }
 
+// Values returns the values of the header: one per Set-Cookie line, and a
+// single comma-joined value for other headers.
+func (h *Headers) Values(name string) []string {
+	value, ok := h.headers[strings.ToLower(name)]
+	if !ok {
+		return nil
+	}
+
+	return strings.Split(value, "\n")
+}
+
 func (h *Headers) Remove(name string) {
 	delete(h.headers, strings.ToLower(name))
 }
@@ -83,6 +106,16 @@ func (h *Headers) ForEach(cb func(n, v string)) {
 	}
 }
 
+// ForEachLine calls cb for every header line to write, so Set-Cookie values
+// are written as separate lines.
+func (h *Headers) ForEachLine(cb func(n, v string)) {
+	for name, val := range h.headers {
+		for _, line := range strings.Split(val, "\n") {
+			cb(name, line)
+		}
+	}
+}
+
 func (h *Headers) Parse(data []byte) (int, bool, error) {
 	read := 0
 	done := false
@@ -103,7 +136,7 @@ func (h *Headers) Parse(data []byte) (int, bool, error) {
 			return 0, false, err
 		}
 		if !isValidToken(name) {
-			return 0, false, errors.New("malformed header name")
+			return 0, false, ErrMalformedHeaderName
 		}
 		read += idx + len(crlfSeparator)
 		h.Set(name, value)
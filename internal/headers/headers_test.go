@@ -67,6 +67,19 @@ func TestParse(t *testing.T) {
 	assert.Equal(t, 63, n)
 	assert.False(t, done)
 
+	// Test: Set-Cookie values are kept apart and written as separate lines
+	headers = NewHeaders()
+	data = []byte("Set-Cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT\r\nSet-Cookie: b=2\r\n")
+	_, _, err = headers.Parse(data)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "b=2"}, headers.Values("Set-Cookie"))
+	var lines []string
+	headers.ForEachLine(func(name, value string) {
+		lines = append(lines, name+": "+value)
+	})
+	assert.Equal(t, []string{"set-cookie: a=1; Expires=Wed, 21 Oct 2026 07:28:00 GMT", "set-cookie: b=2"}, lines)
+	assert.Nil(t, headers.Values("Cookie"))
+
 	// Test: No data
 	headers = NewHeaders()
 	data = []byte("\r\n")
@@ -76,3 +89,35 @@ func TestParse(t *testing.T) {
 	assert.Equal(t, 2, n)
 	assert.True(t, done)
 }
+
+func TestTokens(t *testing.T) {
+	// Test: Tokens are split, trimmed and lowercased
+	headers := NewHeaders()
+	headers.Set("Connection", "Keep-Alive, X-Foo ,,close")
+	assert.Equal(t, []string{"keep-alive", "x-foo", "close"}, headers.Tokens("connection"))
+	assert.True(t, headers.HasToken("Connection", "Close"))
+	assert.False(t, headers.HasToken("Connection", "upgrade"))
+
+	// Test: Headers named in Connection are removed
+	headers.Set("Keep-Alive", "timeout=5")
+	headers.Set("X-Foo", "bar")
+	headers.Set("Host", "localhost")
+	headers.RemoveConnectionHeaders()
+	assert.Equal(t, "", headers.Get("Keep-Alive"))
+	assert.Equal(t, "", headers.Get("X-Foo"))
+	assert.Equal(t, "localhost", headers.Get("Host"))
+	assert.NotEqual(t, "", headers.Get("Connection"))
+
+	// Test: Framing and routing headers named in Connection are kept
+	headers = NewHeaders()
+	headers.Set("Connection", "Content-Length, Transfer-Encoding, Host, X-Foo")
+	headers.Set("Content-Length", "42")
+	headers.Set("Transfer-Encoding", "chunked")
+	headers.Set("Host", "localhost")
+	headers.Set("X-Foo", "bar")
+	headers.RemoveConnectionHeaders()
+	assert.Equal(t, "42", headers.Get("Content-Length"))
+	assert.Equal(t, "chunked", headers.Get("Transfer-Encoding"))
+	assert.Equal(t, "localhost", headers.Get("Host"))
+	assert.Equal(t, "", headers.Get("X-Foo"))
+}
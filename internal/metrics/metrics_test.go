@@ -0,0 +1,78 @@
+package metrics
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWriteTo(t *testing.T) {
+	reg := NewRegistry()
+	conns := reg.NewGauge("open_connections", "Open connections.")
+	requests := reg.NewCounter("requests_total", "Handled requests.", "method", "status")
+	duration := reg.NewHistogram("duration_seconds", "Duration.", []float64{0.1, 1})
+
+	conns.Inc()
+	conns.Inc()
+	conns.Dec()
+	requests.Inc("GET", "200")
+	requests.Inc("GET", "200")
+	requests.Inc("POST", "500")
+	duration.Observe(0.05)
+	duration.Observe(0.5)
+	duration.Observe(3)
+
+	var out strings.Builder
+	n, err := reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Equal(t, int64(out.Len()), n)
+	assert.Equal(t, `# HELP open_connections Open connections.
+# TYPE open_connections gauge
+open_connections 1
+# HELP requests_total Handled requests.
+# TYPE requests_total counter
+requests_total{method="GET",status="200"} 2
+requests_total{method="POST",status="500"} 1
+# HELP duration_seconds Duration.
+# TYPE duration_seconds histogram
+duration_seconds_bucket{le="0.1"} 1
+duration_seconds_bucket{le="1"} 2
+duration_seconds_bucket{le="+Inf"} 3
+duration_seconds_sum 3.55
+duration_seconds_count 3
+`, out.String())
+
+	// Test: Label values are escaped
+	reg = NewRegistry()
+	reg.NewCounter("escaped_total", "Escaped.", "path").Inc("a\"b\\c\nd")
+	out.Reset()
+	_, err = reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Contains(t, out.String(), `escaped_total{path="a\"b\\c\nd"} 1`)
+
+	// Test: Wrong number of label values panics
+	assert.Panics(t, func() { requests.Inc("GET") })
+}
+
+func TestRegister(t *testing.T) {
+	reg := NewRegistry()
+	requests := reg.NewCounter("requests_total", "Requests.", "method")
+	requests.Inc("GET")
+
+	// Test: Registering the same metric again returns the existing one
+	again := reg.NewCounter("requests_total", "Requests.", "method")
+	again.Inc("GET")
+	var out strings.Builder
+	_, err := reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(out.String(), "# TYPE requests_total"))
+	assert.Contains(t, out.String(), `requests_total{method="GET"} 2`)
+
+	// Test: The same name with another type, labels or buckets panics
+	assert.Panics(t, func() { reg.NewGauge("requests_total", "Requests.", "method") })
+	assert.Panics(t, func() { reg.NewCounter("requests_total", "Requests.", "path") })
+	reg.NewHistogram("duration_seconds", "Duration.", []float64{1, 2})
+	assert.Panics(t, func() { reg.NewHistogram("duration_seconds", "Duration.", []float64{1, 5}) })
+}
@@ -0,0 +1,109 @@
+package proxy
+
+import (
+	"net"
+	"net/url"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Upstream is a backend server the proxy forwards requests to.
+type Upstream struct {
+	URL *url.URL
+
+	active atomic.Int64
+
+	mu        sync.Mutex
+	failures  int
+	downUntil time.Time
+	idle      []*upstreamConn
+	closed    bool
+}
+
+// ActiveRequests returns the number of requests currently forwarded to u.
+func (u *Upstream) ActiveRequests() int64 {
+	return u.active.Load()
+}
+
+// Healthy reports whether u is currently eligible to receive requests.
+func (u *Upstream) Healthy() bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	return time.Now().After(u.downUntil)
+}
+
+// address returns the host:port to dial for u.
+func (u *Upstream) address() string {
+	port := u.URL.Port()
+	if port == "" {
+		port = "80"
+		if u.URL.Scheme == "https" {
+			port = "443"
+		}
+	}
+
+	return net.JoinHostPort(u.URL.Hostname(), port)
+}
+
+// markFailure records a failed attempt. After maxFails consecutive failures
+// the upstream is taken out of rotation for failTimeout.
+func (u *Upstream) markFailure(maxFails int, failTimeout time.Duration) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.failures++
+	if maxFails > 0 && u.failures >= maxFails {
+		u.downUntil = time.Now().Add(failTimeout)
+		u.failures = 0
+	}
+}
+
+func (u *Upstream) markSuccess() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	u.failures = 0
+}
+
+// Balancer picks the upstream for the next request among the healthy ones.
+type Balancer interface {
+	Next(upstreams []*Upstream) *Upstream
+}
+
+// RoundRobin cycles through the upstreams in order.
+type RoundRobin struct {
+	next atomic.Uint64
+}
+
+func (b *RoundRobin) Next(upstreams []*Upstream) *Upstream {
+	if len(upstreams) == 0 {
+		return nil
+	}
+
+	return upstreams[(b.next.Add(1)-1)%uint64(len(upstreams))]
+}
+
+// LeastConnections picks the upstream with the fewest requests in flight,
+// breaking ties in round-robin order.
+type LeastConnections struct {
+	rr RoundRobin
+}
+
+func (b *LeastConnections) Next(upstreams []*Upstream) *Upstream {
+	if len(upstreams) == 0 {
+		return nil
+	}
+
+	start := int(b.rr.next.Add(1)-1) % len(upstreams)
+	best := upstreams[start]
+	for i := 1; i < len(upstreams); i++ {
+		u := upstreams[(start+i)%len(upstreams)]
+		if u.ActiveRequests() < best.ActiveRequests() {
+			best = u
+		}
+	}
+
+	return best
+}
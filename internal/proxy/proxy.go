@@ -0,0 +1,531 @@
+package proxy
+
+import (
+	"crypto/tls"
+	"errors"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/tracing"
+)
+
+var ErrNoUpstreams = errors.New("proxy: no upstreams")
+
+const (
+	defaultMaxFails    = 3
+	defaultFailTimeout = 10 * time.Second
+	defaultDialTimeout = 10 * time.Second
+	maxIdlePerUpstream = 8
+)
+
+// Proxy is a reverse proxy handler forwarding requests to a set of upstreams.
+type Proxy struct {
+	upstreams   []*Upstream
+	balancer    Balancer
+	stripPrefix string
+	timeout     time.Duration
+	dialTimeout time.Duration
+	maxFails    int
+	failTimeout time.Duration
+	tlsConfig   *tls.Config
+	logger      *slog.Logger
+}
+
+// Option configures a Proxy created with New.
+type Option func(p *Proxy)
+
+// WithBalancer sets the load balancing strategy. Defaults to RoundRobin.
+func WithBalancer(balancer Balancer) Option {
+	return func(p *Proxy) {
+		p.balancer = balancer
+	}
+}
+
+// WithStripPrefix removes prefix from the request path before forwarding.
+func WithStripPrefix(prefix string) Option {
+	return func(p *Proxy) {
+		p.stripPrefix = prefix
+	}
+}
+
+// WithTimeout bounds the time spent on one upstream exchange, including
+// streaming the response body. Zero means no timeout.
+func WithTimeout(timeout time.Duration) Option {
+	return func(p *Proxy) {
+		p.timeout = timeout
+	}
+}
+
+// WithDialTimeout bounds the time spent connecting to an upstream.
+func WithDialTimeout(timeout time.Duration) Option {
+	return func(p *Proxy) {
+		p.dialTimeout = timeout
+	}
+}
+
+// WithPassiveHealthCheck takes an upstream out of rotation for failTimeout
+// after maxFails consecutive failed requests. A maxFails of zero disables it.
+func WithPassiveHealthCheck(maxFails int, failTimeout time.Duration) Option {
+	return func(p *Proxy) {
+		p.maxFails = maxFails
+		p.failTimeout = failTimeout
+	}
+}
+
+// WithTLSConfig sets the TLS configuration used for https upstreams.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(p *Proxy) {
+		p.tlsConfig = config
+	}
+}
+
+// WithLogger sets the logger used to report upstream failures.
+func WithLogger(logger *slog.Logger) Option {
+	return func(p *Proxy) {
+		p.logger = logger
+	}
+}
+
+// New returns a proxy for the given upstream base URLs, such as
+// "http://10.0.0.1:8080" or "https://api.example.com/v1".
+func New(upstreams []string, opts ...Option) (*Proxy, error) {
+	if len(upstreams) == 0 {
+		return nil, ErrNoUpstreams
+	}
+
+	p := &Proxy{
+		balancer:    &RoundRobin{},
+		dialTimeout: defaultDialTimeout,
+		maxFails:    defaultMaxFails,
+		failTimeout: defaultFailTimeout,
+		logger:      slog.Default(),
+	}
+	for _, raw := range upstreams {
+		u, err := url.Parse(raw)
+		if err != nil {
+			return nil, err
+		}
+		if (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+			return nil, fmt.Errorf("proxy: invalid upstream %q", raw)
+		}
+		p.upstreams = append(p.upstreams, &Upstream{URL: u})
+	}
+	for _, opt := range opts {
+		opt(p)
+	}
+
+	return p, nil
+}
+
+// Upstreams returns the configured upstreams.
+func (p *Proxy) Upstreams() []*Upstream {
+	return p.upstreams
+}
+
+// CloseIdleConnections closes the keep-alive connections to the upstreams
+// that are not in use, such as when the proxy is being replaced.
+func (p *Proxy) CloseIdleConnections() {
+	for _, u := range p.upstreams {
+		u.closeIdle()
+	}
+}
+
+// Close closes the idle connections to the upstreams and stops pooling
+// connections, so the ones used by requests still in flight are closed when
+// they finish. It is meant for a proxy being replaced, which may still
+// forward the last requests it was given.
+func (p *Proxy) Close() {
+	for _, u := range p.upstreams {
+		u.close()
+	}
+}
+
+// Handle forwards req to an upstream and streams the response back. It has
+// the signature of server.Handler.
+func (p *Proxy) Handle(w response.Writer, req *request.Request) {
+	out := p.outgoingRequest(req)
+	tried := make(map[*Upstream]bool)
+
+	status := response.StatusServiceUnavailable
+	for range p.upstreams {
+		u := p.pick(tried)
+		if u == nil {
+			break
+		}
+		tried[u] = true
+
+		sent, started, err := p.forward(w, req, out, u)
+		if err == nil {
+			u.markSuccess()
+			return
+		}
+
+		var clientErr clientError
+		if errors.As(err, &clientErr) {
+			// The client went away, which says nothing about the upstream
+			p.logger.Debug("client write failed", "upstream", u.URL.String(), "error", err)
+		} else {
+			u.markFailure(p.maxFails, p.failTimeout)
+			p.logger.Warn("upstream request failed", "upstream", u.URL.String(), "error", err)
+		}
+		if started {
+			// Part of the response is already on the wire, so the client
+			// must see it cut short rather than wait for or reuse it
+			if conn, _, err := w.Hijack(); err == nil {
+				conn.Close()
+			}
+			return
+		}
+
+		status = response.StatusBadGateway
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			status = response.StatusGatewayTimeout
+		}
+		if sent && !retryable(out) {
+			// The upstream may have acted on the request
+			break
+		}
+	}
+
+	w.WriteStatus(status)
+}
+
+// retryable reports whether req can be sent again after it may have reached
+// an upstream: its method must be idempotent and its body still available.
+func retryable(req *request.Request) bool {
+	if req.BodyStreamed() {
+		return false
+	}
+
+	switch req.RequestLine.Method {
+	case "GET", "HEAD", "OPTIONS", "TRACE", "PUT", "DELETE":
+		return true
+	}
+
+	return false
+}
+
+// pick returns a healthy upstream that was not tried yet.
+func (p *Proxy) pick(tried map[*Upstream]bool) *Upstream {
+	var candidates []*Upstream
+	for _, u := range p.upstreams {
+		if !tried[u] && u.Healthy() {
+			candidates = append(candidates, u)
+		}
+	}
+
+	return p.balancer.Next(candidates)
+}
+
+// outgoingRequest copies req without hop-by-hop headers and with the
+// X-Forwarded-* and Forwarded headers describing the client. The request ID
+// and trace context of req, if it went through the server's Trace
+// middleware, replace the ones the client sent.
+func (p *Proxy) outgoingRequest(req *request.Request) *request.Request {
+	target := req.RequestLine.RequestTarget
+	if p.stripPrefix != "" {
+		target = strings.TrimPrefix(target, p.stripPrefix)
+		if !strings.HasPrefix(target, "/") {
+			target = "/" + target
+		}
+	}
+
+	out := request.New(req.RequestLine.Method, target, req.Body)
+	req.Headers.ForEach(func(name, value string) {
+		out.Headers.Replace(name, value)
+	})
+	out.Headers.RemoveHopByHopHeaders()
+	// The framing describes the body forwarded, not what the client's
+	// headers say, so a body is never sent upstream without a length
+	out.Headers.Remove("Content-Length")
+	if req.BodyStreamed() {
+		out.SetBodyReader(req.BodyReader(), req.ContentLength())
+	} else if req.Body != "" {
+		out.Headers.Replace("Content-Length", strconv.Itoa(len(req.Body)))
+	}
+	tracing.Inject(req.Context(), out.Headers)
+
+	clientIP := req.RemoteAddr
+	if host, _, err := net.SplitHostPort(clientIP); err == nil {
+		clientIP = host
+	}
+	host := req.Headers.Get("Host")
+
+	proto := "http"
+	if req.TLS {
+		proto = "https"
+	}
+
+	out.Headers.Set("X-Forwarded-For", clientIP)
+	out.Headers.Replace("X-Forwarded-Proto", proto)
+	if host != "" {
+		out.Headers.Replace("X-Forwarded-Host", host)
+	}
+
+	forwarded := "for=" + forwardedNode(clientIP) + ";proto=" + proto
+	if host != "" {
+		forwarded += ";host=" + quoteForwarded(host)
+	}
+	out.Headers.Set("Forwarded", forwarded)
+
+	return out
+}
+
+// forwardedNode formats a client address for the Forwarded header, quoting
+// IPv6 addresses as RFC 7239 requires.
+func forwardedNode(ip string) string {
+	if strings.Contains(ip, ":") {
+		return `"[` + ip + `]"`
+	}
+	if ip == "" {
+		return "unknown"
+	}
+
+	return ip
+}
+
+func quoteForwarded(value string) string {
+	if strings.ContainsAny(value, ":[]\" ;,") {
+		return `"` + strings.ReplaceAll(value, `"`, `\"`) + `"`
+	}
+
+	return value
+}
+
+// forward sends out to u and streams the response to w. sent reports
+// whether the request was written to a connection, so it may have reached
+// the upstream. started reports whether anything was written to w, after
+// which the request can't be retried elsewhere.
+func (p *Proxy) forward(w response.Writer, req, out *request.Request, u *Upstream) (sent, started bool, err error) {
+	u.active.Add(1)
+	defer u.active.Add(-1)
+
+	upstreamReq := *out
+	upstreamReq.RequestLine.RequestTarget = joinPath(u.URL.Path, out.RequestLine.RequestTarget)
+	upstreamReq.Headers.Replace("Host", u.URL.Host)
+
+	for attempt := 0; ; attempt++ {
+		uc, reused, err := p.getConn(u)
+		if err != nil {
+			return sent, false, err
+		}
+
+		sent = true
+		res, err := p.exchange(w, req.RequestLine.Method, &upstreamReq, uc, &started)
+		if err != nil {
+			uc.Close()
+			if reused && !started && attempt == 0 && retryable(out) {
+				// The idle connection was closed by the upstream
+				continue
+			}
+			return sent, started, err
+		}
+
+		if res.CloseDelimited() || res.Headers.HasToken("Connection", "close") {
+			uc.Close()
+		} else {
+			u.putConn(uc)
+		}
+
+		return sent, true, nil
+	}
+}
+
+func (p *Proxy) exchange(w response.Writer, method string, out *request.Request, uc *upstreamConn, started *bool) (*response.Response, error) {
+	if p.timeout > 0 {
+		uc.SetDeadline(time.Now().Add(p.timeout))
+	} else {
+		uc.SetDeadline(time.Time{})
+	}
+
+	if _, err := out.WriteTo(uc); err != nil {
+		return nil, err
+	}
+
+	var chunked bool
+	res, err := uc.reader.StreamResponse(method, func(res *response.Response) (io.Writer, error) {
+		*started = true
+
+		code := res.StatusLine.StatusCode
+		noBody := method == "HEAD" || code == response.StatusNoContent || code == response.StatusNotModified
+
+		h := headers.NewHeaders()
+		res.Headers.ForEach(func(name, value string) {
+			h.Replace(name, value)
+		})
+		trailer := res.Headers.Get("Trailer")
+		h.RemoveHopByHopHeaders()
+
+		chunked = !noBody && (res.Headers.HasToken("Transfer-Encoding", "chunked") || res.CloseDelimited())
+		if chunked {
+			h.Remove("Content-Length")
+			h.Replace("Transfer-Encoding", "chunked")
+			if trailer != "" {
+				h.Replace("Trailer", trailer)
+			}
+		}
+
+		if err := w.WriteStatusLine(code); err != nil {
+			return nil, clientError{err}
+		}
+		if err := w.WriteHeaders(h); err != nil {
+			return nil, clientError{err}
+		}
+
+		if chunked {
+			return chunkWriter{w}, nil
+		}
+		return bodyWriter{w}, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if chunked {
+		if err := w.WriteTrailers(res.Trailers); err != nil {
+			return nil, clientError{err}
+		}
+	}
+
+	return res, nil
+}
+
+func joinPath(base, target string) string {
+	base = strings.TrimSuffix(base, "/")
+	if base == "" {
+		return target
+	}
+
+	return base + target
+}
+
+func (p *Proxy) getConn(u *Upstream) (*upstreamConn, bool, error) {
+	if uc := u.getConn(); uc != nil {
+		return uc, true, nil
+	}
+
+	dialer := &net.Dialer{Timeout: p.dialTimeout}
+	var (
+		conn net.Conn
+		err  error
+	)
+	if u.URL.Scheme == "https" {
+		config := p.tlsConfig
+		if config == nil {
+			config = &tls.Config{}
+		}
+		if config.ServerName == "" {
+			config = config.Clone()
+			config.ServerName = u.URL.Hostname()
+		}
+		conn, err = tls.DialWithDialer(dialer, "tcp", u.address(), config)
+	} else {
+		conn, err = dialer.Dial("tcp", u.address())
+	}
+	if err != nil {
+		return nil, false, err
+	}
+
+	return &upstreamConn{Conn: conn, reader: response.NewReader(conn)}, false, nil
+}
+
+// upstreamConn is a connection to an upstream together with the response
+// reader keeping bytes buffered between responses.
+type upstreamConn struct {
+	net.Conn
+	reader *response.Reader
+}
+
+func (u *Upstream) getConn() *upstreamConn {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if len(u.idle) == 0 {
+		return nil
+	}
+	uc := u.idle[len(u.idle)-1]
+	u.idle = u.idle[:len(u.idle)-1]
+
+	return uc
+}
+
+func (u *Upstream) putConn(uc *upstreamConn) {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	if u.closed || len(u.idle) >= maxIdlePerUpstream {
+		uc.Close()
+		return
+	}
+	u.idle = append(u.idle, uc)
+}
+
+// clientError is an error writing the response to the client, as opposed to
+// one talking to the upstream.
+type clientError struct {
+	err error
+}
+
+func (e clientError) Error() string {
+	return "writing to client: " + e.err.Error()
+}
+
+func (e clientError) Unwrap() error {
+	return e.err
+}
+
+type chunkWriter struct {
+	w response.Writer
+}
+
+func (cw chunkWriter) Write(p []byte) (int, error) {
+	n, err := cw.w.WriteChunk(p)
+	if err != nil {
+		return n, clientError{err}
+	}
+
+	return n, nil
+}
+
+type bodyWriter struct {
+	w response.Writer
+}
+
+func (bw bodyWriter) Write(p []byte) (int, error) {
+	n, err := bw.w.WriteBody(p)
+	if err != nil {
+		return n, clientError{err}
+	}
+
+	return n, nil
+}
+
+func (u *Upstream) closeIdle() {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	for _, uc := range u.idle {
+		uc.Close()
+	}
+	u.idle = nil
+}
+
+// close closes the idle connections and keeps the ones in use from being
+// pooled again.
+func (u *Upstream) close() {
+	u.mu.Lock()
+	u.closed = true
+	u.mu.Unlock()
+
+	u.closeIdle()
+}
@@ -0,0 +1,407 @@
+package proxy
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/client"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+	"github.com/rmdevio/httpserver/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var discard = slog.New(slog.DiscardHandler)
+
+func startUpstream(t *testing.T, name string) string {
+	srv, err := servertest.NewServer(func(w response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/api/chunked" {
+			h := response.GetDefaultHeaders(0)
+			h.Remove("Content-Length")
+			h.Replace("Transfer-Encoding", "chunked")
+			h.Replace("Trailer", "X-Done")
+			w.WriteStatusLine(response.StatusOk)
+			w.WriteHeaders(h)
+			w.WriteChunk([]byte("one,"))
+			w.WriteChunk([]byte("two"))
+			trailers := response.GetDefaultHeaders(0)
+			trailers.Remove("Content-Length")
+			trailers.Remove("Content-Type")
+			trailers.Replace("X-Done", "yes")
+			w.WriteTrailers(trailers)
+			return
+		}
+
+		body := []byte(fmt.Sprintf("%s|%s %s|%s|%s|%s|%s|%s",
+			name,
+			req.RequestLine.Method,
+			req.RequestLine.RequestTarget,
+			req.Headers.Get("X-Forwarded-For"),
+			req.Headers.Get("X-Forwarded-Host"),
+			req.Headers.Get("Forwarded"),
+			req.Headers.Get("X-Secret"),
+			req.Body,
+		))
+		h := response.GetDefaultHeaders(len(body))
+		h.Replace("X-Upstream", name)
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	})
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+func startProxy(t *testing.T, p *Proxy) string {
+	srv, err := servertest.NewServer(p.Handle)
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	return srv.URL
+}
+
+func TestForwarding(t *testing.T) {
+	p, err := New([]string{startUpstream(t, "a") + "/api"}, WithStripPrefix("/proxy"), WithLogger(discard))
+	require.NoError(t, err)
+	base := startProxy(t, p)
+	c := client.New()
+
+	// Test: Method, path, body and forwarding headers reach the upstream
+	req, err := client.NewRequest("POST", base+"/proxy/items?id=1", "payload")
+	require.NoError(t, err)
+	req.Headers.Replace("Connection", "X-Secret")
+	req.Headers.Replace("X-Secret", "hop")
+	res, err := c.Do(req)
+	require.NoError(t, err)
+	proxyHost := base[len("http://"):]
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "a", res.Headers.Get("X-Upstream"))
+	assert.Equal(t, fmt.Sprintf("a|POST /api/items?id=1|127.0.0.1|%s|for=127.0.0.1;proto=http;host=%q||payload",
+		proxyHost, proxyHost), res.Body)
+
+	// Test: Requests received over TLS are forwarded with proto=https
+	in := request.New("GET", "/", "")
+	in.RemoteAddr = "192.0.2.1:1234"
+	in.TLS = true
+	out := p.outgoingRequest(in)
+	assert.Equal(t, "https", out.Headers.Get("X-Forwarded-Proto"))
+	assert.Equal(t, "for=192.0.2.1;proto=https", out.Headers.Get("Forwarded"))
+
+	// Test: Chunked responses are streamed with trailers
+	res, err = c.Get(base + "/proxy/chunked")
+	require.NoError(t, err)
+	assert.Equal(t, "chunked", res.Headers.Get("Transfer-Encoding"))
+	assert.Equal(t, "one,two", res.Body)
+	assert.Equal(t, "yes", res.Trailers.Get("X-Done"))
+}
+
+func TestTracePropagation(t *testing.T) {
+	upstream, err := servertest.NewServer(func(w response.Writer, req *request.Request) {
+		body := []byte(req.Headers.Get("X-Request-ID") + " " + req.Headers.Get("traceparent"))
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	})
+	require.NoError(t, err)
+	t.Cleanup(upstream.Close)
+	p, err := New([]string{upstream.URL}, WithLogger(discard))
+	require.NoError(t, err)
+	srv, err := servertest.NewServer(server.Chain(p.Handle, server.Trace()))
+	require.NoError(t, err)
+	t.Cleanup(srv.Close)
+
+	// Test: The upstream gets the request ID and the proxy's span as parent
+	req, err := client.NewRequest("GET", srv.URL+"/", "")
+	require.NoError(t, err)
+	req.Headers.Replace("X-Request-ID", "from-client")
+	req.Headers.Replace("traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	res, err := client.New().Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "from-client "+res.Headers.Get("traceparent"), res.Body)
+	assert.Contains(t, res.Body, "-4bf92f3577b34da6a3ce929d0e0e4736-")
+	assert.NotContains(t, res.Body, "00f067aa0ba902b7")
+}
+
+func TestBalancing(t *testing.T) {
+	a, b := startUpstream(t, "a"), startUpstream(t, "b")
+
+	// Test: Round-robin alternates between upstreams
+	p, err := New([]string{a, b}, WithLogger(discard))
+	require.NoError(t, err)
+	base := startProxy(t, p)
+	c := client.New()
+	var seen []string
+	for range 4 {
+		res, err := c.Get(base + "/")
+		require.NoError(t, err)
+		seen = append(seen, res.Headers.Get("X-Upstream"))
+	}
+	assert.Equal(t, []string{"a", "b", "a", "b"}, seen)
+
+	// Test: Least connections prefers the idle upstream
+	lc := &LeastConnections{}
+	upstreams := []*Upstream{{}, {}}
+	upstreams[0].active.Add(2)
+	assert.Same(t, upstreams[1], lc.Next(upstreams))
+	assert.Same(t, upstreams[1], lc.Next(upstreams))
+}
+
+func TestPassiveHealthCheck(t *testing.T) {
+	// Reserve a port nothing listens on
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := "http://" + l.Addr().String()
+	l.Close()
+
+	p, err := New([]string{dead, startUpstream(t, "b")}, WithPassiveHealthCheck(1, time.Minute), WithLogger(discard))
+	require.NoError(t, err)
+	base := startProxy(t, p)
+	c := client.New()
+
+	// Test: Failed upstream is skipped and marked down
+	for range 3 {
+		res, err := c.Get(base + "/")
+		require.NoError(t, err)
+		assert.Equal(t, "b", res.Headers.Get("X-Upstream"))
+	}
+	assert.False(t, p.Upstreams()[0].Healthy())
+	assert.True(t, p.Upstreams()[1].Healthy())
+
+	// Test: No healthy upstream left
+	p, err = New([]string{dead}, WithLogger(discard))
+	require.NoError(t, err)
+	res, err := c.Get(startProxy(t, p) + "/")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+}
+
+func TestRetries(t *testing.T) {
+	// An upstream that drops every request after reading it
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		l.Close()
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 4096))
+			conn.Close()
+		}
+	}()
+	dropping := "http://" + l.Addr().String()
+
+	p, err := New([]string{dropping, startUpstream(t, "b")}, WithPassiveHealthCheck(0, 0), WithLogger(discard))
+	require.NoError(t, err)
+	base := startProxy(t, p)
+	c := client.New()
+
+	// Test: Idempotent requests are retried on the next upstream
+	res, err := c.Get(base + "/")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "b", res.Headers.Get("X-Upstream"))
+
+	// Test: Other requests are not sent again once an upstream got them
+	req, err := client.NewRequest("POST", base+"/", "payload")
+	require.NoError(t, err)
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusBadGateway, res.StatusLine.StatusCode)
+
+	// Test: Requests that couldn't be sent are retried whatever the method
+	reserved, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	dead := "http://" + reserved.Addr().String()
+	reserved.Close()
+	p, err = New([]string{dead, startUpstream(t, "c")}, WithLogger(discard))
+	require.NoError(t, err)
+	req, err = client.NewRequest("POST", startProxy(t, p)+"/", "payload")
+	require.NoError(t, err)
+	res, err = c.Do(req)
+	require.NoError(t, err)
+	assert.Equal(t, "c", res.Headers.Get("X-Upstream"))
+}
+
+func TestFailedResponses(t *testing.T) {
+	// An upstream that promises a longer body than it sends
+	l, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	stopped := make(chan struct{})
+	t.Cleanup(func() {
+		l.Close()
+		<-stopped
+	})
+	go func() {
+		defer close(stopped)
+		for {
+			conn, err := l.Accept()
+			if err != nil {
+				return
+			}
+			conn.Read(make([]byte, 4096))
+			io.WriteString(conn, "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n0123456789")
+			conn.Close()
+		}
+	}()
+	p, err := New([]string{"http://" + l.Addr().String()}, WithPassiveHealthCheck(1, time.Minute), WithLogger(discard))
+	require.NoError(t, err)
+	base := strings.TrimPrefix(startProxy(t, p), "http://")
+
+	// Test: A response the upstream cuts short closes the client connection
+	// instead of leaving the client waiting for the rest
+	conn, err := net.Dial("tcp", base)
+	require.NoError(t, err)
+	defer conn.Close()
+	conn.SetDeadline(time.Now().Add(5 * time.Second))
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: proxy\r\n\r\n")
+	require.NoError(t, err)
+	received, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(received), "content-length:100")
+	assert.True(t, strings.HasSuffix(string(received), "\r\n\r\n0123456789"))
+	assert.False(t, p.Upstreams()[0].Healthy())
+
+	// Test: A client leaving mid-response doesn't count against the upstream
+	upstream, err := servertest.NewServer(func(w response.Writer, req *request.Request) {
+		chunk := make([]byte, 64*1024)
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(1024 * len(chunk)))
+		for range 1024 {
+			if _, err := w.WriteBody(chunk); err != nil {
+				return
+			}
+		}
+	})
+	require.NoError(t, err)
+	t.Cleanup(upstream.Close)
+	p, err = New([]string{upstream.URL}, WithPassiveHealthCheck(1, time.Minute), WithLogger(discard))
+	require.NoError(t, err)
+	conn, err = net.Dial("tcp", strings.TrimPrefix(startProxy(t, p), "http://"))
+	require.NoError(t, err)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: proxy\r\n\r\n")
+	require.NoError(t, err)
+	_, err = conn.Read(make([]byte, 1024))
+	require.NoError(t, err)
+	conn.Close()
+	require.Eventually(t, func() bool {
+		return p.Upstreams()[0].ActiveRequests() == 0
+	}, 5*time.Second, 10*time.Millisecond)
+	assert.True(t, p.Upstreams()[0].Healthy())
+}
+
+func TestClose(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	upstream, err := servertest.NewServer(func(w response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			close(entered)
+			<-release
+		}
+		w.WriteStatus(response.StatusOk)
+	})
+	require.NoError(t, err)
+	t.Cleanup(upstream.Close)
+	p, err := New([]string{upstream.URL}, WithLogger(discard))
+	require.NoError(t, err)
+	base := startProxy(t, p)
+	c := client.New()
+	idle := func() int {
+		u := p.Upstreams()[0]
+		u.mu.Lock()
+		defer u.mu.Unlock()
+		return len(u.idle)
+	}
+
+	// Test: Connections are pooled while the proxy is in use
+	_, err = c.Get(base + "/")
+	require.NoError(t, err)
+	assert.Equal(t, 1, idle())
+
+	// Test: Close drops the idle connections and the ones of requests in
+	// flight once they finish
+	done := make(chan *response.Response)
+	go func() {
+		res, _ := client.New().Get(base + "/slow")
+		done <- res
+	}()
+	<-entered
+	_, err = c.Get(base + "/")
+	require.NoError(t, err)
+	assert.Equal(t, 1, idle())
+	p.Close()
+	assert.Equal(t, 0, idle())
+	close(release)
+	res := <-done
+	require.NotNil(t, res)
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, 0, idle())
+}
+
+func TestStreamedBodyFraming(t *testing.T) {
+	var mu sync.Mutex
+	var seen []string
+	upstream, err := servertest.NewServer(func(w response.Writer, req *request.Request) {
+		body, _ := io.ReadAll(req.BodyReader())
+		mu.Lock()
+		seen = append(seen, fmt.Sprintf("%s %s|%s|%d", req.RequestLine.Method, req.RequestLine.RequestTarget,
+			req.Headers.Get("Content-Length"), len(body)))
+		mu.Unlock()
+		w.WriteStatus(response.StatusOk)
+	})
+	require.NoError(t, err)
+	t.Cleanup(upstream.Close)
+	p, err := New([]string{upstream.URL}, WithLogger(discard))
+	require.NoError(t, err)
+	base := startProxy(t, p)
+
+	// Test: A streamed body whose Content-Length the client names in
+	// Connection is still forwarded with its length, so it cannot smuggle a
+	// second request to the upstream
+	smuggled := "GET /admin HTTP/1.1\r\nHost: upstream\r\n\r\n"
+	conn, err := net.Dial("tcp", strings.TrimPrefix(base, "http://"))
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = fmt.Fprintf(conn, "POST /upload HTTP/1.1\r\nHost: proxy\r\nConnection: Content-Length\r\n"+
+		"Content-Type: multipart/form-data; boundary=b\r\nContent-Length: %d\r\n\r\n%s", len(smuggled), smuggled)
+	require.NoError(t, err)
+	res, err := response.NewReader(conn).ReadResponse("POST")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	mu.Lock()
+	assert.Equal(t, []string{fmt.Sprintf("POST /upload|%d|%d", len(smuggled), len(smuggled))}, seen)
+	mu.Unlock()
+
+	// Test: The outgoing Content-Length comes from the framed body even when
+	// the incoming request lost its header
+	raw := fmt.Sprintf("POST /upload HTTP/1.1\r\nHost: proxy\r\nContent-Type: multipart/form-data; boundary=b\r\n"+
+		"Content-Length: %d\r\n\r\n%s", len(smuggled), smuggled)
+	in, err := request.NewReader(strings.NewReader(raw)).ReadRequest()
+	require.NoError(t, err)
+	require.True(t, in.BodyStreamed())
+	in.Headers.Remove("Content-Length")
+	out := p.outgoingRequest(in)
+	assert.Equal(t, fmt.Sprint(len(smuggled)), out.Headers.Get("Content-Length"))
+
+	// Test: A buffered body is forwarded with its own length
+	in = request.New("POST", "/", "payload")
+	in.Headers.Replace("Content-Length", "100")
+	out = p.outgoingRequest(in)
+	assert.Equal(t, "7", out.Headers.Get("Content-Length"))
+}
@@ -0,0 +1,163 @@
+package ratelimit
+
+import (
+	"errors"
+	"math"
+	"time"
+)
+
+var ErrInvalidLimit = errors.New("ratelimit: limit and period must be positive")
+
+// State is what a Store keeps for each key. Each algorithm uses its own
+// fields.
+type State struct {
+	// Tokens is what a token bucket held at Updated.
+	Tokens  float64   `json:"tokens,omitempty"`
+	Updated time.Time `json:"updated,omitzero"`
+
+	// WindowStart is when the current window of a sliding window started,
+	// Count the requests allowed in it and PrevCount those allowed in the
+	// window before.
+	WindowStart time.Time `json:"window_start,omitzero"`
+	Count       int       `json:"count,omitempty"`
+	PrevCount   int       `json:"prev_count,omitempty"`
+}
+
+// Result describes the outcome of a request against a limit.
+type Result struct {
+	Allowed bool
+	// Limit is the number of requests allowed per Window.
+	Limit  int
+	Window time.Duration
+	// Remaining is the number of requests that would be allowed right now.
+	Remaining int
+	// Reset is how long until the full limit is available again.
+	Reset time.Duration
+	// RetryAfter is how long until a denied request would be allowed.
+	RetryAfter time.Duration
+}
+
+// Algorithm decides whether requests are allowed from the state of their
+// key. Use TokenBucket or SlidingWindow.
+type Algorithm interface {
+	// take counts a request made at now against s, returning the new state,
+	// until when it must be kept and the outcome.
+	take(s State, now time.Time) (State, time.Time, Result)
+	validate() error
+}
+
+type tokenBucket struct {
+	limit  int
+	period time.Duration
+}
+
+// TokenBucket allows bursts of up to limit requests, refilled evenly over
+// period: limit requests per period on average.
+func TokenBucket(limit int, period time.Duration) Algorithm {
+	return tokenBucket{limit: limit, period: period}
+}
+
+func (b tokenBucket) validate() error {
+	if b.limit <= 0 || b.period <= 0 {
+		return ErrInvalidLimit
+	}
+
+	return nil
+}
+
+func (b tokenBucket) take(s State, now time.Time) (State, time.Time, Result) {
+	capacity := float64(b.limit)
+	perToken := b.period / time.Duration(b.limit)
+
+	tokens := capacity
+	if !s.Updated.IsZero() {
+		tokens = min(capacity, s.Tokens+float64(now.Sub(s.Updated))/float64(perToken))
+	}
+
+	res := Result{Limit: b.limit, Window: b.period}
+	if tokens >= 1 {
+		tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = time.Duration((1 - tokens) * float64(perToken))
+	}
+	res.Remaining = int(tokens)
+	res.Reset = time.Duration((capacity - tokens) * float64(perToken))
+
+	// Once full again, the bucket is the same as a new one
+	return State{Tokens: tokens, Updated: now}, now.Add(res.Reset), res
+}
+
+type slidingWindow struct {
+	limit  int
+	window time.Duration
+}
+
+// SlidingWindow allows limit requests in any window of the given length. It
+// weighs the count of the previous fixed window by how much it overlaps the
+// sliding one, which only needs two counters per key.
+func SlidingWindow(limit int, window time.Duration) Algorithm {
+	return slidingWindow{limit: limit, window: window}
+}
+
+func (sw slidingWindow) validate() error {
+	if sw.limit <= 0 || sw.window <= 0 {
+		return ErrInvalidLimit
+	}
+
+	return nil
+}
+
+func (sw slidingWindow) take(s State, now time.Time) (State, time.Time, Result) {
+	start := now.Truncate(sw.window)
+	if !s.WindowStart.Equal(start) {
+		if s.WindowStart.Equal(start.Add(-sw.window)) {
+			s.PrevCount = s.Count
+		} else {
+			s.PrevCount = 0
+		}
+		s.WindowStart = start
+		s.Count = 0
+	}
+
+	elapsed := now.Sub(start)
+	weight := 1 - float64(elapsed)/float64(sw.window)
+	estimate := float64(s.PrevCount)*weight + float64(s.Count)
+
+	res := Result{Limit: sw.limit, Window: sw.window}
+	if estimate+1 <= float64(sw.limit) {
+		s.Count++
+		estimate++
+		res.Allowed = true
+	} else {
+		res.RetryAfter = sw.retryAfter(s, elapsed)
+	}
+	res.Remaining = max(sw.limit-int(math.Ceil(estimate)), 0)
+	// Requests stop counting one window after the end of their own
+	switch {
+	case s.Count > 0:
+		res.Reset = 2*sw.window - elapsed
+	case s.PrevCount > 0:
+		res.Reset = sw.window - elapsed
+	}
+
+	return s, start.Add(2 * sw.window), res
+}
+
+// retryAfter returns how long until the estimate of s leaves room for one
+// more request, elapsed into the current window.
+func (sw slidingWindow) retryAfter(s State, elapsed time.Duration) time.Duration {
+	window := float64(sw.window)
+	room := float64(sw.limit - 1)
+
+	if float64(s.Count) <= room && s.PrevCount > 0 {
+		// The previous window's weight has to drop far enough
+		needed := time.Duration(math.Ceil(window * (1 - (room-float64(s.Count))/float64(s.PrevCount))))
+		return max(needed-elapsed, time.Millisecond)
+	}
+
+	// The current window is full: wait for its weight to drop once it
+	// becomes the previous one
+	needed := time.Duration(math.Ceil(window * (1 - room/float64(s.Count))))
+	return sw.window - elapsed + needed
+}
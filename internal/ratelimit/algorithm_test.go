@@ -0,0 +1,84 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+// takeN runs n requests at now against a, returning the final state and the
+// last result.
+func takeN(a Algorithm, s State, now time.Time, n int) (State, Result) {
+	var res Result
+	for range n {
+		s, _, res = a.take(s, now)
+	}
+
+	return s, res
+}
+
+func TestTokenBucket(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	bucket := TokenBucket(10, 10*time.Second)
+
+	// Test: Bursts up to the limit are allowed
+	s, res := takeN(bucket, State{}, now, 10)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 10*time.Second, res.Reset)
+
+	// Test: Requests over the limit wait for the next token
+	s, res = takeN(bucket, s, now.Add(500*time.Millisecond), 1)
+	assert.False(t, res.Allowed)
+	assert.Equal(t, 500*time.Millisecond, res.RetryAfter)
+
+	// Test: Tokens refill evenly
+	s, res = takeN(bucket, s, now.Add(3*time.Second), 1)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 2, res.Remaining)
+
+	// Test: The bucket refills up to the limit and expires when full
+	var expiresAt time.Time
+	s, expiresAt, res = bucket.take(s, now.Add(time.Hour))
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 9, res.Remaining)
+	assert.Equal(t, now.Add(time.Hour+time.Second), expiresAt)
+	assert.Equal(t, 9.0, s.Tokens)
+}
+
+func TestSlidingWindow(t *testing.T) {
+	start := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	window := SlidingWindow(10, time.Minute)
+
+	// Test: Up to the limit is allowed within a window
+	s, res := takeN(window, State{}, start.Add(30*time.Second), 10)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 90*time.Second, res.Reset)
+
+	// Test: The full window waits for its weight to drop in the next one
+	s, res = takeN(window, s, start.Add(45*time.Second), 1)
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, 21*time.Second, res.RetryAfter, float64(time.Millisecond))
+
+	// Test: The previous window counts by its overlap with the sliding one
+	_, res = takeN(window, s, start.Add(time.Minute+5*time.Second), 1)
+	assert.False(t, res.Allowed)
+	s, res = takeN(window, s, start.Add(time.Minute+8*time.Second), 1)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	assert.Equal(t, 10, s.PrevCount)
+	assert.Equal(t, 1, s.Count)
+	s, res = takeN(window, s, start.Add(time.Minute+30*time.Second), 4)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 0, res.Remaining)
+	_, res = takeN(window, s, start.Add(time.Minute+30*time.Second), 1)
+	assert.False(t, res.Allowed)
+	assert.InDelta(t, 6*time.Second, res.RetryAfter, float64(time.Millisecond))
+
+	// Test: Windows older than the previous one are forgotten
+	_, res = takeN(window, s, start.Add(3*time.Minute), 1)
+	assert.True(t, res.Allowed)
+	assert.Equal(t, 9, res.Remaining)
+}
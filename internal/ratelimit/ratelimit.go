@@ -0,0 +1,185 @@
+package ratelimit
+
+import (
+	"fmt"
+	"log/slog"
+	"net"
+	"net/netip"
+	"strconv"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/auth"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+)
+
+// defaultMaxKeys bounds the memory store used without WithStore.
+const defaultMaxKeys = 100_000
+
+// KeyFunc returns the key requests are counted under, so each key has its
+// own limit.
+type KeyFunc func(req *request.Request) string
+
+// ByIP counts requests by client IP address. IPv6 clients are counted by
+// /64 prefix, the block a single site usually gets, so they can't get a
+// fresh limit by changing address. Behind a reverse proxy this is the
+// proxy's address.
+func ByIP() KeyFunc {
+	return func(req *request.Request) string {
+		return "ip:" + clientIP(req)
+	}
+}
+
+// ByHeader counts requests by the value of the named header, such as an API
+// key, and requests without it by client IP address. The value is taken as
+// sent, so only use it for headers that middleware running first has
+// validated: otherwise clients escape the limit by sending a new value with
+// every request, and flood a MemoryStore until other keys are evicted.
+func ByHeader(name string) KeyFunc {
+	return func(req *request.Request) string {
+		if value := req.Headers.Get(name); value != "" {
+			return "header:" + value
+		}
+		return "ip:" + clientIP(req)
+	}
+}
+
+// ByPrincipal counts requests by the name of the principal stored by the
+// auth middleware, which must run first, and anonymous requests by client
+// IP address.
+func ByPrincipal() KeyFunc {
+	return func(req *request.Request) string {
+		if p := auth.FromRequest(req); p != nil {
+			return "principal:" + p.Name
+		}
+		return "ip:" + clientIP(req)
+	}
+}
+
+// clientIP returns the client address of req, or its /64 prefix for IPv6.
+func clientIP(req *request.Request) string {
+	host := req.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	addr, err := netip.ParseAddr(host)
+	if err != nil {
+		return host
+	}
+	addr = addr.Unmap()
+	if addr.Is6() {
+		prefix, _ := addr.WithZone("").Prefix(64)
+		return prefix.String()
+	}
+
+	return addr.String()
+}
+
+// Limiter limits the rate of requests going through its middleware.
+type Limiter struct {
+	algorithm Algorithm
+	store     Store
+	key       KeyFunc
+	logger    *slog.Logger
+	now       func() time.Time
+}
+
+type Option func(l *Limiter)
+
+// WithStore keeps the state of keys in store. Defaults to a MemoryStore
+// holding up to 100,000 keys.
+func WithStore(store Store) Option {
+	return func(l *Limiter) {
+		l.store = store
+	}
+}
+
+// WithKey sets how requests are grouped. Defaults to ByIP.
+func WithKey(key KeyFunc) Option {
+	return func(l *Limiter) {
+		l.key = key
+	}
+}
+
+// WithLogger sets the logger for store failures. Defaults to
+// slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(l *Limiter) {
+		l.logger = logger
+	}
+}
+
+// New returns a Limiter applying algorithm, such as TokenBucket(100,
+// time.Minute), to each key.
+func New(algorithm Algorithm, opts ...Option) (*Limiter, error) {
+	if err := algorithm.validate(); err != nil {
+		return nil, err
+	}
+
+	l := &Limiter{
+		algorithm: algorithm,
+		key:       ByIP(),
+		logger:    slog.Default(),
+		now:       time.Now,
+	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.store == nil {
+		l.store = NewMemoryStore(defaultMaxKeys)
+	}
+
+	return l, nil
+}
+
+// Allow counts a request under key and reports whether it is within the
+// limit.
+func (l *Limiter) Allow(key string) (Result, error) {
+	var res Result
+	err := l.store.Update(key, func(s State) (State, time.Time) {
+		var expiresAt time.Time
+		s, expiresAt, res = l.algorithm.take(s, l.now())
+		return s, expiresAt
+	})
+
+	return res, err
+}
+
+// Middleware adds RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset and
+// RateLimit-Policy headers to responses, and answers requests over the limit
+// with 429 and Retry-After instead of calling next. Requests are allowed if
+// the store fails, so an outage of a shared store doesn't take the server
+// down with it.
+func (l *Limiter) Middleware() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w response.Writer, req *request.Request) {
+			res, err := l.Allow(l.key(req))
+			if err != nil {
+				l.logger.Error("rate limit store failed", "error", err)
+				next(w, req)
+				return
+			}
+
+			h := w.Header()
+			h.Replace("RateLimit-Limit", strconv.Itoa(res.Limit))
+			h.Replace("RateLimit-Remaining", strconv.Itoa(res.Remaining))
+			h.Replace("RateLimit-Reset", strconv.Itoa(seconds(res.Reset)))
+			h.Replace("RateLimit-Policy", fmt.Sprintf("%d;w=%d", res.Limit, seconds(res.Window)))
+			if !res.Allowed {
+				h.Replace("Retry-After", strconv.Itoa(max(seconds(res.RetryAfter), 1)))
+				w.WriteProblem(response.NewProblem(response.StatusTooManyRequests, "rate limit exceeded"),
+					req.Headers.Get("Accept"))
+				return
+			}
+
+			next(w, req)
+		}
+	}
+}
+
+// seconds rounds d up to whole seconds, as header values are.
+func seconds(d time.Duration) int {
+	return int((d + time.Second - 1) / time.Second)
+}
@@ -0,0 +1,155 @@
+package ratelimit
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"log/slog"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/auth"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+	"github.com/rmdevio/httpserver/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// serve runs a request from remoteAddr through mw with the given headers, as
+// name and value pairs.
+func serve(t *testing.T, mw server.Middleware, remoteAddr string, hdrs ...string) *response.Response {
+	req := servertest.NewRequest("GET", "/", "")
+	req.RemoteAddr = remoteAddr
+	for i := 0; i+1 < len(hdrs); i += 2 {
+		req.Headers.Set(hdrs[i], hdrs[i+1])
+	}
+	res, err := servertest.Serve(mw(servertest.OK), req)
+	require.NoError(t, err)
+	return res
+}
+
+type failingStore struct{}
+
+func (failingStore) Update(string, func(State) (State, time.Time)) error {
+	return errors.New("connection refused")
+}
+
+func TestMiddleware(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(0)
+	store.now = func() time.Time { return now }
+	l, err := New(TokenBucket(2, time.Minute), WithStore(store))
+	require.NoError(t, err)
+	l.now = func() time.Time { return now }
+	mw := l.Middleware()
+
+	// Test: Allowed responses carry the RateLimit headers
+	res := serve(t, mw, "192.0.2.1:1234")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Equal(t, "2", res.Headers.Get("RateLimit-Limit"))
+	assert.Equal(t, "1", res.Headers.Get("RateLimit-Remaining"))
+	assert.Equal(t, "30", res.Headers.Get("RateLimit-Reset"))
+	assert.Equal(t, "2;w=60", res.Headers.Get("RateLimit-Policy"))
+
+	// Test: Requests over the limit get 429 with Retry-After
+	serve(t, mw, "192.0.2.1:5678")
+	res = serve(t, mw, "192.0.2.1:1234")
+	assert.Equal(t, response.StatusTooManyRequests, res.StatusLine.StatusCode)
+	assert.Equal(t, "30", res.Headers.Get("Retry-After"))
+	assert.Equal(t, "0", res.Headers.Get("RateLimit-Remaining"))
+	assert.Equal(t, "application/problem+json", res.Headers.Get("Content-Type"))
+
+	// Test: Other clients have their own limit
+	res = serve(t, mw, "198.51.100.7:1234")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+
+	// Test: The limit recovers over time
+	now = now.Add(30 * time.Second)
+	res = serve(t, mw, "192.0.2.1:1234")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+
+	// Test: Invalid limits are rejected
+	_, err = New(SlidingWindow(0, time.Minute))
+	assert.ErrorIs(t, err, ErrInvalidLimit)
+
+	// Test: Requests are allowed when the store fails
+	l, err = New(TokenBucket(1, time.Minute), WithStore(failingStore{}), WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+	res = serve(t, l.Middleware(), "192.0.2.1:1234")
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Empty(t, res.Headers.Get("RateLimit-Limit"))
+}
+
+func TestKeys(t *testing.T) {
+	// Test: Header keys share a limit across addresses
+	l, err := New(SlidingWindow(1, time.Minute), WithKey(ByHeader("X-API-Key")))
+	require.NoError(t, err)
+	mw := l.Middleware()
+	assert.Equal(t, response.StatusOk, serve(t, mw, "192.0.2.1:1", "X-API-Key", "k1").StatusLine.StatusCode)
+	assert.Equal(t, response.StatusTooManyRequests, serve(t, mw, "192.0.2.2:1", "X-API-Key", "k1").StatusLine.StatusCode)
+	assert.Equal(t, response.StatusOk, serve(t, mw, "192.0.2.1:1").StatusLine.StatusCode)
+
+	// Test: IPv6 clients share a limit within their /64
+	l, err = New(SlidingWindow(1, time.Minute))
+	require.NoError(t, err)
+	mw = l.Middleware()
+	assert.Equal(t, response.StatusOk, serve(t, mw, "[2001:db8:1:2::1]:1").StatusLine.StatusCode)
+	assert.Equal(t, response.StatusTooManyRequests, serve(t, mw, "[2001:db8:1:2:ffff::9]:1").StatusLine.StatusCode)
+	assert.Equal(t, response.StatusOk, serve(t, mw, "[2001:db8:1:3::1]:1").StatusLine.StatusCode)
+	req := servertest.NewRequest("GET", "/", "")
+	req.RemoteAddr = "[2001:db8:1:2::1]:1"
+	assert.Equal(t, "ip:2001:db8:1:2::/64", ByIP()(req))
+	req.RemoteAddr = "[::ffff:192.0.2.1]:1"
+	assert.Equal(t, "ip:192.0.2.1", ByIP()(req))
+
+	// Test: Principal keys follow the authenticated user
+	l, err = New(SlidingWindow(1, time.Minute), WithKey(ByPrincipal()))
+	require.NoError(t, err)
+	mw = func(next server.Handler) server.Handler {
+		return auth.Basic("api", auth.Credentials{"alice": "pw", "bob": "pw"})(l.Middleware()(next))
+	}
+	basic := func(user string) string {
+		return "Basic " + base64.StdEncoding.EncodeToString([]byte(user+":pw"))
+	}
+	assert.Equal(t, response.StatusOk, serve(t, mw, "192.0.2.1:1", "Authorization", basic("alice")).StatusLine.StatusCode)
+	assert.Equal(t, response.StatusTooManyRequests, serve(t, mw, "192.0.2.2:1", "Authorization", basic("alice")).StatusLine.StatusCode)
+	assert.Equal(t, response.StatusOk, serve(t, mw, "192.0.2.1:1", "Authorization", basic("bob")).StatusLine.StatusCode)
+}
+
+func TestMemoryStore(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore(3)
+	store.now = func() time.Time { return now }
+	count := func(key string, ttl time.Duration) int {
+		var n int
+		store.Update(key, func(s State) (State, time.Time) {
+			s.Count++
+			n = s.Count
+			return s, now.Add(ttl)
+		})
+		return n
+	}
+
+	// Test: State is kept per key until it expires
+	assert.Equal(t, 1, count("a", time.Minute))
+	assert.Equal(t, 2, count("a", time.Minute))
+	now = now.Add(time.Minute)
+	assert.Equal(t, 1, count("a", time.Minute))
+
+	// Test: The least recently used key is evicted at capacity
+	count("b", time.Hour)
+	count("c", time.Hour)
+	count("a", time.Hour)
+	count("d", time.Hour)
+	assert.Equal(t, 3, store.Len())
+	assert.Equal(t, 1, count("b", time.Hour))
+
+	// Test: Expired keys are swept
+	for i := range 2 {
+		count(fmt.Sprint("short", i), time.Second)
+	}
+	now = now.Add(2 * time.Hour)
+	count("e", time.Hour)
+	assert.Equal(t, 1, store.Len())
+}
@@ -0,0 +1,102 @@
+package ratelimit
+
+import (
+	"container/list"
+	"sync"
+	"time"
+)
+
+// Store keeps the limiter state of each key. A store shared by several
+// server processes, such as one backed by Redis, makes them enforce a
+// common limit. Implementations must be safe for concurrent use.
+type Store interface {
+	// Update calls fn with the state of key, the zero State if there is none
+	// or it expired, and keeps the state fn returns until the time it
+	// returns. Updates of the same key must not interleave.
+	Update(key string, fn func(s State) (State, time.Time)) error
+}
+
+// sweepInterval is how often MemoryStore removes expired keys.
+const sweepInterval = time.Minute
+
+// MemoryStore is a Store keeping state in memory, for a single process.
+// Expired keys are removed by periodic sweeps during updates and, once
+// there are maxKeys keys, the least recently used key is evicted for each
+// new one.
+type MemoryStore struct {
+	mu        sync.Mutex
+	maxKeys   int
+	entries   map[string]*list.Element
+	lru       *list.List
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryEntry struct {
+	key       string
+	state     State
+	expiresAt time.Time
+}
+
+// NewMemoryStore returns a MemoryStore holding at most maxKeys keys, or any
+// number of keys if maxKeys isn't positive.
+func NewMemoryStore(maxKeys int) *MemoryStore {
+	return &MemoryStore{
+		maxKeys: maxKeys,
+		entries: make(map[string]*list.Element),
+		lru:     list.New(),
+		now:     time.Now,
+	}
+}
+
+func (m *MemoryStore) Update(key string, fn func(s State) (State, time.Time)) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.lastSweep = now
+		m.sweep(now)
+	}
+
+	elem, ok := m.entries[key]
+	if !ok {
+		if m.maxKeys > 0 && len(m.entries) >= m.maxKeys {
+			m.remove(m.lru.Back())
+		}
+		elem = m.lru.PushFront(&memoryEntry{key: key})
+		m.entries[key] = elem
+	} else {
+		m.lru.MoveToFront(elem)
+	}
+
+	entry := elem.Value.(*memoryEntry)
+	if !now.Before(entry.expiresAt) {
+		entry.state = State{}
+	}
+	entry.state, entry.expiresAt = fn(entry.state)
+
+	return nil
+}
+
+func (m *MemoryStore) sweep(now time.Time) {
+	for _, elem := range m.entries {
+		if !now.Before(elem.Value.(*memoryEntry).expiresAt) {
+			m.remove(elem)
+		}
+	}
+}
+
+func (m *MemoryStore) remove(elem *list.Element) {
+	m.lru.Remove(elem)
+	delete(m.entries, elem.Value.(*memoryEntry).key)
+}
+
+// Len returns the number of keys held, including expired ones not removed
+// yet.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.entries)
+}
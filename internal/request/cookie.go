@@ -0,0 +1,19 @@
+package request
+
+import "github.com/rmdevio/httpserver/internal/cookie"
+
+// Cookies returns the cookies sent in the Cookie header.
+func (r *Request) Cookies() []*cookie.Cookie {
+	return cookie.Parse(r.Headers.Get("Cookie"))
+}
+
+// Cookie returns the first cookie named name, or nil if there is none.
+func (r *Request) Cookie(name string) *cookie.Cookie {
+	for _, c := range r.Cookies() {
+		if c.Name == name {
+			return c
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,231 @@
+package request
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/url"
+	"os"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+)
+
+var (
+	ErrNotForm      = errors.New("request body is not a form")
+	ErrFormTooLarge = errors.New("form too large")
+	ErrTooManyParts = errors.New("too many multipart parts")
+)
+
+const (
+	defaultMaxFormMemory = 10 << 20
+	defaultMaxFormSize   = 32 << 20
+	defaultMaxFormParts  = 1000
+)
+
+// FormLimits bounds form parsing. Zero values use the defaults.
+type FormLimits struct {
+	// MaxMemory is how much of a file part is kept in memory before the
+	// rest of it is written to a temporary file. Defaults to 10 MiB.
+	MaxMemory int64
+	// MaxSize caps the total size of the form values and files. Defaults
+	// to 32 MiB.
+	MaxSize int64
+	// MaxParts caps the number of multipart parts. Defaults to 1000.
+	MaxParts int
+	// TempDir is where file parts are spilled. Defaults to os.TempDir().
+	TempDir string
+}
+
+// Form is a parsed form body. Call RemoveAll when done with it to delete
+// the temporary files of uploaded files.
+type Form struct {
+	Values url.Values
+	Files  map[string][]*FormFile
+}
+
+// FormFile is an uploaded file of a multipart form.
+type FormFile struct {
+	Filename string
+	Header   *headers.Headers
+	Size     int64
+
+	content []byte
+	tmpFile string
+}
+
+// Open returns the content of the file.
+func (f *FormFile) Open() (io.ReadCloser, error) {
+	if f.tmpFile != "" {
+		return os.Open(f.tmpFile)
+	}
+
+	return io.NopCloser(bytes.NewReader(f.content)), nil
+}
+
+// RemoveAll deletes the temporary files backing the uploaded files.
+func (f *Form) RemoveAll() error {
+	var errs []error
+	for _, files := range f.Files {
+		for _, file := range files {
+			if file.tmpFile == "" {
+				continue
+			}
+			if err := os.Remove(file.tmpFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+				errs = append(errs, err)
+			}
+		}
+	}
+
+	return errors.Join(errs...)
+}
+
+// Query returns the parameters of the request target's query string.
+func (r *Request) Query() url.Values {
+	_, query, _ := strings.Cut(r.RequestLine.RequestTarget, "?")
+	values, _ := url.ParseQuery(query)
+
+	return values
+}
+
+// ParseForm parses an application/x-www-form-urlencoded or
+// multipart/form-data body. Multipart bodies are read from the connection
+// one part at a time, with file parts larger than limits.MaxMemory written
+// to temporary files, so they can only be parsed once.
+func (r *Request) ParseForm(limits FormLimits) (*Form, error) {
+	if limits.MaxMemory <= 0 {
+		limits.MaxMemory = defaultMaxFormMemory
+	}
+	if limits.MaxSize <= 0 {
+		limits.MaxSize = defaultMaxFormSize
+	}
+	if limits.MaxParts <= 0 {
+		limits.MaxParts = defaultMaxFormParts
+	}
+
+	mediaType, params, err := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	if err != nil {
+		return nil, ErrNotForm
+	}
+
+	switch mediaType {
+	case "application/x-www-form-urlencoded":
+		if int64(len(r.Body)) > limits.MaxSize {
+			return nil, ErrFormTooLarge
+		}
+		values, err := url.ParseQuery(r.Body)
+		if err != nil {
+			return nil, err
+		}
+		return &Form{Values: values, Files: map[string][]*FormFile{}}, nil
+	case "multipart/form-data":
+		if params["boundary"] == "" {
+			return nil, ErrNotForm
+		}
+		form := &Form{Values: url.Values{}, Files: map[string][]*FormFile{}}
+		if err := form.readMultipart(multipart.NewReader(r.BodyReader(), params["boundary"]), limits); err != nil {
+			form.RemoveAll()
+			return nil, err
+		}
+		return form, nil
+	}
+
+	return nil, ErrNotForm
+}
+
+func (f *Form) readMultipart(reader *multipart.Reader, limits FormLimits) error {
+	remaining := limits.MaxSize
+	for parts := 0; ; parts++ {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+		if parts >= limits.MaxParts {
+			return ErrTooManyParts
+		}
+
+		name := part.FormName()
+		if name == "" {
+			continue
+		}
+
+		// Read one byte past the limit to detect oversized parts
+		var buf bytes.Buffer
+		limit := remaining
+		if part.FileName() != "" {
+			limit = min(limit, limits.MaxMemory)
+		}
+		n, err := io.CopyN(&buf, part, limit+1)
+		if err != nil && err != io.EOF {
+			return err
+		}
+
+		if part.FileName() == "" {
+			if n > remaining {
+				return ErrFormTooLarge
+			}
+			remaining -= n
+			f.Values.Add(name, buf.String())
+			continue
+		}
+
+		if n > remaining {
+			return ErrFormTooLarge
+		}
+
+		// The file is added before spilling so RemoveAll deletes its
+		// temporary file if anything fails
+		file := &FormFile{
+			Filename: part.FileName(),
+			Header:   partHeaders(part),
+			Size:     n,
+			content:  buf.Bytes(),
+		}
+		f.Files[name] = append(f.Files[name], file)
+		if n > limit {
+			if err := file.spill(&buf, part, remaining, limits.TempDir); err != nil {
+				return err
+			}
+		}
+		remaining -= file.Size
+	}
+}
+
+// spill writes the buffered start of a file part and the rest of it to a
+// temporary file, failing once more than max bytes were written.
+func (file *FormFile) spill(buffered io.Reader, part io.Reader, max int64, dir string) error {
+	file.content = nil
+	tmp, err := os.CreateTemp(dir, "form-upload-*")
+	if err != nil {
+		return err
+	}
+	defer tmp.Close()
+	file.tmpFile = tmp.Name()
+
+	n, err := io.Copy(tmp, io.LimitReader(io.MultiReader(buffered, part), max+1))
+	if err != nil {
+		return err
+	}
+	if n > max {
+		return ErrFormTooLarge
+	}
+	file.Size = n
+
+	return nil
+}
+
+func partHeaders(part *multipart.Part) *headers.Headers {
+	h := headers.NewHeaders()
+	for name, values := range part.Header {
+		for _, value := range values {
+			h.Set(name, value)
+		}
+	}
+
+	return h
+}
@@ -0,0 +1,175 @@
+package request
+
+import (
+	"bytes"
+	"io"
+	"mime/multipart"
+	"os"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func multipartRequest(t *testing.T, build func(w *multipart.Writer)) *Request {
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	build(w)
+	require.NoError(t, w.Close())
+
+	req := New("POST", "/upload", body.String())
+	req.Headers.Replace("Content-Type", w.FormDataContentType())
+	return req
+}
+
+func TestParseForm(t *testing.T) {
+	// Test: Query parameters
+	req := New("GET", "/search?q=go+http&tag=a&tag=b", "")
+	assert.Equal(t, "go http", req.Query().Get("q"))
+	assert.Equal(t, []string{"a", "b"}, req.Query()["tag"])
+
+	// Test: URL-encoded body
+	req = New("POST", "/submit", "name=gopher&lang=go%21")
+	req.Headers.Replace("Content-Type", "application/x-www-form-urlencoded; charset=utf-8")
+	form, err := req.ParseForm(FormLimits{})
+	require.NoError(t, err)
+	assert.Equal(t, "gopher", form.Values.Get("name"))
+	assert.Equal(t, "go!", form.Values.Get("lang"))
+
+	// Test: Other content types are rejected
+	req = New("POST", "/submit", "{}")
+	req.Headers.Replace("Content-Type", "application/json")
+	_, err = req.ParseForm(FormLimits{})
+	assert.ErrorIs(t, err, ErrNotForm)
+
+	// Test: URL-encoded bodies over the size limit
+	req = New("POST", "/submit", "name="+strings.Repeat("a", 100))
+	req.Headers.Replace("Content-Type", "application/x-www-form-urlencoded")
+	_, err = req.ParseForm(FormLimits{MaxSize: 50})
+	assert.ErrorIs(t, err, ErrFormTooLarge)
+}
+
+func TestParseMultipartForm(t *testing.T) {
+	tempDir := t.TempDir()
+
+	// Test: Values and files with their part headers
+	req := multipartRequest(t, func(w *multipart.Writer) {
+		w.WriteField("title", "holiday")
+		part, _ := w.CreateFormFile("photo", "beach.txt")
+		part.Write([]byte("small file"))
+		part, _ = w.CreateFormFile("photo", "large.txt")
+		part.Write([]byte(strings.Repeat("x", 100)))
+	})
+	form, err := req.ParseForm(FormLimits{MaxMemory: 50, TempDir: tempDir})
+	require.NoError(t, err)
+	assert.Equal(t, "holiday", form.Values.Get("title"))
+	require.Len(t, form.Files["photo"], 2)
+
+	small := form.Files["photo"][0]
+	assert.Equal(t, "beach.txt", small.Filename)
+	assert.Equal(t, int64(10), small.Size)
+	assert.Equal(t, "application/octet-stream", small.Header.Get("Content-Type"))
+	assert.Contains(t, small.Header.Get("Content-Disposition"), `filename="beach.txt"`)
+	content, err := small.Open()
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	assert.Equal(t, "small file", string(data))
+
+	// Test: Files over the memory threshold are spilled to temporary files
+	large := form.Files["photo"][1]
+	assert.Equal(t, int64(100), large.Size)
+	spilled, err := os.ReadDir(tempDir)
+	require.NoError(t, err)
+	assert.Len(t, spilled, 1)
+	content, err = large.Open()
+	require.NoError(t, err)
+	data, _ = io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, strings.Repeat("x", 100), string(data))
+
+	// Test: RemoveAll deletes the temporary files
+	require.NoError(t, form.RemoveAll())
+	spilled, _ = os.ReadDir(tempDir)
+	assert.Empty(t, spilled)
+
+	// Test: Too many parts
+	req = multipartRequest(t, func(w *multipart.Writer) {
+		for range 5 {
+			w.WriteField("field", "value")
+		}
+	})
+	_, err = req.ParseForm(FormLimits{MaxParts: 4})
+	assert.ErrorIs(t, err, ErrTooManyParts)
+
+	// Test: Total size over the limit, without leaving temporary files
+	req = multipartRequest(t, func(w *multipart.Writer) {
+		w.WriteField("title", strings.Repeat("t", 40))
+		part, _ := w.CreateFormFile("photo", "large.txt")
+		part.Write([]byte(strings.Repeat("x", 100)))
+	})
+	_, err = req.ParseForm(FormLimits{MaxMemory: 10, MaxSize: 120, TempDir: tempDir})
+	assert.ErrorIs(t, err, ErrFormTooLarge)
+	spilled, _ = os.ReadDir(tempDir)
+	assert.Empty(t, spilled)
+
+	// Test: Missing boundary
+	req = New("POST", "/upload", "")
+	req.Headers.Replace("Content-Type", "multipart/form-data")
+	_, err = req.ParseForm(FormLimits{})
+	assert.ErrorIs(t, err, ErrNotForm)
+}
+
+func TestParseMultipartFormStreamed(t *testing.T) {
+	tempDir := t.TempDir()
+	upload := strings.Repeat("0123456789", 100_000)
+
+	body := &bytes.Buffer{}
+	w := multipart.NewWriter(body)
+	part, _ := w.CreateFormFile("file", "upload.bin")
+	part.Write([]byte(upload))
+	require.NoError(t, w.Close())
+
+	raw := "POST /upload HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"Content-Type: " + w.FormDataContentType() + "\r\n" +
+		"Content-Length: " + strconv.Itoa(body.Len()) + "\r\n" +
+		"\r\n" + body.String() +
+		"GET /next HTTP/1.1\r\n" +
+		"Host: localhost:42069\r\n" +
+		"\r\n"
+	reader := NewReader(&chunkReader{data: raw, numBytesPerRead: 4096})
+
+	// Test: A large upload is left on the connection instead of in Body
+	req, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Empty(t, req.Body)
+	assert.True(t, req.BodyStreamed())
+
+	// Test: ParseForm reads it from the connection and spills the file
+	form, err := req.ParseForm(FormLimits{MaxMemory: 1024, TempDir: tempDir})
+	require.NoError(t, err)
+	require.Len(t, form.Files["file"], 1)
+	spilled, _ := os.ReadDir(tempDir)
+	assert.Len(t, spilled, 1)
+	content, err := form.Files["file"][0].Open()
+	require.NoError(t, err)
+	data, _ := io.ReadAll(content)
+	content.Close()
+	assert.Equal(t, upload, string(data))
+	require.NoError(t, form.RemoveAll())
+
+	// Test: The next pipelined request is parsed after the body
+	req, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", req.RequestLine.RequestTarget)
+
+	// Test: An unread streamed body is skipped
+	reader = NewReader(&chunkReader{data: raw, numBytesPerRead: 4096})
+	_, err = reader.ReadRequest()
+	require.NoError(t, err)
+	req, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/next", req.RequestLine.RequestTarget)
+}
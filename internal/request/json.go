@@ -0,0 +1,73 @@
+package request
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"strings"
+)
+
+var (
+	ErrNotJSON      = errors.New("request body is not JSON")
+	ErrJSONTooLarge = errors.New("JSON body too large")
+	ErrInvalidJSON  = errors.New("invalid JSON body")
+)
+
+// DefaultMaxJSONSize is the body size limit of DecodeJSON when maxSize is
+// not positive.
+const DefaultMaxJSONSize = 1 << 20
+
+// DecodeJSON decodes a JSON body of at most maxSize bytes into v. The
+// Content-Type must be application/json or a +json type, fields not present
+// in v are rejected and the body must hold a single JSON value.
+//
+// A body declared larger than maxSize is rejected before it is read, and no
+// more than maxSize bytes are read from a streamed body. Bodies the Reader
+// buffered into Body were already read in full, within the server's body
+// size limit.
+func (r *Request) DecodeJSON(v any, maxSize int64) error {
+	if !isJSON(r.Headers.Get("Content-Type")) {
+		return ErrNotJSON
+	}
+	if maxSize <= 0 {
+		maxSize = DefaultMaxJSONSize
+	}
+	if r.ContentLength() > maxSize {
+		return ErrJSONTooLarge
+	}
+
+	// Reading one byte past maxSize tells a body that is too large from one
+	// that fits exactly
+	body := &io.LimitedReader{R: r.BodyReader(), N: maxSize + 1}
+	decoder := json.NewDecoder(body)
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		if body.N == 0 {
+			return ErrJSONTooLarge
+		}
+		if err == io.EOF {
+			return fmt.Errorf("%w: empty body", ErrInvalidJSON)
+		}
+		return fmt.Errorf("%w: %w", ErrInvalidJSON, err)
+	}
+	_, err := decoder.Token()
+	if body.N == 0 {
+		return ErrJSONTooLarge
+	}
+	if err != io.EOF {
+		return fmt.Errorf("%w: unexpected data after the JSON value", ErrInvalidJSON)
+	}
+
+	return nil
+}
+
+func isJSON(contentType string) bool {
+	mediaType, _, err := mime.ParseMediaType(contentType)
+	if err != nil {
+		return false
+	}
+
+	return mediaType == "application/json" || strings.HasSuffix(mediaType, "+json")
+}
@@ -2,10 +2,14 @@ package request
 
 import (
 	"bytes"
+	"context"
 	"errors"
+	"fmt"
 	"io"
+	"mime"
 	"regexp"
 	"strconv"
+	"strings"
 
 	"github.com/rmdevio/httpserver/internal/headers"
 )
@@ -16,8 +20,21 @@ type Request struct {
 	RequestLine RequestLine
 	Headers     *headers.Headers
 	Body        string
+	RemoteAddr  string
+	// TLS reports whether the request was received over TLS.
+	TLS bool
 
+	ctx   context.Context
 	state parserState
+	// body collects the body while it is parsed, to avoid copying it for
+	// every chunk read.
+	body []byte
+	// bodyReader is the body of requests whose body is streamed rather than
+	// kept in Body.
+	bodyReader io.Reader
+	streamBody bool
+	// contentLength is the length of the body read from bodyReader.
+	contentLength int64
 }
 
 type RequestLine struct {
@@ -35,12 +52,21 @@ const (
 	StateDone
 )
 
+const (
+	initialBufferSize = 1024
+	// maxBufferSize bounds the bytes buffered while waiting for the end of
+	// the request line or a header line.
+	maxBufferSize = 64 * 1024
+)
+
 var (
 	ErrRequestLineNotFound  = errors.New("request line not found")
 	ErrInvalidRequestLine   = errors.New("invalid request line")
 	ErrMalformedHttpVersion = errors.New("malformed http version")
 	ErrInvalidHttpVersion   = errors.New("invalid http version")
 	ErrInvalidHttpMethod    = errors.New("invalid http method")
+	ErrRequestTooLarge      = errors.New("request line or header too large")
+	ErrBodyTooLarge         = errors.New("request body too large")
 
 	methodRegex   = "^[A-Z]+$"
 	crlfSeparator = []byte("\r\n")
@@ -63,6 +89,100 @@ func newRequest() *Request {
 	}
 }
 
+// New returns a request with the given request line and body, ready to be
+// sent with WriteTo. Content-Length is set when body is not empty.
+func New(method, target, body string) *Request {
+	request := newRequest()
+	request.RequestLine = RequestLine{
+		HttpVersion:   HTTP_VERSION,
+		RequestTarget: target,
+		Method:        method,
+	}
+	request.Body = body
+	request.state = StateDone
+	if body != "" {
+		request.Headers.Replace("Content-Length", strconv.Itoa(len(body)))
+	}
+
+	return request
+}
+
+// Context returns the request's context, which middleware uses to pass
+// values such as the session to the handlers they wrap.
+func (r *Request) Context() context.Context {
+	if r.ctx == nil {
+		return context.Background()
+	}
+
+	return r.ctx
+}
+
+// WithContext returns a shallow copy of r with its context set to ctx.
+func (r *Request) WithContext(ctx context.Context) *Request {
+	r2 := *r
+	r2.ctx = ctx
+
+	return &r2
+}
+
+// BodyReader returns the body of the request. Multipart form bodies are not
+// read into Body by Reader but left on the connection, and can only be read
+// once through BodyReader. Other bodies are read from Body.
+func (r *Request) BodyReader() io.Reader {
+	if r.bodyReader != nil {
+		return r.bodyReader
+	}
+
+	return strings.NewReader(r.Body)
+}
+
+// BodyStreamed reports whether the body is read from BodyReader instead of
+// Body.
+func (r *Request) BodyStreamed() bool {
+	return r.bodyReader != nil
+}
+
+// ContentLength returns the length of the body, including a streamed body
+// that was not read yet.
+func (r *Request) ContentLength() int64 {
+	if r.bodyReader != nil {
+		return r.contentLength
+	}
+
+	return int64(len(r.Body))
+}
+
+// SetBodyReader makes WriteTo send the length bytes of body instead of Body,
+// such as to forward a streamed body, and sets Content-Length to match.
+func (r *Request) SetBodyReader(body io.Reader, length int64) {
+	r.Body = ""
+	r.bodyReader = body
+	r.contentLength = length
+	r.Headers.Replace("Content-Length", strconv.FormatInt(length, 10))
+}
+
+// WriteTo writes the request in HTTP/1.1 wire format.
+func (r *Request) WriteTo(w io.Writer) (int64, error) {
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "%s %s HTTP/%s\r\n", r.RequestLine.Method, r.RequestLine.RequestTarget, r.RequestLine.HttpVersion)
+	r.Headers.ForEachLine(func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	})
+	buf.WriteString("\r\n")
+	if r.bodyReader == nil {
+		buf.WriteString(r.Body)
+		return buf.WriteTo(w)
+	}
+
+	n, err := buf.WriteTo(w)
+	if err != nil {
+		return n, err
+	}
+	copied, err := io.Copy(w, r.bodyReader)
+
+	return n + copied, err
+}
+
 func getIntHeader(headers *headers.Headers, name string, defaultValue int) int {
 	if valueStr := headers.Get(name); valueStr != "" {
 		value, err := strconv.Atoi(valueStr)
@@ -120,6 +240,14 @@ func (r *Request) hasBody() bool {
 	return length > 0
 }
 
+// streamsBody reports whether the body is left for the handler to read
+// through BodyReader. Multipart forms are, so uploads don't have to fit in
+// memory.
+func (r *Request) streamsBody() bool {
+	mediaType, _, _ := mime.ParseMediaType(r.Headers.Get("Content-Type"))
+	return mediaType == "multipart/form-data"
+}
+
 func (r *Request) parse(data []byte) (int, error) {
 	read := 0
 
@@ -158,7 +286,11 @@ outer:
 			read += n
 
 			if done {
-				if r.hasBody() {
+				if r.hasBody() && r.streamsBody() {
+					// Reader hands the body out as a stream
+					r.streamBody = true
+					r.state = StateDone
+				} else if r.hasBody() {
 					r.state = StateParseBody
 				} else {
 					r.state = StateDone
@@ -171,11 +303,13 @@ outer:
 				panic("not implemented")
 			}
 
-			remaining := min(length-len(r.Body), len(currentData))
-			r.Body += string(currentData[:remaining])
+			remaining := min(length-len(r.body), len(currentData))
+			r.body = append(r.body, currentData[:remaining]...)
 			read += remaining
 
-			if len(r.Body) == length {
+			if len(r.body) == length {
+				r.Body = string(r.body)
+				r.body = nil
 				r.state = StateDone
 			}
 
@@ -191,26 +325,153 @@ func (r *Request) done() bool {
 	return r.state == StateDone
 }
 
-func RequestFromReader(reader io.Reader) (*Request, error) {
-	request := newRequest()
+// Reader parses consecutive requests from a single connection. Bytes read
+// past the end of one request are kept for the next, so pipelined requests
+// are not lost.
+type Reader struct {
+	reader      io.Reader
+	buf         []byte
+	bufLen      int
+	maxBodySize int64
+	// pending is the streamed body of the last request, whose unread part
+	// is skipped before the next request.
+	pending *bodyStream
+}
 
-	buf := make([]byte, 1024)
-	bufLen := 0
-	for !request.done() {
-		n, err := reader.Read(buf[bufLen:])
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		reader: reader,
+		buf:    make([]byte, initialBufferSize),
+	}
+}
+
+// Buffered returns the number of bytes read from the connection that belong
+// to requests not returned yet.
+func (r *Reader) Buffered() int {
+	return r.bufLen
+}
+
+// SetMaxBodySize makes ReadRequest fail with ErrBodyTooLarge, before the
+// body is read, for requests whose Content-Length exceeds n. Zero means no
+// limit.
+func (r *Reader) SetMaxBodySize(n int64) {
+	r.maxBodySize = n
+}
+
+// Read reads the raw bytes following the last request returned, starting
+// with the buffered ones. It is meant for connections that switch away from
+// HTTP, such as after a hijack.
+func (r *Reader) Read(p []byte) (int, error) {
+	if r.bufLen == 0 {
+		return r.reader.Read(p)
+	}
+
+	n := copy(p, r.buf[:r.bufLen])
+	copy(r.buf, r.buf[n:r.bufLen])
+	r.bufLen -= n
+
+	return n, nil
+}
+
+// ReadRequest parses the next request. It returns io.EOF if the connection
+// was closed cleanly between requests and io.ErrUnexpectedEOF if it was
+// closed in the middle of one.
+func (r *Reader) ReadRequest() (*Request, error) {
+	if r.pending != nil {
+		_, err := io.Copy(io.Discard, r.pending)
+		r.pending = nil
+		if errors.Is(err, io.ErrUnexpectedEOF) {
+			// The client went away in the middle of the previous body
+			return nil, io.EOF
+		}
 		if err != nil {
 			return nil, err
 		}
+	}
+
+	request := newRequest()
+
+	if err := r.consume(request); err != nil {
+		return nil, err
+	}
+
+	for !request.done() {
+		if r.bufLen == len(r.buf) {
+			if len(r.buf) >= maxBufferSize {
+				return nil, ErrRequestTooLarge
+			}
+			r.buf = append(r.buf, make([]byte, len(r.buf))...)
+		}
 
-		bufLen += n
-		readN, err := request.parse(buf[:bufLen])
-		if err != nil {
+		n, readErr := r.reader.Read(r.buf[r.bufLen:])
+		r.bufLen += n
+
+		if err := r.consume(request); err != nil {
 			return nil, err
 		}
 
-		copy(buf, buf[readN:bufLen])
-		bufLen -= readN
+		if readErr != nil && !request.done() {
+			if readErr == io.EOF && (request.state != StateInit || r.bufLen > 0) {
+				return nil, io.ErrUnexpectedEOF
+			}
+			return nil, readErr
+		}
+	}
+
+	if request.streamBody {
+		request.contentLength = int64(getIntHeader(request.Headers, "content-length", 0))
+		r.pending = &bodyStream{
+			reader:    r,
+			remaining: request.contentLength,
+		}
+		request.bodyReader = r.pending
 	}
 
 	return request, nil
 }
+
+// bodyStream reads a request body from the connection, starting with the
+// bytes the Reader already buffered.
+type bodyStream struct {
+	reader    *Reader
+	remaining int64
+}
+
+func (b *bodyStream) Read(p []byte) (int, error) {
+	if b.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > b.remaining {
+		p = p[:b.remaining]
+	}
+
+	n, err := b.reader.Read(p)
+	b.remaining -= int64(n)
+	if err == io.EOF && b.remaining > 0 {
+		err = io.ErrUnexpectedEOF
+	}
+
+	return n, err
+}
+
+// consume feeds the buffered bytes to the request parser and drops the ones
+// it used.
+func (r *Reader) consume(request *Request) error {
+	readN, err := request.parse(r.buf[:r.bufLen])
+	if err != nil {
+		return err
+	}
+	if r.maxBodySize > 0 && request.state >= StateParseBody &&
+		int64(getIntHeader(request.Headers, "content-length", 0)) > r.maxBodySize {
+		return ErrBodyTooLarge
+	}
+
+	copy(r.buf, r.buf[readN:r.bufLen])
+	r.bufLen -= readN
+
+	return nil
+}
+
+func RequestFromReader(reader io.Reader) (*Request, error) {
+	return NewReader(reader).ReadRequest()
+}
@@ -2,6 +2,7 @@ package request
 
 import (
 	"io"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -105,3 +106,79 @@ func TestParseBody(t *testing.T) {
 	r, err = RequestFromReader(reader)
 	require.Error(t, err)
 }
+
+func TestPipelinedRequests(t *testing.T) {
+	// Test: Several requests in a single write are all returned in order
+	reader := NewReader(&chunkReader{
+		data: "GET /one HTTP/1.1\r\nHost: localhost:42069\r\n\r\n" +
+			"POST /two HTTP/1.1\r\nHost: localhost:42069\r\nContent-Length: 5\r\n\r\nhello" +
+			"GET /three HTTP/1.1\r\nHost: localhost:42069\r\n\r\n",
+		numBytesPerRead: 4096,
+	})
+
+	r, err := reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/one", r.RequestLine.RequestTarget)
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/two", r.RequestLine.RequestTarget)
+	assert.Equal(t, "hello", r.Body)
+
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Equal(t, "/three", r.RequestLine.RequestTarget)
+	assert.Equal(t, 0, reader.Buffered())
+
+	// Test: Clean close between requests
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Close in the middle of a request
+	reader = NewReader(&chunkReader{
+		data:            "GET /one HTTP/1.1\r\nHost: localhost:42069\r\n\r\nGET /two HTTP/1.1\r\n",
+		numBytesPerRead: 7,
+	})
+	_, err = reader.ReadRequest()
+	require.NoError(t, err)
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Bytes after a request can be read raw, buffered ones first
+	reader = NewReader(&chunkReader{
+		data:            "GET /upgrade HTTP/1.1\r\nHost: localhost:42069\r\n\r\nraw bytes",
+		numBytesPerRead: 4096,
+	})
+	_, err = reader.ReadRequest()
+	require.NoError(t, err)
+	raw, err := io.ReadAll(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "raw bytes", string(raw))
+
+	// Test: Header lines longer than the initial buffer
+	reader = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 4000) + "\r\n\r\n",
+		numBytesPerRead: 512,
+	})
+	r, err = reader.ReadRequest()
+	require.NoError(t, err)
+	assert.Len(t, r.Headers.Get("X-Long"), 4000)
+
+	// Test: Header lines longer than the maximum buffer
+	reader = NewReader(&chunkReader{
+		data:            "GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", maxBufferSize) + "\r\n\r\n",
+		numBytesPerRead: 4096,
+	})
+	_, err = reader.ReadRequest()
+	assert.ErrorIs(t, err, ErrRequestTooLarge)
+}
+
+func TestCookies(t *testing.T) {
+	// Test: Cookies are looked up by name
+	req := New("GET", "/", "")
+	req.Headers.Set("Cookie", "session=abc; theme=dark")
+	require.NotNil(t, req.Cookie("theme"))
+	assert.Equal(t, "dark", req.Cookie("theme").Value)
+	assert.Len(t, req.Cookies(), 2)
+	assert.Nil(t, req.Cookie("missing"))
+}
@@ -0,0 +1,14 @@
+package response
+
+import "github.com/rmdevio/httpserver/internal/cookie"
+
+// SetCookie adds a Set-Cookie header for c to the response, to be written
+// with the headers. It fails without adding anything if c is invalid.
+func (w *Writer) SetCookie(c *cookie.Cookie) error {
+	if err := c.Validate(); err != nil {
+		return err
+	}
+	w.state.header.Set("Set-Cookie", c.String())
+
+	return nil
+}
@@ -0,0 +1,38 @@
+package response
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/cookie"
+	"github.com/rmdevio/httpserver/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetCookie(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w := NewWriter(buf)
+
+	// Test: Each cookie is written on its own Set-Cookie line, next to the
+	// ones the handler set itself
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "session", Value: "abc", HttpOnly: true}))
+	require.NoError(t, w.SetCookie(&cookie.Cookie{Name: "theme", Value: "dark"}))
+	h := headers.NewHeaders()
+	h.Set("Set-Cookie", "lang=en")
+	require.NoError(t, w.WriteStatusLine(StatusOk))
+	require.NoError(t, w.WriteHeaders(h))
+
+	out := buf.String()
+	assert.Contains(t, out, "set-cookie:lang=en\r\n")
+	assert.Contains(t, out, "set-cookie:session=abc; HttpOnly\r\n")
+	assert.Contains(t, out, "set-cookie:theme=dark\r\n")
+
+	// Test: Invalid cookies are not added
+	assert.ErrorIs(t, w.SetCookie(&cookie.Cookie{Name: "bad;name"}), cookie.ErrInvalidName)
+
+	// Test: Parsed responses keep every Set-Cookie value
+	res, err := NewReader(buf).ReadResponse("GET")
+	require.NoError(t, err)
+	assert.ElementsMatch(t, []string{"lang=en", "session=abc; HttpOnly", "theme=dark"}, res.Headers.Values("Set-Cookie"))
+}
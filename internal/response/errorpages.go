@@ -0,0 +1,111 @@
+package response
+
+import (
+	"bytes"
+	"html/template"
+	"io/fs"
+	"sync"
+)
+
+// DefaultErrorPages renders error pages for writers without their own.
+var DefaultErrorPages = NewErrorPages()
+
+var defaultErrorPage = template.Must(template.New("error").Parse(`<html>
+  <head>
+    <title>{{.Status}} {{.Title}}</title>
+  </head>
+  <body>
+    <h1>{{.Title}}</h1>
+{{- with .Detail}}
+    <p>{{.}}</p>
+{{- end}}
+  </body>
+</html>
+`))
+
+// ErrorPages holds the HTML pages of error responses by status. Pages are
+// html/template templates executed with the *Problem being answered. It is
+// safe for concurrent use.
+type ErrorPages struct {
+	mu    sync.RWMutex
+	pages map[StatusCode]*template.Template
+}
+
+// NewErrorPages returns pages holding the default page for every 4xx and
+// 5xx status in the status registry.
+func NewErrorPages() *ErrorPages {
+	p := &ErrorPages{pages: make(map[StatusCode]*template.Template)}
+	for status := range statusText {
+		if status >= 400 && status < 600 {
+			p.pages[status] = defaultErrorPage
+		}
+	}
+
+	return p
+}
+
+// Register sets the page for status.
+func (p *ErrorPages) Register(status StatusCode, page *template.Template) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pages[status] = page
+}
+
+// RegisterFile sets the page for status to the template in the file at
+// path.
+func (p *ErrorPages) RegisterFile(status StatusCode, path string) error {
+	page, err := template.ParseFiles(path)
+	if err != nil {
+		return err
+	}
+	p.Register(status, page)
+
+	return nil
+}
+
+// RegisterFS sets the page for status to the template named name in fsys,
+// such as an embed.FS.
+func (p *ErrorPages) RegisterFS(status StatusCode, fsys fs.FS, name string) error {
+	page, err := template.ParseFS(fsys, name)
+	if err != nil {
+		return err
+	}
+	p.Register(status, page)
+
+	return nil
+}
+
+// Replace swaps every page for those of other, so writers already holding p
+// render the new pages, such as after a configuration reload.
+func (p *ErrorPages) Replace(other *ErrorPages) {
+	other.mu.RLock()
+	pages := make(map[StatusCode]*template.Template, len(other.pages))
+	for status, page := range other.pages {
+		pages[status] = page
+	}
+	other.mu.RUnlock()
+
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	p.pages = pages
+}
+
+// Render executes the page for the problem's status, or the default page if
+// none is registered.
+func (p *ErrorPages) Render(problem *Problem) ([]byte, error) {
+	p.mu.RLock()
+	page, ok := p.pages[problem.Status]
+	p.mu.RUnlock()
+	if !ok {
+		page = defaultErrorPage
+	}
+
+	var buf bytes.Buffer
+	if err := page.Execute(&buf, problem); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,37 @@
+package response
+
+import (
+	"encoding/json"
+	"strconv"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+)
+
+// WriteJSON writes a complete response with v encoded as JSON and the
+// matching Content-Type and Content-Length headers. Nothing is written if v
+// can't be encoded.
+func (w *Writer) WriteJSON(status StatusCode, v any) error {
+	return w.writeJSON(status, "application/json", v)
+}
+
+func (w *Writer) writeJSON(status StatusCode, contentType string, v any) error {
+	body, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	body = append(body, '\n')
+
+	h := headers.NewHeaders()
+	h.Set("Content-Type", contentType)
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+
+	if err := w.WriteStatusLine(status); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	_, err = w.WriteBody(body)
+
+	return err
+}
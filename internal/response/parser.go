@@ -0,0 +1,444 @@
+package response
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+)
+
+type parserState int
+
+type Response struct {
+	StatusLine StatusLine
+	Headers    *headers.Headers
+	Body       string
+	Trailers   *headers.Headers
+	// Interim holds the 1xx informational responses, such as 100 Continue or
+	// 103 Early Hints, received before the final response.
+	Interim []*Response
+
+	state          parserState
+	noBody         bool
+	closeDelimited bool
+	bodyRemaining  int
+	body           strings.Builder
+	onHeaders      func(*Response) (io.Writer, error)
+	bodyWriter     io.Writer
+}
+
+type StatusLine struct {
+	HttpVersion  string
+	StatusCode   StatusCode
+	ReasonPhrase string
+}
+
+const (
+	StateInit parserState = iota
+	StateParseHeader
+	StateParseBody
+	StateParseChunkSize
+	StateParseChunkData
+	StateParseChunkEnd
+	StateParseTrailer
+	StateParseBodyUntilClose
+	StateDone
+)
+
+const (
+	initialBufferSize = 1024
+	maxBufferSize     = 64 * 1024
+)
+
+var (
+	ErrInvalidStatusLine    = errors.New("invalid status line")
+	ErrMalformedHttpVersion = errors.New("malformed http version")
+	ErrInvalidHttpVersion   = errors.New("invalid http version")
+	ErrInvalidReasonPhrase  = errors.New("invalid reason phrase")
+	ErrInvalidStatusCode    = errors.New("invalid status code")
+	ErrInvalidContentLength = errors.New("invalid content length")
+	ErrInvalidChunk         = errors.New("invalid chunk")
+	ErrResponseTooLarge     = errors.New("status line or header too large")
+
+	crlfSeparator = []byte("\r\n")
+)
+
+func newResponse(method string) *Response {
+	return &Response{
+		state:    StateInit,
+		Headers:  headers.NewHeaders(),
+		Trailers: headers.NewHeaders(),
+		noBody:   method == "HEAD",
+	}
+}
+
+func parseStatusLine(data []byte) (StatusLine, int, error) {
+	idx := bytes.Index(data, crlfSeparator)
+	if idx == -1 {
+		return StatusLine{}, 0, nil
+	}
+
+	statusLine := data[:idx]
+	read := idx + len(crlfSeparator)
+
+	// The reason phrase may contain spaces or be empty
+	parts := bytes.SplitN(statusLine, []byte(" "), 3)
+	if len(parts) < 2 {
+		return StatusLine{}, 0, ErrInvalidStatusLine
+	}
+
+	httpVersionParts := bytes.Split(parts[0], []byte("/"))
+	if len(httpVersionParts) != 2 || string(httpVersionParts[0]) != "HTTP" {
+		return StatusLine{}, 0, ErrMalformedHttpVersion
+	}
+
+	// Check if HTTP version is 1.0 or 1.1
+	httpVersion := string(httpVersionParts[1])
+	if httpVersion != "1.1" && httpVersion != "1.0" {
+		return StatusLine{}, 0, ErrInvalidHttpVersion
+	}
+
+	if len(parts[1]) != 3 {
+		return StatusLine{}, 0, ErrInvalidStatusCode
+	}
+	code, err := strconv.Atoi(string(parts[1]))
+	if err != nil || code < 100 {
+		return StatusLine{}, 0, ErrInvalidStatusCode
+	}
+
+	var reason string
+	if len(parts) == 3 {
+		reason = string(parts[2])
+		if !validReasonPhrase(reason) {
+			return StatusLine{}, 0, ErrInvalidReasonPhrase
+		}
+	}
+
+	return StatusLine{
+		HttpVersion:  httpVersion,
+		StatusCode:   StatusCode(code),
+		ReasonPhrase: reason,
+	}, read, nil
+}
+
+// validReasonPhrase checks the reason phrase only contains tabs, spaces and
+// visible characters.
+func validReasonPhrase(reason string) bool {
+	for i := 0; i < len(reason); i++ {
+		ch := reason[i]
+		if ch != '\t' && (ch < ' ' || ch == 0x7f) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// parseContentLength parses a Content-Length value. Repeated identical values
+// ("5, 5"), produced when the header was sent more than once, are accepted.
+func parseContentLength(value string) (int, error) {
+	length := -1
+	for _, part := range strings.Split(value, ",") {
+		n, err := strconv.Atoi(strings.TrimSpace(part))
+		if err != nil || n < 0 || (length != -1 && n != length) {
+			return 0, ErrInvalidContentLength
+		}
+		length = n
+	}
+
+	return length, nil
+}
+
+// bodyState decides how the body is framed once the headers are parsed.
+func (r *Response) bodyState() (parserState, error) {
+	// Responses to HEAD, 1xx, 204 and 304 never have a body, whatever their
+	// headers say
+	code := r.StatusLine.StatusCode
+	if r.noBody || code < 200 || code == StatusNoContent || code == StatusNotModified {
+		return StateDone, nil
+	}
+
+	if te := r.Headers.Tokens("Transfer-Encoding"); len(te) > 0 {
+		if te[len(te)-1] == "chunked" {
+			return StateParseChunkSize, nil
+		}
+		// Any other final coding leaves the body to run until the
+		// connection closes, whatever Content-Length says (RFC 9112 §6.3)
+		r.closeDelimited = true
+		return StateParseBodyUntilClose, nil
+	}
+
+	if cl := r.Headers.Get("Content-Length"); cl != "" {
+		length, err := parseContentLength(cl)
+		if err != nil {
+			return 0, err
+		}
+		if length == 0 {
+			return StateDone, nil
+		}
+
+		r.bodyRemaining = length
+		return StateParseBody, nil
+	}
+
+	r.closeDelimited = true
+	return StateParseBodyUntilClose, nil
+}
+
+func (r *Response) parse(data []byte) (int, error) {
+	read := 0
+
+outer:
+	for {
+		currentData := data[read:]
+		if r.state == StateDone || len(currentData) == 0 {
+			break
+		}
+
+		switch r.state {
+		case StateInit:
+			statusLine, n, err := parseStatusLine(currentData)
+			if err != nil {
+				return 0, err
+			}
+
+			if n == 0 {
+				break outer
+			}
+
+			r.StatusLine = statusLine
+			read += n
+
+			r.state = StateParseHeader
+		case StateParseHeader:
+			n, done, err := r.Headers.Parse(currentData)
+			if err != nil {
+				return 0, err
+			}
+
+			if n == 0 {
+				break outer
+			}
+
+			read += n
+
+			if done && r.interim() {
+				// Keep the informational response and wait for the next one
+				r.Interim = append(r.Interim, &Response{
+					StatusLine: r.StatusLine,
+					Headers:    r.Headers,
+					Trailers:   headers.NewHeaders(),
+					state:      StateDone,
+				})
+				r.StatusLine = StatusLine{}
+				r.Headers = headers.NewHeaders()
+				r.state = StateInit
+			} else if done {
+				state, err := r.bodyState()
+				if err != nil {
+					return 0, err
+				}
+				r.state = state
+
+				if r.onHeaders != nil {
+					if r.bodyWriter, err = r.onHeaders(r); err != nil {
+						return 0, err
+					}
+				}
+			}
+
+		case StateParseBody, StateParseChunkData:
+			remaining := min(r.bodyRemaining, len(currentData))
+			if err := r.writeBody(currentData[:remaining]); err != nil {
+				return 0, err
+			}
+			r.bodyRemaining -= remaining
+			read += remaining
+
+			if r.bodyRemaining == 0 {
+				if r.state == StateParseBody {
+					r.state = StateDone
+				} else {
+					r.state = StateParseChunkEnd
+				}
+			}
+
+		case StateParseChunkSize:
+			idx := bytes.Index(currentData, crlfSeparator)
+			if idx == -1 {
+				break outer
+			}
+
+			// Chunk extensions are ignored
+			sizeStr, _, _ := strings.Cut(string(currentData[:idx]), ";")
+			// ParseUint, unlike ParseInt, rejects a sign before the digits
+			size, err := strconv.ParseUint(strings.TrimSpace(sizeStr), 16, 63)
+			if err != nil {
+				return 0, ErrInvalidChunk
+			}
+			read += idx + len(crlfSeparator)
+
+			if size == 0 {
+				r.state = StateParseTrailer
+			} else {
+				r.bodyRemaining = int(size)
+				r.state = StateParseChunkData
+			}
+
+		case StateParseChunkEnd:
+			if len(currentData) < len(crlfSeparator) {
+				break outer
+			}
+			if !bytes.HasPrefix(currentData, crlfSeparator) {
+				return 0, ErrInvalidChunk
+			}
+
+			read += len(crlfSeparator)
+			r.state = StateParseChunkSize
+
+		case StateParseTrailer:
+			n, done, err := r.Trailers.Parse(currentData)
+			if err != nil {
+				return 0, err
+			}
+
+			if n == 0 {
+				break outer
+			}
+
+			read += n
+
+			if done {
+				r.state = StateDone
+			}
+
+		case StateParseBodyUntilClose:
+			if err := r.writeBody(currentData); err != nil {
+				return 0, err
+			}
+			read += len(currentData)
+		}
+	}
+
+	return read, nil
+}
+
+// interim reports whether the parsed status line is an informational
+// response that precedes the final one. 101 Switching Protocols is final
+// since the connection stops speaking HTTP/1.1 afterwards.
+func (r *Response) interim() bool {
+	code := r.StatusLine.StatusCode
+	return code >= 100 && code < 200 && code != StatusSwitchingProtocols
+}
+
+func (r *Response) writeBody(p []byte) error {
+	if r.bodyWriter != nil {
+		_, err := r.bodyWriter.Write(p)
+		return err
+	}
+
+	r.body.Write(p)
+	return nil
+}
+
+func (r *Response) done() bool {
+	return r.state == StateDone
+}
+
+// Reader parses consecutive responses from a single connection, keeping bytes
+// read past the end of one response for the next.
+type Reader struct {
+	reader io.Reader
+	buf    []byte
+	bufLen int
+}
+
+func NewReader(reader io.Reader) *Reader {
+	return &Reader{
+		reader: reader,
+		buf:    make([]byte, initialBufferSize),
+	}
+}
+
+// ReadResponse parses the next response. method is the method of the request
+// being answered; responses to HEAD never have a body.
+func (r *Reader) ReadResponse(method string) (*Response, error) {
+	return r.readResponse(newResponse(method))
+}
+
+// StreamResponse parses the next response like ReadResponse but does not
+// buffer the body. onHeaders is called once the final status line and
+// headers are parsed, and the body is written to the writer it returns as it
+// arrives. Trailers are available on the returned response.
+func (r *Reader) StreamResponse(method string, onHeaders func(*Response) (io.Writer, error)) (*Response, error) {
+	response := newResponse(method)
+	response.onHeaders = onHeaders
+
+	return r.readResponse(response)
+}
+
+func (r *Reader) readResponse(response *Response) (*Response, error) {
+	if err := r.consume(response); err != nil {
+		return nil, err
+	}
+
+	for !response.done() {
+		if r.bufLen == len(r.buf) {
+			if len(r.buf) >= maxBufferSize {
+				return nil, ErrResponseTooLarge
+			}
+			r.buf = append(r.buf, make([]byte, len(r.buf))...)
+		}
+
+		n, readErr := r.reader.Read(r.buf[r.bufLen:])
+		r.bufLen += n
+
+		if err := r.consume(response); err != nil {
+			return nil, err
+		}
+
+		if readErr != nil && !response.done() {
+			if readErr == io.EOF {
+				// The body runs until the connection is closed
+				if response.state == StateParseBodyUntilClose {
+					response.state = StateDone
+					break
+				}
+				if response.state != StateInit || r.bufLen > 0 {
+					return nil, io.ErrUnexpectedEOF
+				}
+			}
+			return nil, readErr
+		}
+	}
+	response.Body = response.body.String()
+
+	return response, nil
+}
+
+func (r *Reader) consume(response *Response) error {
+	readN, err := response.parse(r.buf[:r.bufLen])
+	if err != nil {
+		return err
+	}
+
+	copy(r.buf, r.buf[readN:r.bufLen])
+	r.bufLen -= readN
+
+	return nil
+}
+
+// CloseDelimited reports whether the body of the response ran until the
+// connection was closed, in which case the connection cannot be reused.
+func (r *Response) CloseDelimited() bool {
+	return r.closeDelimited
+}
+
+// ResponseFromReader parses a single response to a request that is not HEAD.
+// Use a Reader to parse consecutive responses or responses to HEAD.
+func ResponseFromReader(reader io.Reader) (*Response, error) {
+	return NewReader(reader).ReadResponse("GET")
+}
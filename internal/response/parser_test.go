@@ -0,0 +1,260 @@
+package response
+
+import (
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type chunkReader struct {
+	data            string
+	numBytesPerRead int
+	pos             int
+}
+
+// Read reads up to len(p) or numBytesPerRead bytes from the string per call
+// its useful for simulating reading a variable number of bytes per chunk from a network connection
+func (cr *chunkReader) Read(p []byte) (n int, err error) {
+	if cr.pos >= len(cr.data) {
+		return 0, io.EOF
+	}
+	endIndex := cr.pos + cr.numBytesPerRead
+	if endIndex > len(cr.data) {
+		endIndex = len(cr.data)
+	}
+	n = copy(p, cr.data[cr.pos:endIndex])
+	cr.pos += n
+
+	return n, nil
+}
+
+func TestStatusLineParse(t *testing.T) {
+	// Test: Good status line
+	reader := &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	require.NotNil(t, r)
+	assert.Equal(t, "1.1", r.StatusLine.HttpVersion)
+	assert.Equal(t, StatusOk, r.StatusLine.StatusCode)
+	assert.Equal(t, "OK", r.StatusLine.ReasonPhrase)
+
+	// Test: Reason phrase with spaces
+	reader = &chunkReader{
+		data:            "HTTP/1.1 404 Not Found At All\r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 1,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, StatusNotFound, r.StatusLine.StatusCode)
+	assert.Equal(t, "Not Found At All", r.StatusLine.ReasonPhrase)
+
+	// Test: Empty reason phrase
+	reader = &chunkReader{
+		data:            "HTTP/1.0 500 \r\nContent-Length: 0\r\n\r\n",
+		numBytesPerRead: 4,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0", r.StatusLine.HttpVersion)
+	assert.Equal(t, StatusInternalServerError, r.StatusLine.StatusCode)
+	assert.Equal(t, "", r.StatusLine.ReasonPhrase)
+
+	// Test: Invalid status code
+	reader = &chunkReader{
+		data:            "HTTP/1.1 2000 OK\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	assert.ErrorIs(t, err, ErrInvalidStatusCode)
+
+	// Test: Invalid http version
+	reader = &chunkReader{
+		data:            "HTTP/2.0 200 OK\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	assert.ErrorIs(t, err, ErrInvalidHttpVersion)
+
+	// Test: Control characters in reason phrase
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 O\x01K\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	assert.ErrorIs(t, err, ErrInvalidReasonPhrase)
+}
+
+func TestResponseBody(t *testing.T) {
+	// Test: Content-Length body
+	reader := &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 13\r\n\r\nhello world!\n",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello world!\n", r.Body)
+	assert.False(t, r.CloseDelimited())
+
+	// Test: Repeated identical Content-Length values
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Length: 2\r\n\r\nhi",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hi", r.Body)
+
+	// Test: Conflicting Content-Length values
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 2\r\nContent-Length: 3\r\n\r\nhi",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	assert.ErrorIs(t, err, ErrInvalidContentLength)
+
+	// Test: Body shorter than reported content length
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Length: 20\r\n\r\npartial content",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	assert.ErrorIs(t, err, io.ErrUnexpectedEOF)
+
+	// Test: Chunked body with extensions and trailers
+	reader = &chunkReader{
+		data: "HTTP/1.1 200 OK\r\n" +
+			"Transfer-Encoding: chunked\r\n" +
+			"Trailer: X-Checksum\r\n" +
+			"\r\n" +
+			"5;name=value\r\nhello\r\n" +
+			"7\r\n, world\r\n" +
+			"0\r\n" +
+			"X-Checksum: abc123\r\n" +
+			"\r\n",
+		numBytesPerRead: 2,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "hello, world", r.Body)
+	assert.Equal(t, "abc123", r.Trailers.Get("X-Checksum"))
+
+	// Test: Malformed chunk size
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\nzz\r\n",
+		numBytesPerRead: 3,
+	}
+	_, err = ResponseFromReader(reader)
+	assert.ErrorIs(t, err, ErrInvalidChunk)
+
+	// Test: Signed chunk sizes are malformed
+	for _, size := range []string{"+5", "-5"} {
+		reader = &chunkReader{
+			data:            "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked\r\n\r\n" + size + "\r\nhello\r\n0\r\n\r\n",
+			numBytesPerRead: 3,
+		}
+		_, err = ResponseFromReader(reader)
+		assert.ErrorIs(t, err, ErrInvalidChunk)
+	}
+
+	// Test: Body delimited by connection close
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nContent-Type: text/plain\r\n\r\nuntil the end",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", r.Body)
+	assert.True(t, r.CloseDelimited())
+
+	// Test: A final transfer coding other than chunked delimits the body by
+	// connection close, ignoring Content-Length
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nTransfer-Encoding: gzip\r\nContent-Length: 4\r\n\r\nuntil the end",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "until the end", r.Body)
+	assert.True(t, r.CloseDelimited())
+
+	reader = &chunkReader{
+		data:            "HTTP/1.1 200 OK\r\nTransfer-Encoding: chunked, gzip\r\n\r\n5\r\nhello\r\n0\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, "5\r\nhello\r\n0\r\n\r\n", r.Body)
+	assert.True(t, r.CloseDelimited())
+}
+
+func TestNoBodyResponses(t *testing.T) {
+	// Test: HEAD responses ignore Content-Length
+	reader := NewReader(&chunkReader{
+		data: "HTTP/1.1 200 OK\r\nContent-Length: 100\r\n\r\n" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 2\r\n\r\nok",
+		numBytesPerRead: 5,
+	})
+	r, err := reader.ReadResponse("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "100", r.Headers.Get("Content-Length"))
+	assert.Equal(t, "", r.Body)
+	r, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, "ok", r.Body)
+
+	// Test: 204 and 304 have no body
+	reader = NewReader(&chunkReader{
+		data: "HTTP/1.1 204 No Content\r\n\r\n" +
+			"HTTP/1.1 304 Not Modified\r\nContent-Length: 10\r\n\r\n" +
+			"HTTP/1.1 200 OK\r\nContent-Length: 4\r\n\r\ndone",
+		numBytesPerRead: 64,
+	})
+	r, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusNoContent, r.StatusLine.StatusCode)
+	r, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, StatusNotModified, r.StatusLine.StatusCode)
+	assert.Equal(t, "", r.Body)
+	r, err = reader.ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, "done", r.Body)
+
+	// Test: Clean close between responses
+	_, err = reader.ReadResponse("GET")
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestInterimResponses(t *testing.T) {
+	// Test: 1xx responses are collected before the final response
+	reader := &chunkReader{
+		data: "HTTP/1.1 100 Continue\r\n\r\n" +
+			"HTTP/1.1 103 Early Hints\r\nLink: </style.css>; rel=preload\r\n\r\n" +
+			"HTTP/1.1 201 Created\r\nContent-Length: 2\r\n\r\nok",
+		numBytesPerRead: 3,
+	}
+	r, err := ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, StatusCreated, r.StatusLine.StatusCode)
+	assert.Equal(t, "ok", r.Body)
+	require.Len(t, r.Interim, 2)
+	assert.Equal(t, StatusContinue, r.Interim[0].StatusLine.StatusCode)
+	assert.Equal(t, StatusEarlyHints, r.Interim[1].StatusLine.StatusCode)
+	assert.Equal(t, "</style.css>; rel=preload", r.Interim[1].Headers.Get("Link"))
+	assert.Equal(t, "", r.Headers.Get("Link"))
+
+	// Test: 101 Switching Protocols is final
+	reader = &chunkReader{
+		data:            "HTTP/1.1 101 Switching Protocols\r\nUpgrade: websocket\r\n\r\n",
+		numBytesPerRead: 3,
+	}
+	r, err = ResponseFromReader(reader)
+	require.NoError(t, err)
+	assert.Equal(t, StatusSwitchingProtocols, r.StatusLine.StatusCode)
+	assert.Empty(t, r.Interim)
+}
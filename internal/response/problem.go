@@ -0,0 +1,147 @@
+package response
+
+import (
+	"encoding/json"
+	"mime"
+	"strconv"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+)
+
+// Problem is an RFC 9457 problem details object describing an error. It
+// implements error so handlers can return it.
+type Problem struct {
+	Type     string
+	Title    string
+	Status   StatusCode
+	Detail   string
+	Instance string
+	// Extensions are additional members serialized next to the standard
+	// ones, which take precedence over extensions of the same name.
+	Extensions map[string]any
+}
+
+// NewProblem returns a problem for status, titled with its reason phrase.
+func NewProblem(status StatusCode, detail string) *Problem {
+	return &Problem{
+		Title:  StatusText(status),
+		Status: status,
+		Detail: detail,
+	}
+}
+
+// With sets the extension member name to value and returns p.
+func (p *Problem) With(name string, value any) *Problem {
+	if p.Extensions == nil {
+		p.Extensions = make(map[string]any)
+	}
+	p.Extensions[name] = value
+
+	return p
+}
+
+func (p *Problem) Error() string {
+	if p.Detail == "" {
+		return p.Title
+	}
+
+	return p.Title + ": " + p.Detail
+}
+
+func (p *Problem) MarshalJSON() ([]byte, error) {
+	n := p.normalized()
+	members := make(map[string]any, len(n.Extensions)+5)
+	for name, value := range n.Extensions {
+		members[name] = value
+	}
+	for name, value := range map[string]string{
+		"type":     n.Type,
+		"title":    n.Title,
+		"detail":   n.Detail,
+		"instance": n.Instance,
+	} {
+		if value != "" {
+			members[name] = value
+		} else {
+			delete(members, name)
+		}
+	}
+	members["status"] = n.Status
+
+	return json.Marshal(members)
+}
+
+// normalized returns a copy of p with the status defaulting to 500 and the
+// title to the status's reason phrase.
+func (p *Problem) normalized() Problem {
+	n := *p
+	if n.Status == 0 {
+		n.Status = StatusInternalServerError
+	}
+	if n.Title == "" {
+		n.Title = StatusText(n.Status)
+	}
+
+	return n
+}
+
+// WriteProblem writes p as a complete response. It is rendered with the
+// writer's error pages if accept, the request's Accept header, prefers HTML
+// over JSON, and as application/problem+json otherwise.
+func (w *Writer) WriteProblem(p *Problem, accept string) error {
+	page := p.normalized()
+	if !prefersHTML(accept) {
+		return w.writeJSON(page.Status, "application/problem+json", p)
+	}
+
+	body, err := w.errorPages().Render(&page)
+	if err != nil {
+		return err
+	}
+
+	h := headers.NewHeaders()
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	h.Set("Content-Length", strconv.Itoa(len(body)))
+	if err := w.WriteStatusLine(page.Status); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	_, err = w.WriteBody(body)
+
+	return err
+}
+
+// prefersHTML reports whether an Accept header gives HTML a higher quality
+// than JSON. Without an Accept header JSON is preferred.
+func prefersHTML(accept string) bool {
+	htmlQ, jsonQ, anyQ := -1.0, -1.0, -1.0
+	for _, item := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(item))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			if q, err = strconv.ParseFloat(value, 64); err != nil {
+				continue
+			}
+		}
+
+		switch mediaType {
+		case "text/html", "application/xhtml+xml":
+			htmlQ = max(htmlQ, q)
+		case "application/problem+json", "application/json":
+			jsonQ = max(jsonQ, q)
+		case "*/*", "application/*":
+			anyQ = max(anyQ, q)
+		}
+	}
+	if jsonQ < 0 {
+		jsonQ = anyQ
+	}
+
+	return htmlQ > 0 && htmlQ > jsonQ
+}
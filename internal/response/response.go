@@ -1,44 +1,126 @@
 package response
 
 import (
+	"bufio"
+	"errors"
 	"fmt"
 	"io"
+	"net"
 	"strconv"
 
 	"github.com/rmdevio/httpserver/internal/headers"
 )
 
-type StatusCode int
+var ErrNotHijackable = errors.New("response: connection can't be hijacked")
 
-const (
-	StatusOk                  StatusCode = 200
-	StatusBadRequest          StatusCode = 400
-	StatusInternalServerError StatusCode = 500
-)
+// Hijacker hands the connection behind a Writer over to the caller,
+// together with a reader holding any bytes already received.
+type Hijacker func() (net.Conn, *bufio.ReadWriter, error)
 
 type Writer struct {
 	writer io.Writer
+	state  *writerState
+}
+
+// writerState is shared by every copy of a Writer so that middleware wrapping
+// a handler can observe what the handler wrote.
+type writerState struct {
+	statusCode     StatusCode
+	bytesWritten   int64
+	header         *headers.Headers
+	headersWritten bool
+	connClose      bool
+	hijacker       Hijacker
+	hijacked       bool
+	errorPages     *ErrorPages
+	beforeHeaders  []func()
 }
 
 func NewWriter(writer io.Writer) Writer {
 	return Writer{
 		writer: writer,
+		state: &writerState{
+			header: headers.NewHeaders(),
+		},
 	}
 }
 
-func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
-	var statusReason string
-
-	switch statusCode {
-	case StatusOk:
-		statusReason = "OK"
-	case StatusBadRequest:
-		statusReason = "Bad Request"
-	case StatusInternalServerError:
-		statusReason = "Internal Server Error"
+// Header returns headers that are merged into the first WriteHeaders call,
+// replacing any value the handler set for the same name, except for
+// Set-Cookie and Vary which are added to it. Middleware and the server use
+// it to add headers to responses they don't write themselves.
+func (w *Writer) Header() *headers.Headers {
+	return w.state.header
+}
+
+// BeforeWriteHeaders registers fn to run right before the headers are
+// written, so middleware can add headers through Header that depend on what
+// the handler did. Functions run in the reverse order of registration.
+func (w *Writer) BeforeWriteHeaders(fn func()) {
+	w.state.beforeHeaders = append(w.state.beforeHeaders, fn)
+}
+
+// SetHijacker makes the connection behind w available through Hijack. The
+// server sets it on writers for client connections.
+func (w *Writer) SetHijacker(hijacker Hijacker) {
+	w.state.hijacker = hijacker
+}
+
+// SetErrorPages sets the pages WriteProblem renders HTML problems with,
+// instead of DefaultErrorPages.
+func (w *Writer) SetErrorPages(pages *ErrorPages) {
+	w.state.errorPages = pages
+}
+
+func (w *Writer) errorPages() *ErrorPages {
+	if w.state.errorPages == nil {
+		return DefaultErrorPages
+	}
+
+	return w.state.errorPages
+}
+
+// Hijack takes over the connection, for example to switch protocols. The
+// server stops using it, and the caller becomes responsible for closing it.
+func (w *Writer) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if w.state.hijacker == nil || w.state.hijacked {
+		return nil, nil, ErrNotHijackable
+	}
+
+	conn, rw, err := w.state.hijacker()
+	if err != nil {
+		return nil, nil, err
 	}
+	w.state.hijacked = true
 
-	statusLine := fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, statusReason)
+	return conn, rw, nil
+}
+
+// Hijacked reports whether the connection was taken over with Hijack.
+func (w *Writer) Hijacked() bool {
+	return w.state.hijacked
+}
+
+// ConnectionClose reports whether the response headers asked for the
+// connection to be closed.
+func (w *Writer) ConnectionClose() bool {
+	return w.state.connClose
+}
+
+// StatusCode returns the status written with WriteStatusLine, or 0 if no
+// status line has been written yet.
+func (w *Writer) StatusCode() StatusCode {
+	return w.state.statusCode
+}
+
+// BytesWritten returns the number of body bytes written so far.
+func (w *Writer) BytesWritten() int64 {
+	return w.state.bytesWritten
+}
+
+func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
+	statusLine := fmt.Sprintf("HTTP/1.1 %d %s\r\n", statusCode, StatusText(statusCode))
+	w.state.statusCode = statusCode
 
 	_, err := w.writer.Write([]byte(statusLine))
 
@@ -46,28 +128,103 @@ func (w *Writer) WriteStatusLine(statusCode StatusCode) error {
 }
 
 func (w *Writer) WriteHeaders(h *headers.Headers) error {
+	if !w.state.headersWritten {
+		w.state.headersWritten = true
+		for i := len(w.state.beforeHeaders) - 1; i >= 0; i-- {
+			w.state.beforeHeaders[i]()
+		}
+		w.state.header.ForEach(func(name, value string) {
+			// Both the handler and middleware may need cookies and Vary
+			// entries, so those are combined
+			if name == "set-cookie" || name == "vary" {
+				h.Set(name, value)
+				return
+			}
+			h.Replace(name, value)
+		})
+		w.state.connClose = h.HasToken("Connection", "close")
+	}
+
 	var err error
-	h.ForEach(func(name, value string) {
-		_, err := w.writer.Write([]byte(fmt.Sprintf("%s:%s\r\n", name, value)))
+	h.ForEachLine(func(name, value string) {
 		if err != nil {
 			return
 		}
+		_, err = w.writer.Write([]byte(fmt.Sprintf("%s:%s\r\n", name, value)))
 	})
-	w.writer.Write([]byte("\r\n"))
+	if err != nil {
+		return err
+	}
+	_, err = w.writer.Write([]byte("\r\n"))
 
 	return err
 }
 
 func (w *Writer) WriteBody(p []byte) (int, error) {
 	n, err := w.writer.Write(p)
+	w.state.bytesWritten += int64(n)
 	return n, err
 }
 
 func (w *Writer) WriteChunkedBody(reader io.Reader) (int64, error) {
 	n, err := io.Copy(w.writer, reader)
+	w.state.bytesWritten += n
 	return n, err
 }
 
+// WriteChunk writes p as a single chunk of a chunked body. Empty slices are
+// ignored since a zero-length chunk ends the body.
+func (w *Writer) WriteChunk(p []byte) (int, error) {
+	if len(p) == 0 {
+		return 0, nil
+	}
+
+	if _, err := fmt.Fprintf(w.writer, "%x\r\n", len(p)); err != nil {
+		return 0, err
+	}
+	n, err := w.writer.Write(p)
+	w.state.bytesWritten += int64(n)
+	if err != nil {
+		return n, err
+	}
+	_, err = w.writer.Write(crlfSeparator)
+
+	return n, err
+}
+
+// WriteTrailers ends a chunked body with the last chunk followed by the
+// trailer fields in h, which may be nil.
+func (w *Writer) WriteTrailers(h *headers.Headers) error {
+	if _, err := w.writer.Write([]byte("0\r\n")); err != nil {
+		return err
+	}
+
+	if h == nil {
+		h = headers.NewHeaders()
+	}
+
+	return w.WriteHeaders(h)
+}
+
+// WriteStatus answers with status and its reason phrase as a plain text
+// body. Headers set with Header, such as Allow or Retry-After, are sent
+// along.
+func (w *Writer) WriteStatus(status StatusCode) error {
+	body := []byte(StatusText(status))
+	h := GetDefaultHeaders(len(body))
+	h.Replace("Content-Type", "text/plain")
+
+	if err := w.WriteStatusLine(status); err != nil {
+		return err
+	}
+	if err := w.WriteHeaders(h); err != nil {
+		return err
+	}
+	_, err := w.WriteBody(body)
+
+	return err
+}
+
 func GetDefaultHeaders(contentLength int) *headers.Headers {
 	h := headers.NewHeaders()
 	h.Set("Content-Length", strconv.Itoa(contentLength))
@@ -87,27 +244,3 @@ func RespondOK() []byte {
   </body>
 </html>`)
 }
-
-func RespondBadRequest() []byte {
-	return []byte(`<html>
-  <head>
-    <title>400 Bad Request</title>
-  </head>
-  <body>
-    <h1>Bad Request</h1>
-    <p>Your request honestly kinda sucked.</p>
-  </body>
-</html>`)
-}
-
-func RespondInternalServerError() []byte {
-	return []byte(`<html>
-  <head>
-    <title>500 Internal Server Error</title>
-  </head>
-  <body>
-    <h1>Internal Server Error</h1>
-    <p>Okay, you know what? This one is on me.</p>
-  </body>
-</html>`)
-}
@@ -0,0 +1,108 @@
+package server
+
+import (
+	"context"
+	"fmt"
+	"log/slog"
+	"net"
+	"strconv"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/tracing"
+)
+
+type LogFormat int
+
+const (
+	// LogFormatJSON emits one record per request with the fields as slog
+	// attributes. Pair it with a slog.JSONHandler to get JSON lines.
+	LogFormatJSON LogFormat = iota
+	// LogFormatCommon emits the NCSA Common Log Format line as the message.
+	LogFormatCommon
+	// LogFormatCombined emits the Combined Log Format line (Common plus
+	// Referer and User-Agent) as the message.
+	LogFormatCombined
+)
+
+const clfTimeLayout = "02/Jan/2006:15:04:05 -0700"
+
+// AccessLog returns middleware that logs every request handled by next.
+// Requests that went through Trace are logged with their request, trace and
+// span IDs.
+func AccessLog(logger *slog.Logger, format LogFormat) Middleware {
+	return func(next Handler) Handler {
+		return func(w response.Writer, req *request.Request) {
+			start := time.Now()
+			next(w, req)
+			duration := time.Since(start)
+
+			// The IDs are attributes in every format, keeping the log lines
+			// themselves standard
+			var ids []slog.Attr
+			if info, ok := tracing.FromContext(req.Context()); ok {
+				ids = []slog.Attr{
+					slog.String("request_id", info.RequestID),
+					slog.String("trace_id", info.Span.TraceID.String()),
+					slog.String("span_id", info.Span.SpanID.String()),
+				}
+			}
+
+			switch format {
+			case LogFormatCommon:
+				logger.LogAttrs(context.Background(), slog.LevelInfo, commonLogLine(w, req, start), ids...)
+			case LogFormatCombined:
+				logger.LogAttrs(context.Background(), slog.LevelInfo, fmt.Sprintf("%s %q %q",
+					commonLogLine(w, req, start),
+					orDash(req.Headers.Get("Referer")),
+					orDash(req.Headers.Get("User-Agent")),
+				), ids...)
+			default:
+				if ids == nil {
+					ids = []slog.Attr{slog.String("request_id", req.Headers.Get("X-Request-ID"))}
+				}
+				logger.LogAttrs(context.Background(), slog.LevelInfo, "request", append([]slog.Attr{
+					slog.String("method", req.RequestLine.Method),
+					slog.String("target", req.RequestLine.RequestTarget),
+					slog.String("protocol", "HTTP/"+req.RequestLine.HttpVersion),
+					slog.Int("status", int(w.StatusCode())),
+					slog.Int64("bytes", w.BytesWritten()),
+					slog.Duration("duration", duration),
+					slog.String("remote_addr", req.RemoteAddr),
+					slog.String("user_agent", req.Headers.Get("User-Agent")),
+				}, ids...)...)
+			}
+		}
+	}
+}
+
+func commonLogLine(w response.Writer, req *request.Request, start time.Time) string {
+	host := req.RemoteAddr
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+
+	bytes := "-"
+	if n := w.BytesWritten(); n > 0 {
+		bytes = strconv.FormatInt(n, 10)
+	}
+
+	return fmt.Sprintf("%s - - [%s] \"%s %s HTTP/%s\" %d %s",
+		orDash(host),
+		start.Format(clfTimeLayout),
+		req.RequestLine.Method,
+		req.RequestLine.RequestTarget,
+		req.RequestLine.HttpVersion,
+		w.StatusCode(),
+		bytes,
+	)
+}
+
+func orDash(s string) string {
+	if s == "" {
+		return "-"
+	}
+
+	return s
+}
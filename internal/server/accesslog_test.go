@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"log/slog"
+	"strings"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func okHandler(w response.Writer, req *request.Request) {
+	body := []byte("hello")
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func newTestRequest(t *testing.T, raw string) *request.Request {
+	req, err := request.RequestFromReader(strings.NewReader(raw))
+	require.NoError(t, err)
+	req.RemoteAddr = "127.0.0.1:5000"
+
+	return req
+}
+
+func TestAccessLog(t *testing.T) {
+	raw := "GET /coffee HTTP/1.1\r\nHost: localhost\r\nUser-Agent: curl/8.0\r\nX-Request-ID: abc\r\nReferer: http://x/\r\n\r\n"
+
+	// Test: JSON format records request fields as attributes
+	buf := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(buf, nil))
+	AccessLog(logger, LogFormatJSON)(okHandler)(response.NewWriter(io.Discard), newTestRequest(t, raw))
+
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	assert.Equal(t, "GET", record["method"])
+	assert.Equal(t, "/coffee", record["target"])
+	assert.Equal(t, "HTTP/1.1", record["protocol"])
+	assert.Equal(t, float64(200), record["status"])
+	assert.Equal(t, float64(5), record["bytes"])
+	assert.Equal(t, "127.0.0.1:5000", record["remote_addr"])
+	assert.Equal(t, "curl/8.0", record["user_agent"])
+	assert.Equal(t, "abc", record["request_id"])
+
+	// Test: Common Log Format
+	buf.Reset()
+	AccessLog(logger, LogFormatCommon)(okHandler)(response.NewWriter(io.Discard), newTestRequest(t, raw))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	msg := record["msg"].(string)
+	assert.True(t, strings.HasPrefix(msg, "127.0.0.1 - - ["))
+	assert.True(t, strings.HasSuffix(msg, `"GET /coffee HTTP/1.1" 200 5`))
+
+	// Test: Combined Log Format
+	buf.Reset()
+	AccessLog(logger, LogFormatCombined)(okHandler)(response.NewWriter(io.Discard), newTestRequest(t, raw))
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &record))
+	msg = record["msg"].(string)
+	assert.True(t, strings.HasSuffix(msg, `"GET /coffee HTTP/1.1" 200 5 "http://x/" "curl/8.0"`))
+}
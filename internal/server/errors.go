@@ -0,0 +1,85 @@
+package server
+
+import (
+	"errors"
+	"log/slog"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// WithErrorPages sets the pages used for HTML error responses, both the
+// ones the server writes itself and the ones handlers write with
+// response.Writer.WriteProblem. Defaults to response.DefaultErrorPages.
+func WithErrorPages(pages *response.ErrorPages) Option {
+	return func(s *Server) {
+		s.errorPages = pages
+	}
+}
+
+// ErrorHandler is a handler that can fail. Use HandleErrors to turn it into
+// a Handler.
+type ErrorHandler func(w response.Writer, req *request.Request) error
+
+// HandleErrors answers the errors returned by h with problem details,
+// rendered as JSON or HTML according to the request's Accept header. Errors
+// wrapping a *response.Problem are answered with that problem; any other
+// error becomes a 500 without details, so internal messages don't leak to
+// clients, and is logged to logger. Errors returned after h started its
+// response can't be answered and are only logged.
+func HandleErrors(logger *slog.Logger, h ErrorHandler) Handler {
+	return func(w response.Writer, req *request.Request) {
+		err := h(w, req)
+		if err == nil {
+			return
+		}
+
+		var problem *response.Problem
+		started := w.StatusCode() != 0 || w.Hijacked()
+		if started || !errors.As(err, &problem) {
+			logger.Error("handler failed",
+				"method", req.RequestLine.Method,
+				"target", req.RequestLine.RequestTarget,
+				"error", err,
+				"response_started", started,
+			)
+		}
+		if started {
+			return
+		}
+
+		w.WriteProblem(problemFor(err), req.Headers.Get("Accept"))
+	}
+}
+
+func problemFor(err error) *response.Problem {
+	var problem *response.Problem
+	if errors.As(err, &problem) {
+		return problem
+	}
+
+	return response.NewProblem(response.StatusInternalServerError, "")
+}
+
+// parseErrorStatus returns the status answering a request that failed to
+// parse with err.
+func parseErrorStatus(err error, timedOut bool) response.StatusCode {
+	switch {
+	case timedOut:
+		return response.StatusRequestTimeout
+	case errors.Is(err, request.ErrRequestTooLarge):
+		return response.StatusRequestHeaderFieldsTooLarge
+	case errors.Is(err, request.ErrBodyTooLarge):
+		return response.StatusContentTooLarge
+	}
+
+	return response.StatusBadRequest
+}
+
+// writeError answers with the error page for status and closes the
+// connection afterwards. It is used for errors the server detects itself,
+// where the request's Accept header may not be known.
+func writeError(w response.Writer, status response.StatusCode) {
+	w.Header().Replace("Connection", "close")
+	w.WriteProblem(response.NewProblem(status, ""), "text/html")
+}
@@ -0,0 +1,170 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHandleErrors(t *testing.T) {
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewTextHandler(logs, nil))
+	serve := func(h ErrorHandler, accept string) string {
+		logs.Reset()
+		req := request.New("GET", "/orders/42", "")
+		if accept != "" {
+			req.Headers.Replace("Accept", accept)
+		}
+		buf := &bytes.Buffer{}
+		HandleErrors(logger, h)(response.NewWriter(buf), req)
+		return buf.String()
+	}
+	notFound := func(w response.Writer, req *request.Request) error {
+		problem := response.NewProblem(response.StatusNotFound, "order 42 doesn't exist")
+		problem.Type = "https://example.com/problems/unknown-order"
+		problem.Instance = req.RequestLine.RequestTarget
+		return fmt.Errorf("loading order: %w", problem.With("order", 42))
+	}
+
+	// Test: Problems are rendered as problem+json by default
+	out := serve(notFound, "")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+	assert.Contains(t, out, "content-type:application/problem+json\r\n")
+	_, body, _ := strings.Cut(out, "\r\n\r\n")
+	var members map[string]any
+	require.NoError(t, json.Unmarshal([]byte(body), &members))
+	assert.Equal(t, map[string]any{
+		"type":     "https://example.com/problems/unknown-order",
+		"title":    "Not Found",
+		"status":   float64(404),
+		"detail":   "order 42 doesn't exist",
+		"instance": "/orders/42",
+		"order":    float64(42),
+	}, members)
+
+	// Test: Clients preferring HTML get a page
+	out = serve(notFound, "text/html,application/xhtml+xml,*/*;q=0.8")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+	assert.Contains(t, out, "content-type:text/html; charset=utf-8\r\n")
+	assert.Contains(t, out, "<title>404 Not Found</title>")
+	assert.Contains(t, out, "<p>order 42 doesn&#39;t exist</p>")
+
+	// Test: JSON wins when it has the higher quality
+	out = serve(notFound, "text/html;q=0.5, application/json")
+	assert.Contains(t, out, "content-type:application/problem+json\r\n")
+	assert.Empty(t, logs.String())
+
+	// Test: Other errors become a 500 without their message
+	out = serve(func(w response.Writer, req *request.Request) error {
+		return errors.New("database password rejected")
+	}, "")
+	assert.Contains(t, out, "HTTP/1.1 500 Internal Server Error\r\n")
+	assert.Contains(t, out, `"title":"Internal Server Error"`)
+	assert.NotContains(t, out, "password")
+	assert.Contains(t, logs.String(), `msg="handler failed" method=GET target=/orders/42 error="database password rejected" response_started=false`)
+
+	// Test: Errors after the response started are only logged
+	out = serve(func(w response.Writer, req *request.Request) error {
+		w.WriteJSON(response.StatusOk, "partial")
+		return errors.New("too late")
+	}, "")
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.NotContains(t, out, "500")
+	assert.Contains(t, logs.String(), `error="too late" response_started=true`)
+
+	// Test: Standard members take precedence over extensions
+	problem := response.NewProblem(response.StatusConflict, "").With("status", "overridden")
+	encoded, err := json.Marshal(problem)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"title":"Conflict","status":409}`, string(encoded))
+	assert.Equal(t, "Conflict", problem.Error())
+}
+
+func TestErrorPages(t *testing.T) {
+	pages := response.NewErrorPages()
+	pages.Register(response.StatusNotFound, template.Must(template.New("404").Parse(
+		"<h1>Lost?</h1><p>{{.Detail}}</p>")))
+	require.NoError(t, pages.RegisterFS(response.StatusRequestHeaderFieldsTooLarge, fstest.MapFS{
+		"errors/431.html": {Data: []byte("<h1>{{.Status}}: headers too big</h1>")},
+	}, "errors/431.html"))
+	path := filepath.Join(t.TempDir(), "500.html")
+	require.NoError(t, os.WriteFile(path, []byte("<h1>Sorry, {{.Title}}</h1>"), 0o644))
+	require.NoError(t, pages.RegisterFile(response.StatusInternalServerError, path))
+
+	// Test: Missing templates fail to register
+	assert.Error(t, pages.RegisterFile(response.StatusBadGateway, filepath.Join(t.TempDir(), "missing.html")))
+
+	handler := func(w response.Writer, req *request.Request) {
+		switch req.RequestLine.RequestTarget {
+		case "/panic":
+			panic("boom")
+		case "/missing":
+			w.WriteProblem(response.NewProblem(response.StatusNotFound, "no such <page>"), req.Headers.Get("Accept"))
+		default:
+			w.WriteProblem(response.NewProblem(response.StatusTeapot, ""), req.Headers.Get("Accept"))
+		}
+	}
+	srv, err := Serve(0, handler,
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithErrorPages(pages),
+		WithLimits(Limits{MaxBodySize: 10}),
+	)
+	require.NoError(t, err)
+	defer srv.Close()
+	roundTrip := func(raw string) string {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		require.NoError(t, err)
+		defer conn.Close()
+		_, err = io.WriteString(conn, raw)
+		require.NoError(t, err)
+		out, _ := io.ReadAll(conn)
+		return string(out)
+	}
+
+	// Test: Handlers' HTML problems use the registered page
+	out := roundTrip("GET /missing HTTP/1.1\r\nHost: localhost\r\nAccept: text/html\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+	assert.Contains(t, out, "<h1>Lost?</h1><p>no such &lt;page&gt;</p>")
+
+	// Test: Other statuses get the default page from the status registry
+	out = roundTrip("GET /teapot HTTP/1.1\r\nHost: localhost\r\nAccept: text/html\r\nConnection: close\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 418 I'm a teapot\r\n")
+	assert.Contains(t, out, "<title>418 I&#39;m a teapot</title>")
+
+	// Test: Malformed requests get the 400 page
+	out = roundTrip("GET / HTTP/1.1\r\nHost localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 400 Bad Request\r\n")
+	assert.Contains(t, out, "connection:close\r\n")
+	assert.Contains(t, out, "<title>400 Bad Request</title>")
+
+	// Test: Oversized headers get the 431 page
+	out = roundTrip("GET / HTTP/1.1\r\nX-Long: " + strings.Repeat("a", 70*1024) + "\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 431 Request Header Fields Too Large\r\n")
+	assert.Contains(t, out, "<h1>431: headers too big</h1>")
+
+	// Test: Bodies over MaxBodySize get the 413 page before being read
+	out = roundTrip("POST / HTTP/1.1\r\nHost: localhost\r\nContent-Length: 100\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 413 Content Too Large\r\n")
+	assert.Contains(t, out, "<title>413 Content Too Large</title>")
+
+	// Test: Handler panics get the 500 page and close the connection
+	out = roundTrip("GET /panic HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 500 Internal Server Error\r\n")
+	assert.Contains(t, out, "connection:close\r\n")
+	assert.Contains(t, out, "<h1>Sorry, Internal Server Error</h1>")
+}
@@ -0,0 +1,31 @@
+package server
+
+import (
+	"errors"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// BindJSON decodes the JSON body of req into v, allowing at most maxSize
+// bytes (request.DefaultMaxJSONSize if not positive). If the body can't be
+// decoded it answers with a problem response and returns false: 415 for
+// other content types, 413 for bodies over maxSize and 400 for invalid JSON
+// or unknown fields.
+func BindJSON(w response.Writer, req *request.Request, v any, maxSize int64) bool {
+	err := req.DecodeJSON(v, maxSize)
+	if err == nil {
+		return true
+	}
+
+	status := response.StatusBadRequest
+	switch {
+	case errors.Is(err, request.ErrNotJSON):
+		status = response.StatusUnsupportedMediaType
+	case errors.Is(err, request.ErrJSONTooLarge):
+		status = response.StatusContentTooLarge
+	}
+	w.WriteProblem(response.NewProblem(status, err.Error()), req.Headers.Get("Accept"))
+
+	return false
+}
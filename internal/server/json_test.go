@@ -0,0 +1,129 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type order struct {
+	Item     string `json:"item"`
+	Quantity int    `json:"quantity"`
+}
+
+func TestBindJSON(t *testing.T) {
+	bind := func(contentType, body string, maxSize int64) (bool, order, string) {
+		req := request.New("POST", "/orders", body)
+		req.Headers.Replace("Content-Type", contentType)
+		buf := &bytes.Buffer{}
+		var o order
+		ok := BindJSON(response.NewWriter(buf), req, &o, maxSize)
+		return ok, o, buf.String()
+	}
+
+	// Test: Valid body is decoded without writing a response
+	ok, o, out := bind("application/json; charset=utf-8", `{"item":"coffee","quantity":2}`, 0)
+	assert.True(t, ok)
+	assert.Equal(t, order{Item: "coffee", Quantity: 2}, o)
+	assert.Empty(t, out)
+
+	// Test: +json media types are accepted
+	ok, _, _ = bind("application/vnd.api+json", `{"item":"tea"}`, 0)
+	assert.True(t, ok)
+
+	// Test: Other content types get 415
+	ok, _, out = bind("text/plain", `{"item":"coffee"}`, 0)
+	assert.False(t, ok)
+	assert.Contains(t, out, "HTTP/1.1 415 Unsupported Media Type\r\n")
+	assert.Contains(t, out, "content-type:application/problem+json\r\n")
+
+	// Test: Unknown fields get 400 with a problem body
+	ok, _, out = bind("application/json", `{"item":"coffee","size":"large"}`, 0)
+	assert.False(t, ok)
+	assert.Contains(t, out, "HTTP/1.1 400 Bad Request\r\n")
+	_, body, _ := strings.Cut(out, "\r\n\r\n")
+	var problem map[string]any
+	require.NoError(t, json.Unmarshal([]byte(body), &problem))
+	assert.Equal(t, float64(400), problem["status"])
+	assert.Equal(t, "Bad Request", problem["title"])
+	assert.Contains(t, problem["detail"], `unknown field "size"`)
+
+	// Test: Trailing data and empty bodies are invalid
+	ok, _, _ = bind("application/json", `{"item":"coffee"}{}`, 0)
+	assert.False(t, ok)
+	ok, _, _ = bind("application/json", ``, 0)
+	assert.False(t, ok)
+
+	// Test: Bodies over the size limit get 413
+	ok, _, out = bind("application/json", `{"item":"`+strings.Repeat("a", 100)+`"}`, 64)
+	assert.False(t, ok)
+	assert.Contains(t, out, "HTTP/1.1 413 Content Too Large\r\n")
+
+	// Test: A streamed body over the limit is rejected without reading it
+	// all
+	stream := func(body string, length int64) (bool, *countingReader, string) {
+		req := request.New("POST", "/orders", "")
+		req.Headers.Replace("Content-Type", "application/json")
+		counter := &countingReader{r: strings.NewReader(body)}
+		req.SetBodyReader(counter, length)
+		buf := &bytes.Buffer{}
+		var o order
+		ok := BindJSON(response.NewWriter(buf), req, &o, 64)
+		return ok, counter, buf.String()
+	}
+	large := `{"item":"` + strings.Repeat("a", 1<<20) + `"}`
+	ok, counter, out := stream(large, int64(len(large)))
+	assert.False(t, ok)
+	assert.Contains(t, out, "HTTP/1.1 413 Content Too Large\r\n")
+	assert.Zero(t, counter.n)
+
+	// Test: Reading stops past the limit even if the body runs longer than
+	// declared
+	ok, counter, out = stream(large, 64)
+	assert.False(t, ok)
+	assert.Contains(t, out, "HTTP/1.1 413 Content Too Large\r\n")
+	assert.LessOrEqual(t, counter.n, int64(64+1))
+
+	// Test: A streamed body within the limit is decoded
+	ok, _, out = stream(`{"item":"tea"}`, 14)
+	assert.True(t, ok)
+	assert.Empty(t, out)
+}
+
+// countingReader counts the bytes read from r.
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+func TestWriteJSON(t *testing.T) {
+	// Test: Status, headers and body are written in one call
+	buf := &bytes.Buffer{}
+	w := response.NewWriter(buf)
+	require.NoError(t, w.WriteJSON(response.StatusCreated, order{Item: "coffee", Quantity: 1}))
+
+	out := buf.String()
+	assert.Contains(t, out, "HTTP/1.1 201 Created\r\n")
+	assert.Contains(t, out, "content-type:application/json\r\n")
+	assert.Contains(t, out, "content-length:31\r\n")
+	assert.True(t, strings.HasSuffix(out, "\r\n\r\n"+`{"item":"coffee","quantity":1}`+"\n"))
+
+	// Test: Values that can't be encoded write nothing
+	buf.Reset()
+	w = response.NewWriter(buf)
+	assert.Error(t, w.WriteJSON(response.StatusOk, make(chan int)))
+	assert.Empty(t, buf.String())
+}
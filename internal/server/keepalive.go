@@ -0,0 +1,67 @@
+package server
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// KeepAlive controls how persistent connections are reused.
+type KeepAlive struct {
+	// MaxRequests caps the number of requests served on one connection.
+	// Zero means unlimited.
+	MaxRequests int
+	// IdleTimeout closes a connection that has not sent a new request within
+	// this duration. Zero means no timeout.
+	IdleTimeout time.Duration
+}
+
+// WithKeepAlive sets the keep-alive policy for client connections.
+func WithKeepAlive(keepAlive KeepAlive) Option {
+	return func(s *Server) {
+		s.keepAlive = keepAlive
+	}
+}
+
+// shouldClose reports whether the connection must be closed after responding
+// to req, the served-th request on the connection.
+func (s *Server) shouldClose(req *request.Request, served int) bool {
+	return req.Headers.HasToken("Connection", "close") ||
+		(s.keepAlive.MaxRequests > 0 && served >= s.keepAlive.MaxRequests) ||
+		s.closed.Load()
+}
+
+// setConnectionHeaders tells the client whether the connection stays open
+// and, if it does, for how long and how many more requests.
+func (s *Server) setConnectionHeaders(w response.Writer, closeConn bool, served int) {
+	if closeConn {
+		w.Header().Replace("Connection", "close")
+		return
+	}
+
+	var params []string
+	// Rounding a sub-second timeout up would promise more than the server
+	// waits, and timeout=0 reads as no keep-alive, so it is left out
+	if seconds := int(s.keepAlive.IdleTimeout.Seconds()); seconds > 0 {
+		params = append(params, fmt.Sprintf("timeout=%d", seconds))
+	}
+	if s.keepAlive.MaxRequests > 0 {
+		params = append(params, fmt.Sprintf("max=%d", s.keepAlive.MaxRequests-served))
+	}
+	if len(params) > 0 {
+		w.Header().Replace("Keep-Alive", strings.Join(params, ", "))
+	}
+}
+
+// isClosedOrIdle reports whether a read error means the client went away or
+// the idle timeout expired, rather than that it sent a malformed request.
+func isClosedOrIdle(err error) bool {
+	var netErr net.Error
+	return errors.Is(err, io.EOF) || errors.Is(err, net.ErrClosed) || (errors.As(err, &netErr) && netErr.Timeout())
+}
@@ -0,0 +1,65 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestKeepAlive(t *testing.T) {
+	srv, err := Serve(0, okHandler, WithLogger(slog.New(slog.DiscardHandler)), WithKeepAlive(KeepAlive{MaxRequests: 2, IdleTimeout: 5 * time.Second}))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Test: First response advertises the remaining budget
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	status, lines := readStatusAndHeaders(t, reader)
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+	assert.Contains(t, lines, "keep-alive:timeout=5, max=1")
+	_, err = io.CopyN(io.Discard, reader, 5)
+	require.NoError(t, err)
+
+	// Test: Last allowed request closes the connection
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	_, lines = readStatusAndHeaders(t, reader)
+	assert.Contains(t, lines, "connection:close")
+	_, err = io.CopyN(io.Discard, reader, 5)
+	require.NoError(t, err)
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: Connection tokens are honored case-insensitively
+	conn2, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn2.Close()
+	reader = bufio.NewReader(conn2)
+	_, err = io.WriteString(conn2, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: keep-alive, Close\r\n\r\n")
+	require.NoError(t, err)
+	_, lines = readStatusAndHeaders(t, reader)
+	assert.Contains(t, lines, "connection:close")
+
+	// Test: Sub-second idle timeouts are not advertised as timeout=0
+	srv2, err := Serve(0, okHandler, WithLogger(slog.New(slog.DiscardHandler)), WithKeepAlive(KeepAlive{MaxRequests: 2, IdleTimeout: 500 * time.Millisecond}))
+	require.NoError(t, err)
+	defer srv2.Close()
+	conn3, err := net.Dial("tcp", srv2.Addr().String())
+	require.NoError(t, err)
+	defer conn3.Close()
+	_, err = io.WriteString(conn3, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	_, lines = readStatusAndHeaders(t, bufio.NewReader(conn3))
+	assert.Contains(t, lines, "keep-alive:max=1")
+}
@@ -0,0 +1,241 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"strconv"
+	"sync"
+	"syscall"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// Limits bounds the resources a Server may use. Zero values mean unlimited.
+type Limits struct {
+	// MaxConnections caps the number of concurrently open connections.
+	MaxConnections int
+	// QueueConnections makes the server stop accepting while MaxConnections
+	// is reached, leaving new connections in the listen backlog. Otherwise
+	// excess connections are answered with 503 and closed.
+	QueueConnections bool
+	// MaxConnectionsPerIP caps concurrently open connections per client IP.
+	MaxConnectionsPerIP int
+	// MaxInFlight caps the number of requests being handled at once. Excess
+	// requests are answered with 503.
+	MaxInFlight int
+	// MaxBodySize caps the Content-Length of requests. Larger requests are
+	// answered with 413 before their body is read.
+	MaxBodySize int64
+	// RetryAfter is advertised in the Retry-After header of 503 responses.
+	// Defaults to one second.
+	RetryAfter time.Duration
+}
+
+// WithLimits sets connection and request limits.
+func WithLimits(limits Limits) Option {
+	return func(s *Server) {
+		s.limiter = newLimiter(limits)
+	}
+}
+
+const (
+	minAcceptBackoff = 5 * time.Millisecond
+	maxAcceptBackoff = time.Second
+	rejectTimeout    = time.Second
+	// maxRejecting bounds the connections being answered with 503 at once.
+	// Beyond that, excess connections are closed without a response.
+	maxRejecting = 64
+)
+
+type limiter struct {
+	limits    Limits
+	conns     chan struct{}
+	inFlight  chan struct{}
+	rejecting chan struct{}
+
+	mu    sync.Mutex
+	perIP map[string]int
+}
+
+func newLimiter(limits Limits) *limiter {
+	l := &limiter{
+		limits:    limits,
+		perIP:     make(map[string]int),
+		rejecting: make(chan struct{}, maxRejecting),
+	}
+	if limits.MaxConnections > 0 {
+		l.conns = make(chan struct{}, limits.MaxConnections)
+	}
+	if limits.MaxInFlight > 0 {
+		l.inFlight = make(chan struct{}, limits.MaxInFlight)
+	}
+	if l.limits.RetryAfter <= 0 {
+		l.limits.RetryAfter = time.Second
+	}
+
+	return l
+}
+
+// waitConn blocks until a connection slot is free when connections are
+// queued. It returns false if done is closed first.
+func (l *limiter) waitConn(done <-chan struct{}) bool {
+	if l == nil || l.conns == nil || !l.limits.QueueConnections {
+		return true
+	}
+
+	select {
+	case l.conns <- struct{}{}:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// acquireConn reserves the resources for a newly accepted connection and
+// reports whether it may be served. On failure any slot reserved by waitConn
+// is released.
+func (l *limiter) acquireConn(conn net.Conn) bool {
+	if l == nil {
+		return true
+	}
+
+	if l.conns != nil && !l.limits.QueueConnections {
+		// In queueing mode the slot was already reserved by waitConn.
+		select {
+		case l.conns <- struct{}{}:
+		default:
+			return false
+		}
+	}
+
+	if l.limits.MaxConnectionsPerIP > 0 {
+		ip := remoteIP(conn)
+		l.mu.Lock()
+		if l.perIP[ip] >= l.limits.MaxConnectionsPerIP {
+			l.mu.Unlock()
+			l.releaseSlot()
+			return false
+		}
+		l.perIP[ip]++
+		l.mu.Unlock()
+	}
+
+	return true
+}
+
+// cancelWait releases a slot reserved by waitConn when Accept fails.
+func (l *limiter) cancelWait() {
+	if l != nil && l.limits.QueueConnections {
+		l.releaseSlot()
+	}
+}
+
+func (l *limiter) releaseConn(conn net.Conn) {
+	if l == nil {
+		return
+	}
+
+	if l.limits.MaxConnectionsPerIP > 0 {
+		ip := remoteIP(conn)
+		l.mu.Lock()
+		if l.perIP[ip]--; l.perIP[ip] <= 0 {
+			delete(l.perIP, ip)
+		}
+		l.mu.Unlock()
+	}
+	l.releaseSlot()
+}
+
+func (l *limiter) releaseSlot() {
+	if l.conns != nil {
+		<-l.conns
+	}
+}
+
+func (l *limiter) acquireRequest() bool {
+	if l == nil || l.inFlight == nil {
+		return true
+	}
+
+	select {
+	case l.inFlight <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+// acquireReject reserves one of the slots for answering rejected
+// connections.
+func (l *limiter) acquireReject() bool {
+	select {
+	case l.rejecting <- struct{}{}:
+		return true
+	default:
+		return false
+	}
+}
+
+func (l *limiter) releaseReject() {
+	<-l.rejecting
+}
+
+func (l *limiter) maxBodySize() int64 {
+	if l == nil {
+		return 0
+	}
+
+	return l.limits.MaxBodySize
+}
+
+func (l *limiter) releaseRequest() {
+	if l == nil || l.inFlight == nil {
+		return
+	}
+
+	<-l.inFlight
+}
+
+func (l *limiter) retryAfter() string {
+	seconds := int((l.limits.RetryAfter + time.Second - 1) / time.Second)
+	return strconv.Itoa(seconds)
+}
+
+// writeOverloaded answers with 503 Service Unavailable and a Retry-After
+// header.
+func (l *limiter) writeOverloaded(w response.Writer, closeConn bool) {
+	w.Header().Replace("Retry-After", l.retryAfter())
+	if closeConn {
+		w.Header().Replace("Connection", "close")
+	}
+
+	w.WriteStatus(response.StatusServiceUnavailable)
+}
+
+func remoteIP(conn net.Conn) string {
+	addr := conn.RemoteAddr().String()
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+
+	return addr
+}
+
+// isTemporaryAcceptError reports whether an Accept error is caused by
+// resource exhaustion or a transient network condition that is worth
+// retrying after a pause.
+func isTemporaryAcceptError(err error) bool {
+	switch {
+	case errors.Is(err, syscall.EMFILE),
+		errors.Is(err, syscall.ENFILE),
+		errors.Is(err, syscall.ENOBUFS),
+		errors.Is(err, syscall.ENOMEM),
+		errors.Is(err, syscall.ECONNABORTED),
+		errors.Is(err, syscall.ECONNRESET):
+		return true
+	}
+
+	var netErr net.Error
+	return errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,229 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"os"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func readStatusAndHeaders(t *testing.T, r *bufio.Reader) (string, []string) {
+	statusLine, err := r.ReadString('\n')
+	require.NoError(t, err)
+
+	var lines []string
+	for {
+		line, err := r.ReadString('\n')
+		require.NoError(t, err)
+		if line == "\r\n" {
+			break
+		}
+		lines = append(lines, strings.ToLower(strings.TrimSpace(line)))
+	}
+
+	return strings.TrimSpace(statusLine), lines
+}
+
+func TestMaxConnections(t *testing.T) {
+	srv, err := Serve(0, okHandler, WithLogger(slog.New(slog.DiscardHandler)), WithLimits(Limits{MaxConnections: 1, RetryAfter: 2 * time.Second}))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: First connection is served
+	first, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer first.Close()
+	_, err = io.WriteString(first, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	status, _ := readStatusAndHeaders(t, bufio.NewReader(first))
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+
+	// Test: Second connection is shed with 503 and Retry-After
+	second, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	status, lines := readStatusAndHeaders(t, bufio.NewReader(second))
+	assert.Equal(t, "HTTP/1.1 503 Service Unavailable", status)
+	assert.Contains(t, lines, "retry-after:2")
+	assert.Contains(t, lines, "connection:close")
+}
+
+// sendRequest writes a GET request to conn and returns the status line and
+// headers of the response, reading its body if it has one.
+func sendRequest(t *testing.T, conn net.Conn, r *bufio.Reader, target string) (string, []string) {
+	_, err := io.WriteString(conn, "GET "+target+" HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	status, lines := readStatusAndHeaders(t, r)
+	for _, line := range lines {
+		if length, ok := strings.CutPrefix(line, "content-length:"); ok {
+			n, err := strconv.Atoi(length)
+			require.NoError(t, err)
+			_, err = io.ReadFull(r, make([]byte, n))
+			require.NoError(t, err)
+		}
+	}
+
+	return status, lines
+}
+
+func TestMaxConnectionsPerIP(t *testing.T) {
+	srv, err := Serve(0, okHandler, WithLogger(slog.New(slog.DiscardHandler)), WithLimits(Limits{MaxConnectionsPerIP: 1}))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: First connection from an IP is served
+	first, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	status, _ := sendRequest(t, first, bufio.NewReader(first), "/")
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+
+	// Test: Second connection from the same IP is shed
+	second, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	status, lines := readStatusAndHeaders(t, bufio.NewReader(second))
+	assert.Equal(t, "HTTP/1.1 503 Service Unavailable", status)
+	assert.Contains(t, lines, "connection:close")
+
+	// Test: The IP gets its slot back once the first connection closes
+	first.Close()
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		if err != nil {
+			return false
+		}
+		defer conn.Close()
+		_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+		if err != nil {
+			return false
+		}
+		status, err := bufio.NewReader(conn).ReadString('\n')
+		return err == nil && strings.HasPrefix(status, "HTTP/1.1 200")
+	}, time.Second, 10*time.Millisecond)
+}
+
+func TestMaxInFlight(t *testing.T) {
+	entered := make(chan struct{})
+	release := make(chan struct{})
+	handler := func(w response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/slow" {
+			close(entered)
+			<-release
+		}
+		okHandler(w, req)
+	}
+	srv, err := Serve(0, handler, WithLogger(slog.New(slog.DiscardHandler)), WithLimits(Limits{MaxInFlight: 1}))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	slow, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer slow.Close()
+	_, err = io.WriteString(slow, "GET /slow HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-entered
+
+	// Test: Requests beyond the limit get 503 but keep their connection
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+	status, lines := sendRequest(t, conn, reader, "/")
+	assert.Equal(t, "HTTP/1.1 503 Service Unavailable", status)
+	assert.Contains(t, lines, "retry-after:1")
+	assert.NotContains(t, lines, "connection:close")
+
+	// Test: The next request is served once the slot is released
+	close(release)
+	status, _ = readStatusAndHeaders(t, bufio.NewReader(slow))
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+	status, _ = sendRequest(t, conn, reader, "/")
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+}
+
+func TestQueueConnections(t *testing.T) {
+	srv, err := Serve(0, okHandler, WithLogger(slog.New(slog.DiscardHandler)), WithLimits(Limits{MaxConnections: 1, QueueConnections: true}))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	first, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	status, _ := sendRequest(t, first, bufio.NewReader(first), "/")
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+
+	// Test: Excess connections wait in the backlog instead of being shed
+	second, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer second.Close()
+	_, err = io.WriteString(second, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	second.SetReadDeadline(time.Now().Add(100 * time.Millisecond))
+	_, err = second.Read(make([]byte, 1))
+	var netErr net.Error
+	require.ErrorAs(t, err, &netErr)
+	assert.True(t, netErr.Timeout())
+
+	// Test: They are served once a slot frees up
+	first.Close()
+	second.SetReadDeadline(time.Now().Add(time.Second))
+	status, _ = readStatusAndHeaders(t, bufio.NewReader(second))
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+}
+
+// failingListener fails its first Accept calls with EMFILE, as a process
+// out of file descriptors would.
+type failingListener struct {
+	net.Listener
+	failures int
+
+	mu    sync.Mutex
+	calls []time.Time
+}
+
+func (l *failingListener) Accept() (net.Conn, error) {
+	l.mu.Lock()
+	l.calls = append(l.calls, time.Now())
+	failed := len(l.calls) <= l.failures
+	l.mu.Unlock()
+	if failed {
+		return nil, &net.OpError{Op: "accept", Net: "tcp", Err: os.NewSyscallError("accept", syscall.EMFILE)}
+	}
+
+	return l.Listener.Accept()
+}
+
+func TestAcceptBackoff(t *testing.T) {
+	inner, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	listener := &failingListener{Listener: inner, failures: 3}
+	logs := &strings.Builder{}
+	srv := ServeListener(listener, okHandler, WithLogger(slog.New(slog.NewTextHandler(logs, nil))))
+	defer srv.Close()
+
+	// Test: The server keeps accepting after EMFILE, backing off between tries
+	conn, err := net.Dial("tcp", inner.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	status, _ := sendRequest(t, conn, bufio.NewReader(conn), "/")
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+
+	listener.mu.Lock()
+	calls := listener.calls
+	listener.mu.Unlock()
+	require.GreaterOrEqual(t, len(calls), 4)
+	assert.GreaterOrEqual(t, calls[1].Sub(calls[0]), minAcceptBackoff)
+	assert.GreaterOrEqual(t, calls[3].Sub(calls[2]), 4*minAcceptBackoff)
+	assert.Equal(t, 3, strings.Count(logs.String(), `level=WARN msg="accept failed, retrying"`))
+}
@@ -0,0 +1,159 @@
+package server
+
+import (
+	"errors"
+	"io"
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+	"github.com/rmdevio/httpserver/internal/metrics"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// WithMetrics records server metrics in reg. If path is not empty the
+// registry is served on that path in the Prometheus text format, bypassing
+// the server handler. Servers given the same option share the metrics.
+func WithMetrics(reg *metrics.Registry, path string) Option {
+	m := newServerMetrics(reg)
+	handler := reg.Handler()
+
+	return func(s *Server) {
+		s.metrics = m
+		s.metricsPath = path
+		s.metricsHandler = handler
+	}
+}
+
+// WithMetricsRoute sets the route label of the request metrics to what
+// route returns, such as the pattern of the route the request matched.
+// Requests it returns "" for, and all requests without this option, are
+// counted under "other", so clients can't create a series per path.
+func WithMetricsRoute(route func(req *request.Request) string) Option {
+	return func(s *Server) {
+		s.metricsRoute = route
+	}
+}
+
+type serverMetrics struct {
+	openConnections     *metrics.Gauge
+	acceptedConnections *metrics.Counter
+	requests            *metrics.Counter
+	requestDuration     *metrics.Histogram
+	bytesIn             *metrics.Counter
+	bytesOut            *metrics.Counter
+	parseErrors         *metrics.Counter
+}
+
+func newServerMetrics(reg *metrics.Registry) *serverMetrics {
+	return &serverMetrics{
+		openConnections:     reg.NewGauge("httpserver_open_connections", "Number of currently open connections."),
+		acceptedConnections: reg.NewCounter("httpserver_accepted_connections_total", "Total number of accepted connections."),
+		requests:            reg.NewCounter("httpserver_requests_total", "Total number of handled requests.", "method", "route", "status"),
+		requestDuration:     reg.NewHistogram("httpserver_request_duration_seconds", "Time spent handling requests.", nil, "method", "route"),
+		bytesIn:             reg.NewCounter("httpserver_received_bytes_total", "Total number of bytes read from connections."),
+		bytesOut:            reg.NewCounter("httpserver_sent_bytes_total", "Total number of bytes written to connections."),
+		parseErrors:         reg.NewCounter("httpserver_parse_errors_total", "Total number of requests that failed to parse.", "type"),
+	}
+}
+
+func (m *serverMetrics) connOpened(conn net.Conn) net.Conn {
+	if m == nil {
+		return conn
+	}
+
+	m.acceptedConnections.Inc()
+	m.openConnections.Inc()
+
+	return &meteredConn{Conn: conn, m: m}
+}
+
+func (m *serverMetrics) connClosed() {
+	if m == nil {
+		return
+	}
+
+	m.openConnections.Dec()
+}
+
+func (m *serverMetrics) parseError(err error) {
+	// A connection closed between requests is not a parse error.
+	if m == nil || err == io.EOF {
+		return
+	}
+
+	m.parseErrors.Inc(parseErrorType(err))
+}
+
+// instrument returns middleware recording request counts and durations.
+func (m *serverMetrics) instrument(next Handler, route func(req *request.Request) string) Handler {
+	return func(w response.Writer, req *request.Request) {
+		start := time.Now()
+		next(w, req)
+
+		method := methodLabel(req.RequestLine.Method)
+		label := route(req)
+		m.requests.Inc(method, label, strconv.Itoa(int(w.StatusCode())))
+		m.requestDuration.Observe(time.Since(start).Seconds(), method, label)
+	}
+}
+
+// methodLabel returns method if it is a standard one and "other" otherwise.
+func methodLabel(method string) string {
+	switch method {
+	case "GET", "HEAD", "POST", "PUT", "PATCH", "DELETE", "OPTIONS", "CONNECT", "TRACE":
+		return method
+	}
+
+	return "other"
+}
+
+// routeOf returns the request target without its query string.
+func routeOf(req *request.Request) string {
+	target, _, _ := strings.Cut(req.RequestLine.RequestTarget, "?")
+	return target
+}
+
+func parseErrorType(err error) string {
+	switch {
+	case errors.Is(err, io.ErrUnexpectedEOF):
+		return "eof"
+	case errors.Is(err, request.ErrRequestTooLarge), errors.Is(err, request.ErrBodyTooLarge):
+		return "too_large"
+	case errors.Is(err, request.ErrInvalidRequestLine):
+		return "request_line"
+	case errors.Is(err, request.ErrInvalidHttpMethod):
+		return "method"
+	case errors.Is(err, request.ErrMalformedHttpVersion), errors.Is(err, request.ErrInvalidHttpVersion):
+		return "version"
+	case errors.Is(err, headers.ErrMalformedHeader), errors.Is(err, headers.ErrMalformedFieldName), errors.Is(err, headers.ErrMalformedHeaderName):
+		return "header"
+	}
+
+	var netErr net.Error
+	if errors.As(err, &netErr) && netErr.Timeout() {
+		return "timeout"
+	}
+
+	return "other"
+}
+
+type meteredConn struct {
+	net.Conn
+	m *serverMetrics
+}
+
+func (c *meteredConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	c.m.bytesIn.Add(float64(n))
+	return n, err
+}
+
+func (c *meteredConn) Write(p []byte) (int, error) {
+	n, err := c.Conn.Write(p)
+	c.m.bytesOut.Add(float64(n))
+	return n, err
+}
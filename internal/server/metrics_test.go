@@ -0,0 +1,95 @@
+package server
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/metrics"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestMetricsLabels(t *testing.T) {
+	reg := metrics.NewRegistry()
+	route := func(req *request.Request) string {
+		if strings.HasPrefix(req.RequestLine.RequestTarget, "/api/") {
+			return "/api/"
+		}
+		return ""
+	}
+	srv, err := Serve(0, echoTargetHandler,
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithMetrics(reg, "/metrics"),
+		WithMetricsRoute(route),
+	)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: Distinct paths and unknown methods don't create new series
+	var requests strings.Builder
+	for i := range 50 {
+		fmt.Fprintf(&requests, "GET /api/items/%d HTTP/1.1\r\nHost: localhost\r\n\r\n", i)
+		fmt.Fprintf(&requests, "GET /random/%d?q=%d HTTP/1.1\r\nHost: localhost\r\n\r\n", i, i)
+		fmt.Fprintf(&requests, "SCAN%c /api/%d HTTP/1.1\r\nHost: localhost\r\n\r\n", 'A'+i%26, i)
+	}
+	requests.WriteString("GET /metrics HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	_, err = io.WriteString(conn, requests.String())
+	require.NoError(t, err)
+	_, err = io.ReadAll(conn)
+	require.NoError(t, err)
+
+	var out strings.Builder
+	_, err = reg.WriteTo(&out)
+	require.NoError(t, err)
+	var series []string
+	for _, line := range strings.Split(out.String(), "\n") {
+		if strings.HasPrefix(line, "httpserver_requests_total{") {
+			series = append(series, line)
+		}
+	}
+	assert.ElementsMatch(t, []string{
+		`httpserver_requests_total{method="GET",route="/api/",status="200"} 50`,
+		`httpserver_requests_total{method="GET",route="other",status="200"} 50`,
+		`httpserver_requests_total{method="other",route="/api/",status="200"} 50`,
+		`httpserver_requests_total{method="GET",route="/metrics",status="200"} 1`,
+	}, series)
+}
+
+func TestMetricsSharedRegistry(t *testing.T) {
+	reg := metrics.NewRegistry()
+	logger := WithLogger(slog.New(slog.DiscardHandler))
+
+	// Test: WithMetrics can be called more than once with the same registry,
+	// and the servers count into the same series
+	var servers []*Server
+	for range 2 {
+		srv, err := Serve(0, echoTargetHandler, logger, WithMetrics(reg, "/metrics"))
+		require.NoError(t, err)
+		defer srv.Close()
+		servers = append(servers, srv)
+	}
+	for _, srv := range servers {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		require.NoError(t, err)
+		_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+		require.NoError(t, err)
+		_, err = io.ReadAll(conn)
+		require.NoError(t, err)
+		conn.Close()
+	}
+
+	var out strings.Builder
+	_, err := reg.WriteTo(&out)
+	require.NoError(t, err)
+	assert.Equal(t, 1, strings.Count(out.String(), "# TYPE httpserver_requests_total counter"))
+	assert.Contains(t, out.String(), `httpserver_requests_total{method="GET",route="other",status="200"} 2`)
+}
@@ -0,0 +1,14 @@
+package server
+
+// Middleware wraps a Handler with additional behaviour.
+type Middleware func(next Handler) Handler
+
+// Chain wraps handler with the given middleware so that the first middleware
+// runs first.
+func Chain(handler Handler, middleware ...Middleware) Handler {
+	for i := len(middleware) - 1; i >= 0; i-- {
+		handler = middleware[i](handler)
+	}
+
+	return handler
+}
@@ -0,0 +1,360 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// sniffLen is how much of a net/http handler's body is buffered before the
+// headers are sent. Bodies that fit are sent with a Content-Length and
+// without a Content-Type get one detected from their first bytes, as
+// net/http does.
+const sniffLen = 4096
+
+// FromHTTPHandler runs a net/http handler on this server. The
+// http.ResponseWriter it gets also implements http.Flusher and
+// http.Hijacker. Interim 1xx responses other than 101 are dropped.
+func FromHTTPHandler(h http.Handler) Handler {
+	return func(w response.Writer, req *request.Request) {
+		httpReq, err := toHTTPRequest(req)
+		if err != nil {
+			w.WriteStatus(response.StatusBadRequest)
+			return
+		}
+
+		rw := &httpResponseWriter{
+			w:      w,
+			header: make(http.Header),
+			head:   req.RequestLine.Method == "HEAD",
+		}
+		h.ServeHTTP(rw, httpReq)
+		rw.finish()
+	}
+}
+
+// FromHTTPMiddleware adapts net/http middleware to wrap a Handler.
+func FromHTTPMiddleware(mw func(http.Handler) http.Handler) Middleware {
+	return func(next Handler) Handler {
+		return FromHTTPHandler(mw(ToHTTPHandler(next)))
+	}
+}
+
+func toHTTPRequest(req *request.Request) (*http.Request, error) {
+	target := req.RequestLine.RequestTarget
+	u, err := url.ParseRequestURI(target)
+	if err != nil {
+		return nil, err
+	}
+
+	major, minor, ok := http.ParseHTTPVersion("HTTP/" + req.RequestLine.HttpVersion)
+	if !ok {
+		major, minor = 1, 1
+	}
+	httpReq := &http.Request{
+		Method:        req.RequestLine.Method,
+		URL:           u,
+		Proto:         "HTTP/" + req.RequestLine.HttpVersion,
+		ProtoMajor:    major,
+		ProtoMinor:    minor,
+		Header:        make(http.Header),
+		Body:          io.NopCloser(req.BodyReader()),
+		ContentLength: req.ContentLength(),
+		Host:          req.Headers.Get("Host"),
+		RemoteAddr:    req.RemoteAddr,
+		RequestURI:    target,
+	}
+	if !req.BodyStreamed() && req.Body == "" {
+		httpReq.Body = http.NoBody
+	}
+	req.Headers.ForEach(func(name, value string) {
+		if name != "host" {
+			httpReq.Header.Add(http.CanonicalHeaderKey(name), value)
+		}
+	})
+
+	return httpReq.WithContext(req.Context()), nil
+}
+
+// httpResponseWriter implements http.ResponseWriter on top of a
+// response.Writer.
+type httpResponseWriter struct {
+	w      response.Writer
+	header http.Header
+	head   bool
+
+	status    int
+	buf       bytes.Buffer
+	committed bool
+	chunked   bool
+	hijacked  bool
+}
+
+func (rw *httpResponseWriter) Header() http.Header {
+	return rw.header
+}
+
+func (rw *httpResponseWriter) WriteHeader(code int) {
+	if rw.status != 0 || rw.hijacked {
+		return
+	}
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		return
+	}
+
+	rw.status = code
+}
+
+func (rw *httpResponseWriter) Write(p []byte) (int, error) {
+	if rw.hijacked {
+		return 0, http.ErrHijacked
+	}
+	rw.WriteHeader(http.StatusOK)
+	if !bodyAllowed(rw.status) {
+		return 0, http.ErrBodyNotAllowed
+	}
+	if rw.head {
+		return len(p), nil
+	}
+
+	if !rw.committed {
+		if rw.buf.Len()+len(p) <= sniffLen {
+			return rw.buf.Write(p)
+		}
+		if err := rw.commit(-1); err != nil {
+			return 0, err
+		}
+	}
+
+	return rw.writeBody(p)
+}
+
+func (rw *httpResponseWriter) Flush() {
+	if rw.hijacked {
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	if !rw.committed {
+		rw.commit(-1)
+	}
+}
+
+func (rw *httpResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	if rw.committed {
+		return nil, nil, response.ErrNotHijackable
+	}
+
+	conn, brw, err := rw.w.Hijack()
+	if err != nil {
+		return nil, nil, err
+	}
+	rw.hijacked = true
+
+	return conn, brw, nil
+}
+
+// commit writes the status line and headers, followed by the buffered
+// body. A negative contentLength means the length is unknown and the body
+// is chunked unless the handler set a Content-Length.
+func (rw *httpResponseWriter) commit(contentLength int) error {
+	rw.committed = true
+
+	if rw.header.Get("Content-Type") == "" && rw.buf.Len() > 0 {
+		rw.header.Set("Content-Type", http.DetectContentType(rw.buf.Bytes()))
+	}
+
+	h := headers.NewHeaders()
+	for name, values := range rw.header {
+		if strings.HasPrefix(name, http.TrailerPrefix) {
+			continue
+		}
+		for _, value := range values {
+			h.Set(name, value)
+		}
+	}
+	if h.Get("Content-Length") == "" && bodyAllowed(rw.status) {
+		if contentLength >= 0 {
+			h.Replace("Content-Length", strconv.Itoa(contentLength))
+		} else if !rw.head {
+			h.Remove("Content-Length")
+			h.Replace("Transfer-Encoding", "chunked")
+			rw.chunked = true
+		}
+	}
+
+	if err := rw.w.WriteStatusLine(response.StatusCode(rw.status)); err != nil {
+		return err
+	}
+	if err := rw.w.WriteHeaders(h); err != nil {
+		return err
+	}
+
+	buffered := rw.buf.Bytes()
+	rw.buf = bytes.Buffer{}
+	_, err := rw.writeBody(buffered)
+
+	return err
+}
+
+func (rw *httpResponseWriter) writeBody(p []byte) (int, error) {
+	if rw.chunked {
+		return rw.w.WriteChunk(p)
+	}
+
+	return rw.w.WriteBody(p)
+}
+
+// finish completes the response once the net/http handler returned.
+func (rw *httpResponseWriter) finish() {
+	if rw.hijacked {
+		return
+	}
+	rw.WriteHeader(http.StatusOK)
+	if !rw.committed {
+		contentLength := rw.buf.Len()
+		if !bodyAllowed(rw.status) || (rw.head && contentLength == 0) {
+			contentLength = -1
+		}
+		rw.commit(contentLength)
+	}
+	if !rw.chunked {
+		return
+	}
+
+	trailers := headers.NewHeaders()
+	for _, name := range rw.header.Values("Trailer") {
+		for _, key := range strings.Split(name, ",") {
+			key = strings.TrimSpace(key)
+			for _, value := range rw.header.Values(key) {
+				trailers.Set(key, value)
+			}
+		}
+	}
+	for name, values := range rw.header {
+		if key, ok := strings.CutPrefix(name, http.TrailerPrefix); ok {
+			for _, value := range values {
+				trailers.Set(key, value)
+			}
+		}
+	}
+	rw.w.WriteTrailers(trailers)
+}
+
+func bodyAllowed(status int) bool {
+	return status >= 200 && status != http.StatusNoContent && status != http.StatusNotModified
+}
+
+// ToHTTPHandler exposes a Handler as a net/http handler. The handler's
+// output is parsed and replayed on the http.ResponseWriter as it is written,
+// so streamed bodies stay streamed.
+func ToHTTPHandler(h Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		req, err := fromHTTPRequest(r)
+		if err != nil {
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+			return
+		}
+
+		pr, pw := io.Pipe()
+		parsed := make(chan struct{})
+		go func() {
+			defer close(parsed)
+			replayResponse(w, r.Method, pr)
+			// Unblock the handler if parsing stopped early
+			io.Copy(io.Discard, pr)
+		}()
+
+		h(response.NewWriter(pw), req)
+		pw.Close()
+		<-parsed
+	})
+}
+
+func fromHTTPRequest(r *http.Request) (*request.Request, error) {
+	var body []byte
+	if r.Body != nil {
+		var err error
+		if body, err = io.ReadAll(r.Body); err != nil {
+			return nil, err
+		}
+	}
+
+	target := r.RequestURI
+	if target == "" {
+		target = r.URL.RequestURI()
+	}
+	req := request.New(r.Method, target, string(body))
+	if r.ProtoMajor == 1 && r.ProtoMinor == 0 {
+		req.RequestLine.HttpVersion = "1.0"
+	}
+	for name, values := range r.Header {
+		for _, value := range values {
+			req.Headers.Set(name, value)
+		}
+	}
+	if len(body) > 0 {
+		req.Headers.Replace("Content-Length", strconv.Itoa(len(body)))
+	}
+	req.Headers.Replace("Host", r.Host)
+	req.RemoteAddr = r.RemoteAddr
+	req.TLS = r.TLS != nil
+
+	return req.WithContext(r.Context()), nil
+}
+
+// replayResponse parses the raw response a Handler writes to r and
+// reproduces it on w.
+func replayResponse(w http.ResponseWriter, method string, r io.Reader) {
+	started := false
+	res, err := response.NewReader(r).StreamResponse(method, func(res *response.Response) (io.Writer, error) {
+		started = true
+		res.Headers.ForEachLine(func(name, value string) {
+			switch name {
+			case "connection":
+				if res.Headers.HasToken("Connection", "close") {
+					w.Header().Set("Connection", "close")
+				}
+			case "keep-alive", "transfer-encoding", "trailer":
+			default:
+				w.Header().Add(http.CanonicalHeaderKey(name), value)
+			}
+		})
+		w.WriteHeader(int(res.StatusLine.StatusCode))
+
+		return flushWriter{w}, nil
+	})
+	if err != nil {
+		if !started {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		}
+		return
+	}
+
+	res.Trailers.ForEach(func(name, value string) {
+		w.Header().Set(http.TrailerPrefix+http.CanonicalHeaderKey(name), value)
+	})
+}
+
+// flushWriter flushes after every write so streamed responses reach the
+// client as the handler produces them.
+type flushWriter struct {
+	w http.ResponseWriter
+}
+
+func (fw flushWriter) Write(p []byte) (int, error) {
+	n, err := fw.w.Write(p)
+	if f, ok := fw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+
+	return n, err
+}
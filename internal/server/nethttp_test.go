@@ -0,0 +1,199 @@
+package server
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"log/slog"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func serveHTTPHandler(t *testing.T, h http.Handler, raw string) string {
+	buf := &bytes.Buffer{}
+	FromHTTPHandler(h)(response.NewWriter(buf), newTestRequest(t, raw))
+
+	return buf.String()
+}
+
+func TestFromHTTPHandler(t *testing.T) {
+	// Test: Request fields are translated
+	out := serveHTTPHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		w.Header().Set("X-Seen", r.Method+" "+r.URL.Path+" "+r.URL.Query().Get("q")+" "+r.Host+" "+r.Header.Get("X-Token")+" "+r.RemoteAddr+" "+string(body))
+		w.Write([]byte("<html><body>hi</body></html>"))
+	}), "POST /path?q=1 HTTP/1.1\r\nHost: localhost\r\nX-Token: abc\r\nContent-Length: 4\r\n\r\nbody")
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "x-seen:POST /path 1 localhost abc 127.0.0.1:5000 body\r\n")
+
+	// Test: Small bodies get a Content-Length and a sniffed Content-Type
+	assert.Contains(t, out, "content-length:28\r\n")
+	assert.Contains(t, out, "content-type:text/html; charset=utf-8\r\n")
+
+	// Test: Flushed bodies are chunked and end with the declared trailers
+	out = serveHTTPHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Trailer", "X-Checksum")
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("one,"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("two"))
+		w.Header().Set("X-Checksum", "abc")
+	}), "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	res, err := response.NewReader(strings.NewReader(out)).ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusAccepted, res.StatusLine.StatusCode)
+	assert.Equal(t, "chunked", res.Headers.Get("Transfer-Encoding"))
+	assert.Equal(t, "one,two", res.Body)
+	assert.Equal(t, "abc", res.Trailers.Get("X-Checksum"))
+
+	// Test: Bodies are not allowed for 204
+	out = serveHTTPHandler(t, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+		_, err := w.Write([]byte("nope"))
+		assert.ErrorIs(t, err, http.ErrBodyNotAllowed)
+	}), "DELETE /x HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Equal(t, "HTTP/1.1 204 No Content\r\n\r\n", out)
+}
+
+func TestFromHTTPHandlerHijack(t *testing.T) {
+	srv, err := Serve(0, FromHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		conn, brw, err := w.(http.Hijacker).Hijack()
+		if !assert.NoError(t, err) {
+			return
+		}
+		defer conn.Close()
+
+		brw.WriteString("HTTP/1.1 101 Switching Protocols\r\nUpgrade: echo\r\nConnection: Upgrade\r\n\r\n")
+		brw.Flush()
+		line, _ := brw.ReadString('\n')
+		brw.WriteString("echo: " + line)
+		brw.Flush()
+	})), WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: Bytes sent right after the request reach the hijacker
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\nConnection: Upgrade\r\nUpgrade: echo\r\n\r\nhello\n")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	status, _ := readStatusAndHeaders(t, reader)
+	assert.Equal(t, "HTTP/1.1 101 Switching Protocols", status)
+	line, err := reader.ReadString('\n')
+	require.NoError(t, err)
+	assert.Equal(t, "echo: hello\n", line)
+}
+
+func TestToHTTPHandler(t *testing.T) {
+	srv := httptest.NewServer(ToHTTPHandler(func(w response.Writer, req *request.Request) {
+		if req.RequestLine.RequestTarget == "/stream" {
+			h := response.GetDefaultHeaders(0)
+			h.Remove("Content-Length")
+			h.Replace("Transfer-Encoding", "chunked")
+			h.Replace("Trailer", "X-Done")
+			w.WriteStatusLine(response.StatusOk)
+			w.WriteHeaders(h)
+			w.WriteChunk([]byte("one,"))
+			w.WriteChunk([]byte("two"))
+			trailers := response.GetDefaultHeaders(0)
+			trailers.Remove("Content-Length")
+			trailers.Remove("Content-Type")
+			trailers.Remove("Connection")
+			trailers.Replace("X-Done", "yes")
+			w.WriteTrailers(trailers)
+			return
+		}
+
+		body := []byte(req.RequestLine.Method + " " + req.RequestLine.RequestTarget + " " + req.Headers.Get("X-Token") + " " + req.Body)
+		h := response.GetDefaultHeaders(len(body))
+		h.Replace("X-Host", req.Headers.Get("Host"))
+		w.WriteStatusLine(response.StatusCreated)
+		w.WriteHeaders(h)
+		w.WriteBody(body)
+	}))
+	defer srv.Close()
+
+	// Test: Requests and responses are translated
+	httpReq, err := http.NewRequest("PUT", srv.URL+"/items?id=7", strings.NewReader("data"))
+	require.NoError(t, err)
+	httpReq.Header.Set("X-Token", "abc")
+	res, err := srv.Client().Do(httpReq)
+	require.NoError(t, err)
+	body, err := io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, http.StatusCreated, res.StatusCode)
+	assert.Equal(t, "PUT /items?id=7 abc data", string(body))
+	assert.Equal(t, strings.TrimPrefix(srv.URL, "http://"), res.Header.Get("X-Host"))
+
+	// Test: Chunked bodies are streamed with their trailers
+	res, err = srv.Client().Get(srv.URL + "/stream")
+	require.NoError(t, err)
+	body, err = io.ReadAll(res.Body)
+	res.Body.Close()
+	require.NoError(t, err)
+	assert.Equal(t, "one,two", string(body))
+	assert.Equal(t, "yes", res.Trailer.Get("X-Done"))
+}
+
+func TestFromHTTPMiddleware(t *testing.T) {
+	mw := FromHTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Middleware", "yes")
+			next.ServeHTTP(w, r)
+		})
+	})
+
+	// Test: net/http middleware wraps a Handler
+	buf := &bytes.Buffer{}
+	mw(echoTargetHandler)(response.NewWriter(buf), newTestRequest(t, "GET /wrapped HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	assert.Contains(t, buf.String(), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, buf.String(), "x-middleware:yes\r\n")
+	assert.Contains(t, buf.String(), "\r\n\r\n/wrapped")
+}
+
+type contextKey string
+
+func TestHTTPContextPropagation(t *testing.T) {
+	mw := FromHTTPMiddleware(func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Outer", fmt.Sprint(r.Context().Value(contextKey("outer"))))
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey("inner"), "from net/http")))
+		})
+	})
+	var values []any
+	h := mw(func(w response.Writer, req *request.Request) {
+		values = append(values, req.Context().Value(contextKey("outer")), req.Context().Value(contextKey("inner")))
+		echoTargetHandler(w, req)
+	})
+
+	// Test: Context values survive the round trip through net/http
+	ctx := context.WithValue(context.Background(), contextKey("outer"), "from server")
+	buf := &bytes.Buffer{}
+	h(response.NewWriter(buf), newTestRequest(t, "GET /ctx HTTP/1.1\r\nHost: localhost\r\n\r\n").WithContext(ctx))
+	assert.Contains(t, buf.String(), "x-outer:from server\r\n")
+	assert.Equal(t, []any{"from server", "from net/http"}, values)
+
+	// Test: Cancellation reaches the net/http handler
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	var err error
+	FromHTTPHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		err = r.Context().Err()
+	}))(response.NewWriter(&bytes.Buffer{}), newTestRequest(t, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n").WithContext(ctx))
+	assert.ErrorIs(t, err, context.Canceled)
+}
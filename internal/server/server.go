@@ -1,80 +1,384 @@
 package server
 
 import (
+	"bufio"
+	"context"
+	"crypto/tls"
+	"errors"
 	"fmt"
-	"io"
+	"log/slog"
 	"net"
+	"runtime/debug"
+	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/rmdevio/httpserver/internal/request"
 	"github.com/rmdevio/httpserver/internal/response"
 )
 
 type Server struct {
-	port     uint16
-	listener net.Listener
-	handler  Handler
-	closed   atomic.Bool
+	listener   net.Listener
+	handler    Handler
+	logger     *slog.Logger
+	middleware []Middleware
+	closed     atomic.Bool
+	done       chan struct{}
+	mu         sync.Mutex
+	conns      map[net.Conn]bool
+	wg         sync.WaitGroup
+	limiter    *limiter
+	keepAlive  KeepAlive
+	timeouts   Timeouts
+	tlsConfig  *tls.Config
+	errorPages *response.ErrorPages
+
+	metrics        *serverMetrics
+	metricsPath    string
+	metricsHandler Handler
+	metricsRoute   func(req *request.Request) string
 }
 
 type Handler func(w response.Writer, req *request.Request)
 
-func Serve(port uint16, handler Handler) (*Server, error) {
+// Option configures a Server created with Serve.
+type Option func(s *Server)
+
+// WithLogger sets the logger used for connection lifecycle messages.
+// Defaults to slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(s *Server) {
+		s.logger = logger
+	}
+}
+
+// WithMiddleware wraps the server handler with the given middleware. The
+// first middleware is the outermost one.
+func WithMiddleware(middleware ...Middleware) Option {
+	return func(s *Server) {
+		s.middleware = append(s.middleware, middleware...)
+	}
+}
+
+// WithTLSConfig serves HTTPS: connections are accepted through a TLS
+// listener using config, which must hold at least one certificate or a
+// GetCertificate callback.
+func WithTLSConfig(config *tls.Config) Option {
+	return func(s *Server) {
+		s.tlsConfig = config
+	}
+}
+
+func Serve(port uint16, handler Handler, opts ...Option) (*Server, error) {
 	listener, err := net.Listen("tcp", fmt.Sprintf(":%d", port))
 	if err != nil {
 		return nil, err
 	}
 
+	return ServeListener(listener, handler, opts...), nil
+}
+
+// ServeListener serves connections accepted from listener, which is closed
+// when the server is closed. It allows listening on any address or network,
+// such as a Unix socket.
+func ServeListener(listener net.Listener, handler Handler, opts ...Option) *Server {
 	srv := &Server{
-		port:     port,
-		handler:  handler,
 		listener: listener,
+		logger:   slog.Default(),
+		done:     make(chan struct{}),
+		conns:    make(map[net.Conn]bool),
+	}
+	for _, opt := range opts {
+		opt(srv)
+	}
+	if srv.tlsConfig != nil {
+		srv.listener = tls.NewListener(listener, srv.tlsConfig)
+	}
+	srv.handler = Chain(handler, srv.middleware...)
+	if srv.metrics != nil {
+		srv.handler = srv.metrics.instrument(srv.serveMetrics(srv.handler), srv.routeLabel)
 	}
 
 	go srv.listen()
 
-	return srv, nil
+	return srv
 }
 
 func (s *Server) listen() {
+	var backoff time.Duration
 	for {
-		if s.closed.Load() {
+		if s.closed.Load() || !s.limiter.waitConn(s.done) {
 			return
 		}
 
 		conn, err := s.listener.Accept()
 		if err != nil {
-			return
+			s.limiter.cancelWait()
+			if s.closed.Load() || errors.Is(err, net.ErrClosed) {
+				return
+			}
+
+			backoff = min(max(backoff*2, minAcceptBackoff), maxAcceptBackoff)
+			level := slog.LevelError
+			if isTemporaryAcceptError(err) {
+				level = slog.LevelWarn
+			}
+			s.logger.Log(context.Background(), level, "accept failed, retrying", "error", err, "backoff", backoff)
+
+			select {
+			case <-time.After(backoff):
+			case <-s.done:
+				return
+			}
+			continue
 		}
+		backoff = 0
 
-		fmt.Printf("Accepted new connection: %s\n", conn.RemoteAddr().String())
+		s.logger.Debug("accepted connection", "remote_addr", conn.RemoteAddr().String())
+		if !s.limiter.acquireConn(conn) {
+			s.reject(conn)
+			continue
+		}
+
+		if !s.trackConn(conn) {
+			s.limiter.releaseConn(conn)
+			conn.Close()
+			return
+		}
 		go s.handle(conn)
 	}
 }
 
+// Addr returns the address the server is listening on.
+func (s *Server) Addr() net.Addr {
+	return s.listener.Addr()
+}
+
+// Close stops accepting connections. Connections already open are served
+// until they close; use Shutdown to wait for them.
 func (s *Server) Close() {
+	s.mu.Lock()
+	if s.closed.CompareAndSwap(false, true) {
+		close(s.done)
+	}
+	s.mu.Unlock()
 	s.listener.Close()
 }
 
-func (s *Server) handle(conn io.ReadWriteCloser) {
-	defer conn.Close()
+// Shutdown stops accepting connections, closes the idle ones and waits for
+// the requests in progress to be answered, with Connection: close. If ctx
+// ends first, the remaining connections are closed and ctx's error is
+// returned.
+func (s *Server) Shutdown(ctx context.Context) error {
+	s.Close()
+	s.closeConns(true)
+
+	finished := make(chan struct{})
+	go func() {
+		s.wg.Wait()
+		close(finished)
+	}()
+
+	select {
+	case <-finished:
+		return nil
+	case <-ctx.Done():
+		s.closeConns(false)
+		return ctx.Err()
+	}
+}
+
+func (s *Server) trackConn(conn net.Conn) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.closed.Load() {
+		return false
+	}
+	s.conns[conn] = false
+	s.wg.Add(1)
+
+	return true
+}
+
+func (s *Server) untrackConn(conn net.Conn) {
+	s.mu.Lock()
+	delete(s.conns, conn)
+	s.mu.Unlock()
+	s.wg.Done()
+}
+
+// setIdle records whether conn is waiting for its next request. It returns
+// false if the server is shutting down, in which case conn should not wait.
+func (s *Server) setIdle(conn net.Conn, idle bool) bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.conns[conn] = idle
+
+	return !idle || !s.closed.Load()
+}
+
+// closeConns closes the idle connections, or all of them.
+func (s *Server) closeConns(idleOnly bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for conn, idle := range s.conns {
+		if idle || !idleOnly {
+			conn.Close()
+		}
+	}
+}
+
+// reject answers a connection that exceeds the configured limits with 503
+// and closes it. When too many rejections are in progress the connection
+// is closed right away, so a flood of connections can't pile up goroutines.
+func (s *Server) reject(conn net.Conn) {
+	s.logger.Debug("rejected connection", "remote_addr", conn.RemoteAddr().String())
+	if !s.limiter.acquireReject() {
+		conn.Close()
+		return
+	}
+
+	go func() {
+		defer s.limiter.releaseReject()
+		defer conn.Close()
+
+		// The deadline also bounds the TLS handshake
+		conn.SetDeadline(time.Now().Add(rejectTimeout))
+		s.limiter.writeOverloaded(response.NewWriter(conn), true)
+	}()
+}
+
+// serveMetrics routes requests for the metrics path to the metrics handler.
+func (s *Server) serveMetrics(next Handler) Handler {
+	if s.metricsPath == "" {
+		return next
+	}
+
+	return func(w response.Writer, req *request.Request) {
+		if routeOf(req) == s.metricsPath {
+			s.metricsHandler(w, req)
+			return
+		}
+
+		next(w, req)
+	}
+}
+
+// routeLabel returns the route label of req in the request metrics.
+func (s *Server) routeLabel(req *request.Request) string {
+	if s.metricsPath != "" && routeOf(req) == s.metricsPath {
+		return s.metricsPath
+	}
+	if s.metricsRoute != nil {
+		if route := s.metricsRoute(req); route != "" {
+			return route
+		}
+	}
+
+	return "other"
+}
+
+func (s *Server) handle(conn net.Conn) {
+	defer s.untrackConn(conn)
+	defer s.limiter.releaseConn(conn)
+	tracked := conn
+	conn = s.metrics.connOpened(conn)
+	defer s.metrics.connClosed()
+
+	hijacked := false
+	defer func() {
+		if !hijacked {
+			conn.Close()
+		}
+	}()
+
+	var rc *readTimeoutConn
+	reader := request.NewReader(conn)
+	if s.timeouts.ReadTimeout > 0 {
+		rc = &readTimeoutConn{Conn: conn, timeout: s.timeouts.ReadTimeout}
+		reader = request.NewReader(rc)
+	}
+	reader.SetMaxBodySize(s.limiter.maxBodySize())
+	for served := 1; ; served++ {
+		if !s.setIdle(tracked, true) {
+			break
+		}
+		s.waitRequest(conn, rc, reader.Buffered())
 
-	for {
 		responseWriter := response.NewWriter(conn)
-		req, err := request.RequestFromReader(conn)
+		responseWriter.SetErrorPages(s.errorPages)
+		responseWriter.SetHijacker(func() (net.Conn, *bufio.ReadWriter, error) {
+			conn.SetDeadline(time.Time{})
+			return conn, bufio.NewReadWriter(bufio.NewReader(reader), bufio.NewWriter(conn)), nil
+		})
+		req, err := reader.ReadRequest()
+		s.setIdle(tracked, false)
 		if err != nil {
-			responseWriter.WriteStatusLine(response.StatusBadRequest)
-			responseWriter.WriteHeaders(response.GetDefaultHeaders(0))
-			return
+			if timedOut := rc.timedOut(err); timedOut || !isClosedOrIdle(err) {
+				s.metrics.parseError(err)
+				conn.SetWriteDeadline(time.Now().Add(rejectTimeout))
+				writeError(responseWriter, parseErrorStatus(err, timedOut))
+			}
+			break
+		}
+		// Streamed bodies are read by the handler, still within the read
+		// timeout
+		if rc == nil || !req.BodyStreamed() {
+			conn.SetReadDeadline(time.Time{})
+		}
+		if s.timeouts.WriteTimeout > 0 {
+			conn.SetWriteDeadline(time.Now().Add(s.timeouts.WriteTimeout))
 		}
+		req.RemoteAddr = conn.RemoteAddr().String()
+		_, req.TLS = tracked.(*tls.Conn)
 
-		s.handler(responseWriter, req)
+		closeConn := s.shouldClose(req, served)
+		req.Headers.RemoveConnectionHeaders()
+		s.setConnectionHeaders(responseWriter, closeConn, served)
 
-		connHeader := req.Headers.Get("Connection")
-		if len(connHeader) != 0 && connHeader == "close" {
+		if !s.limiter.acquireRequest() {
+			s.limiter.writeOverloaded(responseWriter, false)
+		} else if !s.serveRequest(responseWriter, req) {
+			break
+		}
+
+		if responseWriter.Hijacked() {
+			hijacked = true
+			s.logger.Debug("hijacked connection", "remote_addr", conn.RemoteAddr().String())
+			return
+		}
+
+		if closeConn || responseWriter.ConnectionClose() {
 			break
 		}
 	}
 
-	fmt.Printf("Channel closed for connection: %s\n", conn.(net.Conn).RemoteAddr().String())
+	s.logger.Debug("closed connection", "remote_addr", conn.RemoteAddr().String())
+}
+
+// serveRequest runs the handler for req. It returns false if the handler
+// panicked, after answering with 500 if the response hadn't started.
+func (s *Server) serveRequest(w response.Writer, req *request.Request) (ok bool) {
+	defer s.limiter.releaseRequest()
+	defer func() {
+		if v := recover(); v != nil {
+			s.logger.Error("handler panicked",
+				"panic", v,
+				"method", req.RequestLine.Method,
+				"target", req.RequestLine.RequestTarget,
+				"stack", string(debug.Stack()),
+			)
+			if w.StatusCode() == 0 && !w.Hijacked() {
+				writeError(w, response.StatusInternalServerError)
+			}
+			ok = false
+		}
+	}()
+
+	s.handler(w, req)
+
+	return true
 }
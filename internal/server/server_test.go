@@ -0,0 +1,224 @@
+package server
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"io"
+	"log/slog"
+	"math/big"
+	"net"
+	"path/filepath"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func echoTargetHandler(w response.Writer, req *request.Request) {
+	body := []byte(req.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+	w.WriteBody(body)
+}
+
+func TestPipelining(t *testing.T) {
+	srv, err := Serve(0, echoTargetHandler, WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: Pipelined requests sent in one write are answered in order
+	_, err = io.WriteString(conn,
+		"GET /a HTTP/1.1\r\nHost: localhost\r\n\r\n"+
+			"POST /b HTTP/1.1\r\nHost: localhost\r\nContent-Length: 3\r\n\r\nxyz"+
+			"GET /c HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+
+	reader := bufio.NewReader(conn)
+	for _, target := range []string{"/a", "/b", "/c"} {
+		status, lines := readStatusAndHeaders(t, reader)
+		assert.Equal(t, "HTTP/1.1 200 OK", status)
+		assert.Contains(t, lines, "content-length:"+strconv.Itoa(len(target)))
+
+		body := make([]byte, len(target))
+		_, err := io.ReadFull(reader, body)
+		require.NoError(t, err)
+		assert.Equal(t, target, string(body))
+	}
+
+	_, err = reader.ReadByte()
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func selfSignedCert(t *testing.T) tls.Certificate {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	require.NoError(t, err)
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		Subject:      pkix.Name{CommonName: "localhost"},
+		DNSNames:     []string{"localhost"},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	require.NoError(t, err)
+
+	return tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key}
+}
+
+func TestServeListener(t *testing.T) {
+	// Test: TLS connections are served
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	require.NoError(t, err)
+	srv := ServeListener(listener, echoTargetHandler,
+		WithLogger(slog.New(slog.DiscardHandler)),
+		WithTLSConfig(&tls.Config{Certificates: []tls.Certificate{selfSignedCert(t)}}),
+	)
+	defer srv.Close()
+
+	conn, err := tls.Dial("tcp", srv.Addr().String(), &tls.Config{InsecureSkipVerify: true})
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET /secure HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	out, err := io.ReadAll(conn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, string(out), "\r\n\r\n/secure")
+
+	// Test: Unix sockets are served
+	unixListener, err := net.Listen("unix", filepath.Join(t.TempDir(), "server.sock"))
+	require.NoError(t, err)
+	unixSrv := ServeListener(unixListener, echoTargetHandler, WithLogger(slog.New(slog.DiscardHandler)))
+	defer unixSrv.Close()
+
+	unixConn, err := net.Dial("unix", unixSrv.Addr().String())
+	require.NoError(t, err)
+	defer unixConn.Close()
+	_, err = io.WriteString(unixConn, "GET /socket HTTP/1.1\r\nHost: localhost\r\nConnection: close\r\n\r\n")
+	require.NoError(t, err)
+	out, err = io.ReadAll(unixConn)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "\r\n\r\n/socket")
+}
+
+func TestShutdown(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{}, 1)
+	srv, err := Serve(0, func(w response.Writer, req *request.Request) {
+		started <- struct{}{}
+		<-release
+		okHandler(w, req)
+	}, WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+
+	idle, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer idle.Close()
+	busy, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer busy.Close()
+	_, err = io.WriteString(busy, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	shutdown := make(chan error, 1)
+	go func() {
+		shutdown <- srv.Shutdown(context.Background())
+	}()
+
+	// Test: Idle connections are closed right away
+	idle.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = idle.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+
+	// Test: New connections are refused
+	assert.Eventually(t, func() bool {
+		conn, err := net.Dial("tcp", srv.Addr().String())
+		if err == nil {
+			conn.Close()
+		}
+		return err != nil
+	}, 2*time.Second, 10*time.Millisecond)
+
+	// Test: Shutdown waits for the request in progress to be answered
+	select {
+	case <-shutdown:
+		t.Fatal("shutdown returned before the request finished")
+	case <-time.After(50 * time.Millisecond):
+	}
+	close(release)
+	out, err := io.ReadAll(busy)
+	require.NoError(t, err)
+	assert.Contains(t, string(out), "HTTP/1.1 200 OK\r\n")
+	assert.NoError(t, <-shutdown)
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	release := make(chan struct{})
+	defer close(release)
+	started := make(chan struct{}, 1)
+	srv, err := Serve(0, func(w response.Writer, req *request.Request) {
+		started <- struct{}{}
+		<-release
+	}, WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	<-started
+
+	// Test: Connections still busy when the context ends are closed
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	assert.ErrorIs(t, srv.Shutdown(ctx), context.DeadlineExceeded)
+	conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+	_, err = conn.Read(make([]byte, 1))
+	assert.ErrorIs(t, err, io.EOF)
+}
+
+func TestConnectionHeaders(t *testing.T) {
+	handler := func(w response.Writer, req *request.Request) {
+		body := []byte(req.Headers.Get("Content-Length") + "|" + req.Headers.Get("Host") + "|" + req.Headers.Get("X-Foo") + "|" + req.Body)
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(response.GetDefaultHeaders(len(body)))
+		w.WriteBody(body)
+	}
+	srv, err := Serve(0, handler, WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+
+	// Test: Custom headers named in Connection are removed, framing and
+	// routing headers are kept
+	_, err = io.WriteString(conn, "POST / HTTP/1.1\r\nHost: localhost\r\n"+
+		"Connection: Content-Length, Host, X-Foo\r\nX-Foo: bar\r\nContent-Length: 5\r\n\r\nhello")
+	require.NoError(t, err)
+	reader := bufio.NewReader(conn)
+	status, lines := readStatusAndHeaders(t, reader)
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+	assert.Contains(t, lines, "content-length:18")
+	body := make([]byte, 18)
+	_, err = io.ReadFull(reader, body)
+	require.NoError(t, err)
+	assert.Equal(t, "5|localhost||hello", string(body))
+}
@@ -0,0 +1,102 @@
+package server
+
+import (
+	"errors"
+	"io/fs"
+	"mime"
+	"net/url"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+const (
+	indexFile      = "index.html"
+	httpTimeLayout = "Mon, 02 Jan 2006 15:04:05 GMT"
+)
+
+// FileServer returns a handler serving the files below root for GET and
+// HEAD requests. Paths can't escape root, and a directory is served through
+// its index.html.
+func FileServer(root string) (Handler, error) {
+	dir, err := os.OpenRoot(root)
+	if err != nil {
+		return nil, err
+	}
+
+	return func(w response.Writer, req *request.Request) {
+		method := req.RequestLine.Method
+		if method != "GET" && method != "HEAD" {
+			w.Header().Replace("Allow", "GET, HEAD")
+			w.WriteStatus(response.StatusMethodNotAllowed)
+			return
+		}
+
+		target, err := url.PathUnescape(routeOf(req))
+		if err != nil {
+			w.WriteStatus(response.StatusBadRequest)
+			return
+		}
+		name := strings.TrimPrefix(path.Clean("/"+target), "/")
+		if name == "" {
+			name = "."
+		}
+
+		info, err := dir.Stat(name)
+		if err == nil && info.IsDir() {
+			name = path.Join(name, indexFile)
+			info, err = dir.Stat(name)
+		}
+		if err != nil || !info.Mode().IsRegular() {
+			status := response.StatusNotFound
+			if errors.Is(err, fs.ErrPermission) {
+				status = response.StatusForbidden
+			}
+			w.WriteStatus(status)
+			return
+		}
+
+		file, err := dir.Open(name)
+		if err != nil {
+			w.WriteStatus(response.StatusForbidden)
+			return
+		}
+		defer file.Close()
+
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+		h := response.GetDefaultHeaders(0)
+		h.Replace("Content-Length", strconv.FormatInt(info.Size(), 10))
+		h.Replace("Content-Type", contentType)
+		h.Replace("Last-Modified", info.ModTime().UTC().Format(httpTimeLayout))
+
+		w.WriteStatusLine(response.StatusOk)
+		w.WriteHeaders(h)
+		if method != "HEAD" {
+			w.WriteChunkedBody(file)
+		}
+	}, nil
+}
+
+// StripPrefix returns middleware that removes prefix from the request target
+// before calling next, so a handler can be mounted below a path.
+func StripPrefix(prefix string) Middleware {
+	return func(next Handler) Handler {
+		return func(w response.Writer, req *request.Request) {
+			stripped := *req
+			target := strings.TrimPrefix(req.RequestLine.RequestTarget, prefix)
+			if !strings.HasPrefix(target, "/") {
+				target = "/" + target
+			}
+			stripped.RequestLine.RequestTarget = target
+
+			next(w, &stripped)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package server
+
+import (
+	"bytes"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestFileServer(t *testing.T) {
+	root := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(root, "index.html"), []byte("<h1>home</h1>"), 0o644))
+	require.NoError(t, os.Mkdir(filepath.Join(root, "css"), 0o755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "css", "site.css"), []byte("body{}"), 0o644))
+	require.NoError(t, os.WriteFile(filepath.Join(filepath.Dir(root), "secret.txt"), []byte("secret"), 0o644))
+
+	handler, err := FileServer(root)
+	require.NoError(t, err)
+	serve := func(raw string) string {
+		buf := &bytes.Buffer{}
+		handler(response.NewWriter(buf), newTestRequest(t, raw))
+		return buf.String()
+	}
+
+	// Test: Files are served with a content type from their extension
+	out := serve("GET /css/site.css?v=1 HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 200 OK\r\n")
+	assert.Contains(t, out, "content-type:text/css; charset=utf-8\r\n")
+	assert.Contains(t, out, "content-length:6\r\n")
+	assert.Contains(t, out, "last-modified:")
+	assert.Contains(t, out, "\r\n\r\nbody{}")
+
+	// Test: Directories are served through their index.html
+	out = serve("GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "\r\n\r\n<h1>home</h1>")
+
+	// Test: HEAD has headers but no body
+	out = serve("HEAD /css/site.css HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "content-length:6\r\n")
+	assert.NotContains(t, out, "body{}")
+
+	// Test: Paths can't escape the root
+	out = serve("GET /../secret.txt HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+	out = serve("GET /%2e%2e/secret.txt HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+
+	// Test: Missing files and directories without index are 404
+	out = serve("GET /missing.txt HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+	out = serve("GET /css/ HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 404 Not Found\r\n")
+
+	// Test: Other methods are rejected with Allow
+	out = serve("POST /css/site.css HTTP/1.1\r\nHost: localhost\r\nContent-Length: 0\r\n\r\n")
+	assert.Contains(t, out, "HTTP/1.1 405 Method Not Allowed\r\n")
+	assert.Contains(t, out, "allow:GET, HEAD\r\n")
+
+	// Test: Missing root is an error
+	_, err = FileServer(filepath.Join(root, "nope"))
+	assert.Error(t, err)
+}
+
+func TestStripPrefix(t *testing.T) {
+	buf := &bytes.Buffer{}
+	handler := StripPrefix("/static")(echoTargetHandler)
+
+	// Test: The prefix is removed from the target
+	handler(response.NewWriter(buf), newTestRequest(t, "GET /static/app.js?v=2 HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	assert.Contains(t, buf.String(), "\r\n\r\n/app.js?v=2")
+
+	// Test: The bare prefix becomes the root path
+	buf.Reset()
+	handler(response.NewWriter(buf), newTestRequest(t, "GET /static HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	assert.Contains(t, buf.String(), "\r\n\r\n/")
+}
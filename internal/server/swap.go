@@ -0,0 +1,32 @@
+package server
+
+import (
+	"sync/atomic"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+)
+
+// SwappableHandler dispatches to a handler that can be replaced while the
+// server is running, for example to reload configuration. Requests already
+// being handled finish with the handler they started with.
+type SwappableHandler struct {
+	current atomic.Pointer[Handler]
+}
+
+func NewSwappableHandler(handler Handler) *SwappableHandler {
+	s := &SwappableHandler{}
+	s.Swap(handler)
+
+	return s
+}
+
+// Swap makes handler serve every request from now on.
+func (s *SwappableHandler) Swap(handler Handler) {
+	s.current.Store(&handler)
+}
+
+// Handle has the signature of Handler and calls the current handler.
+func (s *SwappableHandler) Handle(w response.Writer, req *request.Request) {
+	(*s.current.Load())(w, req)
+}
@@ -0,0 +1,25 @@
+package server
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSwappableHandler(t *testing.T) {
+	swappable := NewSwappableHandler(okHandler)
+	serve := func() string {
+		buf := &bytes.Buffer{}
+		swappable.Handle(response.NewWriter(buf), newTestRequest(t, "GET /swapped HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+		return buf.String()
+	}
+
+	// Test: Requests go to the initial handler
+	assert.Contains(t, serve(), "\r\n\r\nhello")
+
+	// Test: Requests go to the new handler after a swap
+	swappable.Swap(echoTargetHandler)
+	assert.Contains(t, serve(), "\r\n\r\n/swapped")
+}
@@ -0,0 +1,70 @@
+package server
+
+import (
+	"errors"
+	"net"
+	"time"
+)
+
+// Timeouts bounds how long reading a request and writing its response may
+// take. Zero values mean no timeout.
+type Timeouts struct {
+	// ReadTimeout bounds the time from the first byte of a request until it
+	// has been read completely, body included. Requests exceeding it are
+	// answered with 408. Waiting for the first byte is governed by the
+	// keep-alive idle timeout instead.
+	ReadTimeout time.Duration
+	// WriteTimeout bounds the time spent handling a request and writing its
+	// response.
+	WriteTimeout time.Duration
+}
+
+// WithTimeouts sets the read and write timeouts for requests.
+func WithTimeouts(timeouts Timeouts) Option {
+	return func(s *Server) {
+		s.timeouts = timeouts
+	}
+}
+
+// readTimeoutConn starts the read timeout once the first byte of a request
+// arrives, so slow clients are cut off without limiting idle keep-alive
+// connections.
+type readTimeoutConn struct {
+	net.Conn
+	timeout time.Duration
+	waiting bool
+}
+
+func (c *readTimeoutConn) Read(p []byte) (int, error) {
+	n, err := c.Conn.Read(p)
+	if n > 0 && c.waiting {
+		c.waiting = false
+		c.Conn.SetReadDeadline(time.Now().Add(c.timeout))
+	}
+
+	return n, err
+}
+
+// waitRequest sets the read deadline before reading the next request.
+// buffered is the number of bytes of it that were already received.
+func (s *Server) waitRequest(conn net.Conn, rc *readTimeoutConn, buffered int) {
+	var deadline time.Time
+	if s.keepAlive.IdleTimeout > 0 {
+		deadline = time.Now().Add(s.keepAlive.IdleTimeout)
+	}
+	if rc != nil {
+		rc.waiting = buffered == 0
+		if !rc.waiting {
+			deadline = time.Now().Add(rc.timeout)
+		}
+	}
+
+	conn.SetReadDeadline(deadline)
+}
+
+// timedOut reports whether err is the read timeout expiring in the middle
+// of a request, as opposed to an idle connection timing out.
+func (c *readTimeoutConn) timedOut(err error) bool {
+	var netErr net.Error
+	return c != nil && !c.waiting && errors.As(err, &netErr) && netErr.Timeout()
+}
@@ -0,0 +1,40 @@
+package server
+
+import (
+	"bufio"
+	"io"
+	"log/slog"
+	"net"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadTimeout(t *testing.T) {
+	srv, err := Serve(0, okHandler, WithLogger(slog.New(slog.DiscardHandler)), WithTimeouts(Timeouts{ReadTimeout: 100 * time.Millisecond}))
+	require.NoError(t, err)
+	defer srv.Close()
+
+	conn, err := net.Dial("tcp", srv.Addr().String())
+	require.NoError(t, err)
+	defer conn.Close()
+	reader := bufio.NewReader(conn)
+
+	// Test: An idle connection is not cut off by the read timeout
+	time.Sleep(200 * time.Millisecond)
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n")
+	require.NoError(t, err)
+	status, _ := readStatusAndHeaders(t, reader)
+	assert.Equal(t, "HTTP/1.1 200 OK", status)
+	_, err = io.CopyN(io.Discard, reader, 5)
+	require.NoError(t, err)
+
+	// Test: A request that is not completed in time gets 408
+	_, err = io.WriteString(conn, "GET / HTTP/1.1\r\nHost: local")
+	require.NoError(t, err)
+	status, lines := readStatusAndHeaders(t, reader)
+	assert.Equal(t, "HTTP/1.1 408 Request Timeout", status)
+	assert.Contains(t, lines, "connection:close")
+}
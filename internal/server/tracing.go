@@ -0,0 +1,23 @@
+package server
+
+import (
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/tracing"
+)
+
+// Trace returns middleware giving every request an X-Request-ID and a W3C
+// trace context, accepted from the client or generated, and echoing them in
+// the response. Handlers get them with tracing.FromContext(req.Context())
+// and pass them on by giving that context to outgoing client requests. Put
+// it before AccessLog so requests are logged with their IDs.
+func Trace() Middleware {
+	return func(next Handler) Handler {
+		return func(w response.Writer, req *request.Request) {
+			ctx := tracing.NewContext(req.Context(), tracing.Extract(req.Headers))
+			tracing.Inject(ctx, w.Header())
+
+			next(w, req.WithContext(ctx))
+		}
+	}
+}
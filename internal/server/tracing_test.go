@@ -0,0 +1,53 @@
+package server
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/tracing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTrace(t *testing.T) {
+	raw := "GET /coffee HTTP/1.1\r\nHost: localhost\r\nX-Request-ID: abc\r\n" +
+		"traceparent: 00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01\r\n\r\n"
+	logs := &bytes.Buffer{}
+	logger := slog.New(slog.NewJSONHandler(logs, nil))
+
+	var info tracing.Info
+	handler := Chain(func(w response.Writer, req *request.Request) {
+		info, _ = tracing.FromContext(req.Context())
+		okHandler(w, req)
+	}, Trace(), AccessLog(logger, LogFormatJSON))
+
+	// Test: The IDs reach the handler and are echoed in the response
+	buf := &bytes.Buffer{}
+	handler(response.NewWriter(buf), newTestRequest(t, raw))
+	res, err := response.NewReader(buf).ReadResponse("GET")
+	require.NoError(t, err)
+	assert.Equal(t, "abc", info.RequestID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", info.Span.TraceID.String())
+	assert.Equal(t, "abc", res.Headers.Get("X-Request-ID"))
+	assert.Equal(t, info.Span.Traceparent(), res.Headers.Get("traceparent"))
+
+	// Test: The access log records the IDs
+	var record map[string]any
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &record))
+	assert.Equal(t, "abc", record["request_id"])
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", record["trace_id"])
+	assert.Equal(t, info.Span.SpanID.String(), record["span_id"])
+
+	// Test: Common Log Format lines get the IDs as attributes
+	logs.Reset()
+	handler = Chain(okHandler, Trace(), AccessLog(logger, LogFormatCommon))
+	handler(response.NewWriter(&bytes.Buffer{}), newTestRequest(t, "GET / HTTP/1.1\r\nHost: localhost\r\n\r\n"))
+	require.NoError(t, json.Unmarshal(logs.Bytes(), &record))
+	assert.Len(t, record["request_id"], 22)
+	assert.Len(t, record["trace_id"], 32)
+	assert.Contains(t, record["msg"], `"GET / HTTP/1.1" 200 5`)
+}
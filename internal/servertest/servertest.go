@@ -0,0 +1,114 @@
+package servertest
+
+import (
+	"bytes"
+	"log/slog"
+	"net"
+
+	"github.com/rmdevio/httpserver/internal/client"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+)
+
+// DefaultRemoteAddr is the client address given to requests built with
+// NewRequest.
+const DefaultRemoteAddr = "192.0.2.1:1234"
+
+// Recorder records everything a handler writes so it can be inspected as a
+// parsed response.
+type Recorder struct {
+	buf    bytes.Buffer
+	writer response.Writer
+}
+
+func NewRecorder() *Recorder {
+	rec := &Recorder{}
+	rec.writer = response.NewWriter(&rec.buf)
+
+	return rec
+}
+
+// Writer returns the response.Writer to pass to the handler under test.
+func (rec *Recorder) Writer() response.Writer {
+	return rec.writer
+}
+
+// Bytes returns the raw bytes written so far.
+func (rec *Recorder) Bytes() []byte {
+	return rec.buf.Bytes()
+}
+
+// Result parses what the handler wrote into a response. For responses to
+// HEAD use ResultFor.
+func (rec *Recorder) Result() (*response.Response, error) {
+	return rec.ResultFor("GET")
+}
+
+// ResultFor parses what the handler wrote as the response to a request with
+// the given method.
+func (rec *Recorder) ResultFor(method string) (*response.Response, error) {
+	return response.NewReader(bytes.NewReader(rec.buf.Bytes())).ReadResponse(method)
+}
+
+// NewRequest returns a request as the server would hand it to a handler,
+// with a Host header and DefaultRemoteAddr as the client address.
+func NewRequest(method, target, body string) *request.Request {
+	req := request.New(method, target, body)
+	req.Headers.Replace("Host", "example.com")
+	req.RemoteAddr = DefaultRemoteAddr
+
+	return req
+}
+
+// Serve runs handler for req and returns the response it wrote, parsed as
+// the response to req's method.
+func Serve(handler server.Handler, req *request.Request) (*response.Response, error) {
+	rec := NewRecorder()
+	handler(rec.Writer(), req)
+
+	return rec.ResultFor(req.RequestLine.Method)
+}
+
+// OK answers 200 with an empty body, standing in for the handler wrapped by
+// the middleware under test.
+func OK(w response.Writer, req *request.Request) {
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(response.GetDefaultHeaders(0))
+}
+
+// Server is a server listening on a random local port.
+type Server struct {
+	// URL is the base URL of the server, such as http://127.0.0.1:43567.
+	URL string
+
+	srv    *server.Server
+	client *client.Client
+}
+
+// NewServer starts a server for handler on a random port of the loopback
+// interface. Logging is discarded unless a WithLogger option is given.
+func NewServer(handler server.Handler, opts ...server.Option) (*Server, error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		return nil, err
+	}
+	opts = append([]server.Option{server.WithLogger(slog.New(slog.DiscardHandler))}, opts...)
+	srv := server.ServeListener(listener, handler, opts...)
+
+	return &Server{
+		URL:    "http://" + listener.Addr().String(),
+		srv:    srv,
+		client: client.New(client.WithMaxRedirects(0)),
+	}, nil
+}
+
+// Client returns a client for the server. It does not follow redirects.
+func (s *Server) Client() *client.Client {
+	return s.client
+}
+
+func (s *Server) Close() {
+	s.client.CloseIdleConnections()
+	s.srv.Close()
+}
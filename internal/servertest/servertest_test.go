@@ -0,0 +1,58 @@
+package servertest
+
+import (
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func helloHandler(w response.Writer, req *request.Request) {
+	body := []byte("hello " + req.RemoteAddr + " " + req.Body)
+	h := response.GetDefaultHeaders(len(body))
+	h.Replace("X-Target", req.RequestLine.RequestTarget)
+	w.WriteStatusLine(response.StatusCreated)
+	w.WriteHeaders(h)
+	w.WriteBody(body)
+}
+
+func TestRecorder(t *testing.T) {
+	// Test: Recorded output is parsed into a response
+	rec := NewRecorder()
+	helloHandler(rec.Writer(), NewRequest("POST", "/items", "x"))
+	res, err := rec.Result()
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCreated, res.StatusLine.StatusCode)
+	assert.Equal(t, "/items", res.Headers.Get("X-Target"))
+	assert.Equal(t, "hello "+DefaultRemoteAddr+" x", res.Body)
+
+	// Test: HEAD responses are parsed without a body
+	rec = NewRecorder()
+	w := rec.Writer()
+	w.WriteStatusLine(response.StatusOk)
+	w.WriteHeaders(response.GetDefaultHeaders(10))
+	res, err = rec.ResultFor("HEAD")
+	require.NoError(t, err)
+	assert.Equal(t, "10", res.Headers.Get("Content-Length"))
+
+	// Test: Serve parses the handler's response for the request's method
+	res, err = Serve(OK, NewRequest("HEAD", "/", ""))
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusOk, res.StatusLine.StatusCode)
+	assert.Empty(t, res.Body)
+}
+
+func TestServer(t *testing.T) {
+	srv, err := NewServer(helloHandler)
+	require.NoError(t, err)
+	defer srv.Close()
+
+	// Test: Requests reach the handler over the network
+	res, err := srv.Client().Post(srv.URL+"/items", "text/plain", "y")
+	require.NoError(t, err)
+	assert.Equal(t, response.StatusCreated, res.StatusLine.StatusCode)
+	assert.Equal(t, "/items", res.Headers.Get("X-Target"))
+	assert.Contains(t, res.Body, "hello 127.0.0.1:")
+}
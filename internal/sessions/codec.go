@@ -0,0 +1,86 @@
+package sessions
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"strings"
+)
+
+var errInvalidCookie = errors.New("sessions: invalid cookie")
+
+// codec signs cookie values with HMAC-SHA256 and, with an encryption key,
+// encrypts them with AES-GCM first. The cookie name is covered by the
+// signature so a value can't be moved to another cookie.
+type codec struct {
+	hashKey []byte
+	aead    cipher.AEAD
+}
+
+func newCodec(hashKey, blockKey []byte) (*codec, error) {
+	c := &codec{hashKey: hashKey}
+	if blockKey == nil {
+		return c, nil
+	}
+
+	block, err := aes.NewCipher(blockKey)
+	if err != nil {
+		return nil, err
+	}
+	if c.aead, err = cipher.NewGCM(block); err != nil {
+		return nil, err
+	}
+
+	return c, nil
+}
+
+func (c *codec) encode(name string, data []byte) string {
+	if c.aead != nil {
+		nonce := make([]byte, c.aead.NonceSize())
+		rand.Read(nonce)
+		data = c.aead.Seal(nonce, nonce, data, []byte(name))
+	}
+
+	payload := base64.RawURLEncoding.EncodeToString(data)
+	return payload + "." + base64.RawURLEncoding.EncodeToString(c.mac(name, payload))
+}
+
+func (c *codec) decode(name, value string) ([]byte, error) {
+	payload, signature, ok := strings.Cut(value, ".")
+	if !ok {
+		return nil, errInvalidCookie
+	}
+	mac, err := base64.RawURLEncoding.DecodeString(signature)
+	if err != nil || !hmac.Equal(mac, c.mac(name, payload)) {
+		return nil, errInvalidCookie
+	}
+	data, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return nil, errInvalidCookie
+	}
+
+	if c.aead != nil {
+		if len(data) < c.aead.NonceSize() {
+			return nil, errInvalidCookie
+		}
+		nonce, ciphertext := data[:c.aead.NonceSize()], data[c.aead.NonceSize():]
+		if data, err = c.aead.Open(nil, nonce, ciphertext, []byte(name)); err != nil {
+			return nil, errInvalidCookie
+		}
+	}
+
+	return data, nil
+}
+
+func (c *codec) mac(name, payload string) []byte {
+	h := hmac.New(sha256.New, c.hashKey)
+	h.Write([]byte(name))
+	h.Write([]byte{'|'})
+	h.Write([]byte(payload))
+
+	return h.Sum(nil)
+}
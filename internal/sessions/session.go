@@ -0,0 +1,130 @@
+package sessions
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"sync"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+)
+
+// Session holds the values kept for a client between requests. Values are
+// encoded as JSON, so numbers come back as float64. It is safe for
+// concurrent use.
+type Session struct {
+	mu        sync.Mutex
+	id        string
+	values    map[string]any
+	createdAt time.Time
+	lastSeen  time.Time
+
+	isNew     bool
+	modified  bool
+	destroyed bool
+	// oldID is the ID replaced by RotateID, to be removed from the store.
+	oldID string
+}
+
+type sessionKey struct{}
+
+// FromRequest returns the session loaded by the Manager middleware, or nil
+// if the request didn't go through it.
+func FromRequest(req *request.Request) *Session {
+	s, _ := req.Context().Value(sessionKey{}).(*Session)
+	return s
+}
+
+func newSession(now time.Time) *Session {
+	return &Session{
+		id:        newID(),
+		values:    make(map[string]any),
+		createdAt: now,
+		lastSeen:  now,
+		isNew:     true,
+	}
+}
+
+func newID() string {
+	b := make([]byte, 32)
+	rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// ID returns the session ID. It changes with RotateID.
+func (s *Session) ID() string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.id
+}
+
+// IsNew reports whether the session was created for this request.
+func (s *Session) IsNew() bool {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.isNew
+}
+
+// CreatedAt returns when the session was created, from which its absolute
+// timeout runs.
+func (s *Session) CreatedAt() time.Time {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.createdAt
+}
+
+func (s *Session) Get(key string) any {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.values[key]
+}
+
+func (s *Session) Set(key string, value any) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.values[key] = value
+	s.modified = true
+}
+
+func (s *Session) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.values, key)
+	s.modified = true
+}
+
+// RotateID gives the session a new ID while keeping its values. Call it
+// when the privileges of the session change, such as on login, so an ID
+// planted by an attacker before login is worthless afterwards.
+func (s *Session) RotateID() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.oldID == "" && !s.isNew {
+		s.oldID = s.id
+	}
+	s.id = newID()
+	s.modified = true
+}
+
+// Destroy removes the session from the store and the client, such as on
+// logout.
+func (s *Session) Destroy() {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.destroyed = true
+	s.values = make(map[string]any)
+}
+
+func withSession(req *request.Request, s *Session) *request.Request {
+	return req.WithContext(context.WithValue(req.Context(), sessionKey{}, s))
+}
@@ -0,0 +1,260 @@
+package sessions
+
+import (
+	"encoding/json"
+	"errors"
+	"log/slog"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/cookie"
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/server"
+)
+
+var ErrShortKey = errors.New("sessions: signing key must be at least 32 bytes")
+
+const (
+	defaultIdleTimeout     = 30 * time.Minute
+	defaultAbsoluteTimeout = 24 * time.Hour
+	// maxCookieSize is the size browsers are required to accept for a
+	// cookie, name and attributes included.
+	maxCookieSize = 4096
+)
+
+// Manager loads and saves the sessions of requests going through its
+// middleware. Sessions are kept in a signed cookie, which can also be
+// encrypted, or in a Store with only their ID in the cookie.
+type Manager struct {
+	hashKey         []byte
+	blockKey        []byte
+	codec           *codec
+	store           Store
+	cookie          cookie.Cookie
+	idleTimeout     time.Duration
+	absoluteTimeout time.Duration
+	logger          *slog.Logger
+	now             func() time.Time
+}
+
+type Option func(m *Manager)
+
+// WithEncryptionKey encrypts cookies with AES-GCM, using a 16, 24 or 32 byte
+// key. Without it, cookie-backed sessions are signed but readable by the
+// client.
+func WithEncryptionKey(key []byte) Option {
+	return func(m *Manager) {
+		m.blockKey = key
+	}
+}
+
+// WithStore keeps session data in store, leaving only the signed session ID
+// in the cookie.
+func WithStore(store Store) Option {
+	return func(m *Manager) {
+		m.store = store
+	}
+}
+
+// WithCookie sets the name and attributes of the session cookie. Its Value,
+// Expires and MaxAge are ignored. Defaults to a cookie named "session" with
+// Path=/, HttpOnly and SameSite=Lax.
+func WithCookie(c cookie.Cookie) Option {
+	return func(m *Manager) {
+		m.cookie = c
+	}
+}
+
+// WithIdleTimeout expires sessions not used for d. Defaults to 30 minutes.
+func WithIdleTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.idleTimeout = d
+	}
+}
+
+// WithAbsoluteTimeout expires sessions d after they were created, however
+// active they are. Defaults to 24 hours.
+func WithAbsoluteTimeout(d time.Duration) Option {
+	return func(m *Manager) {
+		m.absoluteTimeout = d
+	}
+}
+
+// WithLogger sets the logger for sessions that fail to save. Defaults to
+// slog.Default().
+func WithLogger(logger *slog.Logger) Option {
+	return func(m *Manager) {
+		m.logger = logger
+	}
+}
+
+// New returns a Manager signing cookies with hashKey, which must hold at
+// least 32 random bytes.
+func New(hashKey []byte, opts ...Option) (*Manager, error) {
+	if len(hashKey) < 32 {
+		return nil, ErrShortKey
+	}
+
+	m := &Manager{
+		hashKey: hashKey,
+		cookie: cookie.Cookie{
+			Name:     "session",
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: cookie.SameSiteLax,
+		},
+		idleTimeout:     defaultIdleTimeout,
+		absoluteTimeout: defaultAbsoluteTimeout,
+		logger:          slog.Default(),
+		now:             time.Now,
+	}
+	for _, opt := range opts {
+		opt(m)
+	}
+	if err := m.cookie.Validate(); err != nil {
+		return nil, err
+	}
+
+	var err error
+	if m.codec, err = newCodec(m.hashKey, m.blockKey); err != nil {
+		return nil, err
+	}
+
+	return m, nil
+}
+
+// record is the saved form of a session.
+type record struct {
+	ID        string         `json:"id"`
+	Values    map[string]any `json:"values"`
+	CreatedAt time.Time      `json:"created_at"`
+	LastSeen  time.Time      `json:"last_seen"`
+}
+
+// Middleware loads the session of each request, available to next through
+// FromRequest, and saves it right before the response headers are written.
+// Sessions that are new and were never modified are not saved, so clients
+// only get a cookie once there is something to remember.
+func (m *Manager) Middleware() server.Middleware {
+	return func(next server.Handler) server.Handler {
+		return func(w response.Writer, req *request.Request) {
+			s := m.load(req)
+
+			saved := false
+			save := func() {
+				if !saved {
+					saved = true
+					m.save(w, s)
+				}
+			}
+			w.BeforeWriteHeaders(save)
+
+			next(w, withSession(req, s))
+			// Saves the session in the store if the handler wrote no headers
+			save()
+		}
+	}
+}
+
+func (m *Manager) load(req *request.Request) *Session {
+	now := m.now()
+	c := req.Cookie(m.cookie.Name)
+	if c == nil {
+		return newSession(now)
+	}
+
+	rec, err := m.read(c.Value)
+	if err != nil {
+		return newSession(now)
+	}
+	if now.Sub(rec.LastSeen) >= m.idleTimeout || now.Sub(rec.CreatedAt) >= m.absoluteTimeout {
+		if m.store != nil {
+			m.store.Delete(rec.ID)
+		}
+		return newSession(now)
+	}
+	if rec.Values == nil {
+		rec.Values = make(map[string]any)
+	}
+
+	return &Session{
+		id:        rec.ID,
+		values:    rec.Values,
+		createdAt: rec.CreatedAt,
+		lastSeen:  now,
+	}
+}
+
+func (m *Manager) read(value string) (*record, error) {
+	data, err := m.codec.decode(m.cookie.Name, value)
+	if err != nil {
+		return nil, err
+	}
+	if m.store != nil {
+		if data, err = m.store.Load(string(data)); err != nil {
+			return nil, err
+		}
+	}
+
+	var rec record
+	if err := json.Unmarshal(data, &rec); err != nil {
+		return nil, err
+	}
+
+	return &rec, nil
+}
+
+func (m *Manager) save(w response.Writer, s *Session) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.oldID != "" && m.store != nil {
+		m.store.Delete(s.oldID)
+	}
+	if s.destroyed {
+		if !s.isNew {
+			if m.store != nil {
+				m.store.Delete(s.id)
+			}
+			expired := m.cookie
+			expired.MaxAge = -1
+			w.SetCookie(&expired)
+		}
+		return
+	}
+	if s.isNew && !s.modified {
+		return
+	}
+
+	expiresAt := s.lastSeen.Add(m.idleTimeout)
+	if absolute := s.createdAt.Add(m.absoluteTimeout); absolute.Before(expiresAt) {
+		expiresAt = absolute
+	}
+	data, err := json.Marshal(record{
+		ID:        s.id,
+		Values:    s.values,
+		CreatedAt: s.createdAt,
+		LastSeen:  s.lastSeen,
+	})
+	if err != nil {
+		m.logger.Error("failed to encode session", "error", err)
+		return
+	}
+
+	c := m.cookie
+	c.MaxAge = max(int(expiresAt.Sub(s.lastSeen).Seconds()), 1)
+	if m.store != nil {
+		if err := m.store.Save(s.id, data, expiresAt); err != nil {
+			m.logger.Error("failed to save session", "error", err)
+			return
+		}
+		c.Value = m.codec.encode(c.Name, []byte(s.id))
+	} else {
+		c.Value = m.codec.encode(c.Name, data)
+	}
+	if size := len(c.String()); size > maxCookieSize {
+		m.logger.Error("session cookie too large, use a store", "size", size)
+		return
+	}
+	w.SetCookie(&c)
+}
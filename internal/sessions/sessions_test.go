@@ -0,0 +1,169 @@
+package sessions
+
+import (
+	"log/slog"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/rmdevio/httpserver/internal/request"
+	"github.com/rmdevio/httpserver/internal/response"
+	"github.com/rmdevio/httpserver/internal/servertest"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testKey = []byte("0123456789abcdef0123456789abcdef")
+
+// serve runs handler behind the session middleware with the given cookie
+// and returns the Set-Cookie header of the response.
+func serve(t *testing.T, m *Manager, cookie string, handler func(s *Session)) string {
+	req := servertest.NewRequest("GET", "/", "")
+	if cookie != "" {
+		req.Headers.Set("Cookie", cookie)
+	}
+	res, err := servertest.Serve(m.Middleware()(func(w response.Writer, req *request.Request) {
+		handler(FromRequest(req))
+		servertest.OK(w, req)
+	}), req)
+	require.NoError(t, err)
+	return res.Headers.Get("Set-Cookie")
+}
+
+// cookiePair returns the name=value part of a Set-Cookie header.
+func cookiePair(setCookie string) string {
+	pair, _, _ := strings.Cut(setCookie, ";")
+	return pair
+}
+
+func TestCookieSessions(t *testing.T) {
+	m, err := New(testKey, WithLogger(slog.New(slog.DiscardHandler)))
+	require.NoError(t, err)
+
+	// Test: Short keys are rejected
+	_, err = New([]byte("short"))
+	assert.ErrorIs(t, err, ErrShortKey)
+
+	// Test: Untouched new sessions don't set a cookie
+	assert.Empty(t, serve(t, m, "", func(s *Session) {
+		assert.True(t, s.IsNew())
+	}))
+
+	// Test: Values are kept in the signed cookie
+	setCookie := serve(t, m, "", func(s *Session) {
+		s.Set("user", "gopher")
+	})
+	assert.Contains(t, setCookie, "session=")
+	assert.Contains(t, setCookie, "Path=/; HttpOnly; SameSite=Lax")
+	assert.Contains(t, setCookie, "Max-Age=1800")
+	session := cookiePair(setCookie)
+	serve(t, m, session, func(s *Session) {
+		assert.False(t, s.IsNew())
+		assert.Equal(t, "gopher", s.Get("user"))
+	})
+
+	// Test: Tampered cookies start a new session
+	payload, signature, _ := strings.Cut(session, ".")
+	serve(t, m, payload+"x."+signature, func(s *Session) {
+		assert.True(t, s.IsNew())
+		assert.Nil(t, s.Get("user"))
+	})
+
+	// Test: Cookies signed with another key are rejected
+	other, err := New([]byte("fedcba9876543210fedcba9876543210"))
+	require.NoError(t, err)
+	serve(t, other, session, func(s *Session) {
+		assert.True(t, s.IsNew())
+	})
+
+	// Test: Destroy expires the cookie
+	setCookie = serve(t, m, session, func(s *Session) {
+		s.Destroy()
+	})
+	assert.Contains(t, setCookie, "session=; Max-Age=0")
+}
+
+func TestEncryptedSessions(t *testing.T) {
+	m, err := New(testKey, WithEncryptionKey([]byte("0123456789abcdef")))
+	require.NoError(t, err)
+
+	// Test: Values can't be read from the cookie but round-trip
+	session := cookiePair(serve(t, m, "", func(s *Session) {
+		s.Set("secret", "plaintext-value")
+	}))
+	payload, _, _ := strings.Cut(strings.TrimPrefix(session, "session="), ".")
+	assert.NotContains(t, payload, "cGxhaW50ZXh0")
+	serve(t, m, session, func(s *Session) {
+		assert.Equal(t, "plaintext-value", s.Get("secret"))
+	})
+
+	// Test: Invalid encryption keys are rejected
+	_, err = New(testKey, WithEncryptionKey([]byte("short")))
+	assert.Error(t, err)
+}
+
+func TestStoreSessions(t *testing.T) {
+	now := time.Date(2026, 1, 1, 12, 0, 0, 0, time.UTC)
+	store := NewMemoryStore()
+	store.now = func() time.Time { return now }
+	m, err := New(testKey, WithStore(store), WithIdleTimeout(10*time.Minute), WithAbsoluteTimeout(time.Hour))
+	require.NoError(t, err)
+	m.now = func() time.Time { return now }
+
+	// Test: Only the signed ID is in the cookie
+	var id string
+	session := cookiePair(serve(t, m, "", func(s *Session) {
+		s.Set("cart", []string{"coffee"})
+		id = s.ID()
+	}))
+	assert.NotContains(t, session, "coffee")
+	assert.Equal(t, 1, store.Len())
+	serve(t, m, session, func(s *Session) {
+		assert.Equal(t, id, s.ID())
+		assert.Equal(t, []any{"coffee"}, s.Get("cart"))
+	})
+
+	// Test: RotateID keeps the values under a new ID and drops the old one
+	rotated := cookiePair(serve(t, m, session, func(s *Session) {
+		s.RotateID()
+	}))
+	assert.NotEqual(t, session, rotated)
+	assert.Equal(t, 1, store.Len())
+	serve(t, m, session, func(s *Session) {
+		assert.True(t, s.IsNew())
+	})
+	serve(t, m, rotated, func(s *Session) {
+		assert.NotEqual(t, id, s.ID())
+		assert.Equal(t, []any{"coffee"}, s.Get("cart"))
+	})
+
+	// Test: Sessions expire when idle
+	now = now.Add(11 * time.Minute)
+	serve(t, m, rotated, func(s *Session) {
+		assert.True(t, s.IsNew())
+	})
+
+	// Test: Sessions expire after the absolute timeout, even when active
+	session = cookiePair(serve(t, m, "", func(s *Session) {
+		s.Set("user", "gopher")
+	}))
+	for range 6 {
+		now = now.Add(9 * time.Minute)
+		serve(t, m, session, func(s *Session) {
+			assert.False(t, s.IsNew())
+		})
+	}
+	now = now.Add(9 * time.Minute)
+	serve(t, m, session, func(s *Session) {
+		assert.True(t, s.IsNew())
+	})
+
+	// Test: Destroy removes the session from the store
+	session = cookiePair(serve(t, m, "", func(s *Session) {
+		s.Set("user", "gopher")
+	}))
+	serve(t, m, session, func(s *Session) {
+		s.Destroy()
+	})
+	assert.Equal(t, 0, store.Len())
+}
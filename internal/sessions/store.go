@@ -0,0 +1,97 @@
+package sessions
+
+import (
+	"errors"
+	"sync"
+	"time"
+)
+
+var ErrNotFound = errors.New("sessions: session not found")
+
+// Store keeps session data on the server, so the cookie only carries the
+// session ID. Implementations must be safe for concurrent use.
+type Store interface {
+	// Load returns the data saved for id, or ErrNotFound if there is none or
+	// it expired.
+	Load(id string) ([]byte, error)
+	// Save stores data for id until expiresAt.
+	Save(id string, data []byte, expiresAt time.Time) error
+	Delete(id string) error
+}
+
+// sweepInterval is how often MemoryStore removes expired sessions.
+const sweepInterval = time.Minute
+
+// MemoryStore is a Store keeping sessions in memory, for a single process.
+// Expired sessions are removed as they are found and by periodic sweeps
+// during saves.
+type MemoryStore struct {
+	mu        sync.Mutex
+	sessions  map[string]memoryEntry
+	lastSweep time.Time
+	now       func() time.Time
+}
+
+type memoryEntry struct {
+	data      []byte
+	expiresAt time.Time
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		sessions: make(map[string]memoryEntry),
+		now:      time.Now,
+	}
+}
+
+func (m *MemoryStore) Load(id string) ([]byte, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	entry, ok := m.sessions[id]
+	if !ok {
+		return nil, ErrNotFound
+	}
+	if !m.now().Before(entry.expiresAt) {
+		delete(m.sessions, id)
+		return nil, ErrNotFound
+	}
+
+	return entry.data, nil
+}
+
+func (m *MemoryStore) Save(id string, data []byte, expiresAt time.Time) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now()
+	if now.Sub(m.lastSweep) >= sweepInterval {
+		m.lastSweep = now
+		for id, entry := range m.sessions {
+			if !now.Before(entry.expiresAt) {
+				delete(m.sessions, id)
+			}
+		}
+	}
+	m.sessions[id] = memoryEntry{data: data, expiresAt: expiresAt}
+
+	return nil
+}
+
+func (m *MemoryStore) Delete(id string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	delete(m.sessions, id)
+
+	return nil
+}
+
+// Len returns the number of sessions held, including expired ones not
+// removed yet.
+func (m *MemoryStore) Len() int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	return len(m.sessions)
+}
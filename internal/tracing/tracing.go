@@ -0,0 +1,223 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strings"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+)
+
+var ErrInvalidTraceparent = errors.New("tracing: invalid traceparent")
+
+const (
+	RequestIDHeader   = "X-Request-ID"
+	TraceparentHeader = "traceparent"
+	TracestateHeader  = "tracestate"
+
+	// FlagSampled is the trace flag telling that the caller may have recorded
+	// the trace. It is set on the traces started here.
+	FlagSampled byte = 0x01
+
+	// maxRequestIDLen bounds accepted request IDs, so clients can't make
+	// every log line huge.
+	maxRequestIDLen = 128
+	// maxTracestateLen is the length the W3C Trace Context spec requires
+	// implementations to pass on; longer values are dropped.
+	maxTracestateLen = 512
+)
+
+// TraceID identifies a whole trace across services.
+type TraceID [16]byte
+
+func (id TraceID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id TraceID) IsValid() bool {
+	return id != TraceID{}
+}
+
+// SpanID identifies one operation of a trace, such as the handling of a
+// request by this server.
+type SpanID [8]byte
+
+func (id SpanID) String() string {
+	return hex.EncodeToString(id[:])
+}
+
+func (id SpanID) IsValid() bool {
+	return id != SpanID{}
+}
+
+// SpanContext is what the traceparent and tracestate headers carry.
+type SpanContext struct {
+	TraceID TraceID
+	SpanID  SpanID
+	Flags   byte
+	// State is vendor data passed on unchanged in the tracestate header.
+	State string
+}
+
+func (sc SpanContext) Sampled() bool {
+	return sc.Flags&FlagSampled != 0
+}
+
+// Traceparent returns the traceparent header value for sc.
+func (sc SpanContext) Traceparent() string {
+	return "00-" + sc.TraceID.String() + "-" + sc.SpanID.String() + "-" + hex.EncodeToString([]byte{sc.Flags})
+}
+
+// ParseTraceparent parses a traceparent header value. Versions after 00
+// are accepted as long as they start with the fields of version 00, as the
+// spec requires.
+func ParseTraceparent(value string) (SpanContext, error) {
+	var sc SpanContext
+	if len(value) < 55 || value[2] != '-' || value[35] != '-' || value[52] != '-' {
+		return sc, ErrInvalidTraceparent
+	}
+	version, ok := decodeHex(value[:2])
+	if !ok || version[0] == 0xff {
+		return sc, ErrInvalidTraceparent
+	}
+	if len(value) > 55 && (version[0] == 0 || value[55] != '-') {
+		return sc, ErrInvalidTraceparent
+	}
+
+	traceID, ok1 := decodeHex(value[3:35])
+	spanID, ok2 := decodeHex(value[36:52])
+	flags, ok3 := decodeHex(value[53:55])
+	if !ok1 || !ok2 || !ok3 {
+		return sc, ErrInvalidTraceparent
+	}
+	copy(sc.TraceID[:], traceID)
+	copy(sc.SpanID[:], spanID)
+	sc.Flags = flags[0]
+	if !sc.TraceID.IsValid() || !sc.SpanID.IsValid() {
+		return sc, ErrInvalidTraceparent
+	}
+
+	return sc, nil
+}
+
+// decodeHex decodes lowercase hex only, which is all traceparent allows.
+func decodeHex(s string) ([]byte, bool) {
+	if strings.ContainsAny(s, "ABCDEF") {
+		return nil, false
+	}
+	b, err := hex.DecodeString(s)
+
+	return b, err == nil
+}
+
+func NewTraceID() TraceID {
+	var id TraceID
+	rand.Read(id[:])
+
+	return id
+}
+
+func NewSpanID() SpanID {
+	var id SpanID
+	rand.Read(id[:])
+
+	return id
+}
+
+// NewRequestID returns a random request ID of 22 URL-safe characters.
+func NewRequestID() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Info identifies a request across the logs of the services it goes
+// through.
+type Info struct {
+	RequestID string
+	// Span is the span of the request in this server. Its trace ID comes from
+	// the caller's traceparent when there is a valid one.
+	Span SpanContext
+	// Parent is the caller's span, if it sent a traceparent.
+	Parent SpanID
+}
+
+type infoKey struct{}
+
+func NewContext(ctx context.Context, info Info) context.Context {
+	return context.WithValue(ctx, infoKey{}, info)
+}
+
+// FromContext returns the Info stored by NewContext, which the server's
+// Trace middleware puts in request contexts.
+func FromContext(ctx context.Context) (Info, bool) {
+	info, ok := ctx.Value(infoKey{}).(Info)
+	return info, ok
+}
+
+// RequestID returns the request ID stored in ctx, or "" if there is none.
+func RequestID(ctx context.Context) string {
+	info, _ := FromContext(ctx)
+	return info.RequestID
+}
+
+// Extract returns the Info of an incoming request with headers h. The
+// X-Request-ID is kept if it's printable ASCII of reasonable length and
+// generated otherwise. A valid traceparent continues the caller's trace with
+// a new span; without one a new trace is started.
+func Extract(h *headers.Headers) Info {
+	info := Info{RequestID: h.Get(RequestIDHeader)}
+	if !validRequestID(info.RequestID) {
+		info.RequestID = NewRequestID()
+	}
+
+	parent, err := ParseTraceparent(strings.TrimSpace(h.Get(TraceparentHeader)))
+	if err != nil {
+		info.Span = SpanContext{TraceID: NewTraceID(), SpanID: NewSpanID(), Flags: FlagSampled}
+		return info
+	}
+
+	info.Parent = parent.SpanID
+	info.Span = SpanContext{TraceID: parent.TraceID, SpanID: NewSpanID(), Flags: parent.Flags}
+	if state := strings.TrimSpace(h.Get(TracestateHeader)); len(state) <= maxTracestateLen {
+		info.Span.State = state
+	}
+
+	return info
+}
+
+// Inject sets the X-Request-ID, traceparent and tracestate headers of h from
+// the Info in ctx, replacing any existing ones. The traceparent carries the
+// span of ctx, so it is the parent of outgoing requests made with h. It does
+// nothing if ctx has no Info.
+func Inject(ctx context.Context, h *headers.Headers) {
+	info, ok := FromContext(ctx)
+	if !ok {
+		return
+	}
+
+	h.Replace(RequestIDHeader, info.RequestID)
+	h.Replace(TraceparentHeader, info.Span.Traceparent())
+	if info.Span.State != "" {
+		h.Replace(TracestateHeader, info.Span.State)
+	} else {
+		h.Remove(TracestateHeader)
+	}
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > maxRequestIDLen {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] < 0x21 || id[i] > 0x7e {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,88 @@
+package tracing
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/rmdevio/httpserver/internal/headers"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const parent = "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01"
+
+func TestParseTraceparent(t *testing.T) {
+	// Test: Valid values round-trip
+	sc, err := ParseTraceparent(parent)
+	require.NoError(t, err)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", sc.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", sc.SpanID.String())
+	assert.True(t, sc.Sampled())
+	assert.Equal(t, parent, sc.Traceparent())
+
+	// Test: Future versions may append fields
+	sc, err = ParseTraceparent("cc-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-00-future")
+	require.NoError(t, err)
+	assert.False(t, sc.Sampled())
+
+	// Test: Malformed values are rejected
+	for _, value := range []string{
+		"",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7",
+		"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01",
+		"00-00000000000000000000000000000000-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-0000000000000000-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01-extra",
+		"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+		"00-4bf92f3577b34da6a3ce929d0e0e473g-00f067aa0ba902b7-01",
+		"00_4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01",
+	} {
+		_, err := ParseTraceparent(value)
+		assert.ErrorIs(t, err, ErrInvalidTraceparent, value)
+	}
+}
+
+func TestExtractInject(t *testing.T) {
+	// Test: Incoming IDs are accepted and the trace continues with a new span
+	h := headers.NewHeaders()
+	h.Set("X-Request-ID", "req-123")
+	h.Set("traceparent", parent)
+	h.Set("tracestate", "vendor=abc")
+	info := Extract(h)
+	assert.Equal(t, "req-123", info.RequestID)
+	assert.Equal(t, "4bf92f3577b34da6a3ce929d0e0e4736", info.Span.TraceID.String())
+	assert.Equal(t, "00f067aa0ba902b7", info.Parent.String())
+	assert.NotEqual(t, info.Parent, info.Span.SpanID)
+	assert.True(t, info.Span.SpanID.IsValid())
+	assert.Equal(t, "vendor=abc", info.Span.State)
+
+	// Test: Inject passes the request's span on as the parent
+	ctx := NewContext(context.Background(), info)
+	assert.Equal(t, "req-123", RequestID(ctx))
+	out := headers.NewHeaders()
+	out.Set("traceparent", parent)
+	Inject(ctx, out)
+	assert.Equal(t, "req-123", out.Get("X-Request-ID"))
+	assert.Equal(t, "00-4bf92f3577b34da6a3ce929d0e0e4736-"+info.Span.SpanID.String()+"-01", out.Get("traceparent"))
+	assert.Equal(t, "vendor=abc", out.Get("tracestate"))
+
+	// Test: Missing or invalid IDs are generated, starting a new trace
+	h = headers.NewHeaders()
+	h.Set("X-Request-ID", strings.Repeat("x", 200))
+	h.Set("traceparent", "garbage")
+	h.Set("tracestate", "vendor=abc")
+	info = Extract(h)
+	assert.Len(t, info.RequestID, 22)
+	assert.True(t, info.Span.TraceID.IsValid())
+	assert.True(t, info.Span.Sampled())
+	assert.False(t, info.Parent.IsValid())
+	assert.Empty(t, info.Span.State)
+	assert.NotEqual(t, info.RequestID, Extract(h).RequestID)
+
+	// Test: Inject does nothing without an Info
+	out = headers.NewHeaders()
+	Inject(context.Background(), out)
+	assert.Empty(t, out.Get("X-Request-ID"))
+	assert.Empty(t, RequestID(context.Background()))
+}